@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 
+	"github.com/bestchains/bc-explorer/pkg/metrics"
 	"github.com/bestchains/bc-explorer/pkg/observer"
 	"k8s.io/apiserver/pkg/server"
 	"k8s.io/klog/v2"
@@ -33,6 +34,7 @@ var (
 	host              = flag.String("host", "http://localhost:9999", "the host of listener")
 	operatorNamespace = flag.String("operator-namespace", "baas-system", "the ns of fabric-operator")
 	authMethod        = flag.String("auth", "none", "user authentication method, none, oidc or kubernetes")
+	metricsAddr       = flag.String("metrics-addr", ":9997", "used to serve prometheus metrics, empty to disable")
 )
 
 func main() {
@@ -56,6 +58,13 @@ func run() error {
 		<-stopCh
 		cancel()
 	}()
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, *metricsAddr); err != nil {
+				klog.ErrorS(err, "serve metrics error", "addr", *metricsAddr)
+			}
+		}()
+	}
 	restConfig := config.GetConfigOrDie()
 	if err := observer.Run(ctx, restConfig, *host, *operatorNamespace, *authMethod); err != nil {
 		return err
@@ -22,10 +22,12 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/health"
 )
 
-// New creates a new middleware handler
-func New(ctx context.Context, config Config) fiber.Handler {
+// New creates a new middleware handler, along with a check of whether it's ready to authorize requests
+func New(ctx context.Context, config Config) (fiber.Handler, health.Check, error) {
 	var a auth
 	switch strings.ToLower(config.AuthMethod) {
 	case "none":
@@ -38,14 +40,15 @@ func New(ctx context.Context, config Config) fiber.Handler {
 		a = &KubernetesAuthor{SkipAuthorize: config.SkipAuthorize}
 	}
 	if err := a.New(ctx); err != nil {
-		// If auth init fails, should panic as soon as possible.
-		panic(err)
+		return nil, nil, err
 	}
 	klog.Infoln("auth init success", "authMethod", config.AuthMethod)
-	return a.Run()
+	return a.Run(), a.Ready, nil
 }
 
 type auth interface {
 	New(ctx context.Context) error
 	Run() fiber.Handler
+	// Ready returns an error until caches used to authorize requests are synced
+	Ready(ctx context.Context) error
 }
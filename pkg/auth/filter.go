@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	// decisionTTL is how long a decision of network filters is reused
+	decisionTTL = 30 * time.Second
+	// maxDecisions triggers removal of expired decisions once the cache grows beyond it
+	maxDecisions = 10000
+)
+
+// NetworkFilter tells whether the user of a request is authorized to get a network by its id `{network}_{channelID}`
+type NetworkFilter func(ctx context.Context, networkID string) (bool, error)
+
+type networkFilterKey struct{}
+
+// withNetworkFilter carries a network filter in the context of a request, which is copied to the fiber context
+// once the request is passed to the next handler
+func withNetworkFilter(ctx context.Context, filter NetworkFilter) context.Context {
+	return context.WithValue(ctx, networkFilterKey{}, filter)
+}
+
+// NetworkFilterFrom returns the network filter of a request, nil if the user is authorized to get all networks
+func NetworkFilterFrom(ctx *fiber.Ctx) NetworkFilter {
+	filter, _ := ctx.Context().UserValue(networkFilterKey{}).(NetworkFilter)
+	return filter
+}
+
+// decisionCache keeps decisions of network filters for users, so that searches don't authorize every network
+// on each request
+type decisionCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	decisions map[string]decision
+}
+
+type decision struct {
+	allowed bool
+	expires time.Time
+}
+
+func newDecisionCache(ttl time.Duration) *decisionCache {
+	return &decisionCache{ttl: ttl, decisions: make(map[string]decision)}
+}
+
+// decisionKey identifies a network to a user by name and groups, which decide the user's permissions
+func decisionKey(u user.Info, networkID string) string {
+	return strings.Join([]string{u.GetName(), strings.Join(u.GetGroups(), ","), networkID}, "\x00")
+}
+
+// get returns the decision of a user to a network, found is false if it's not cached or expired
+func (c *decisionCache) get(u user.Info, networkID string) (allowed, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.decisions[decisionKey(u, networkID)]
+	if !ok || time.Now().After(d.expires) {
+		return false, false
+	}
+	return d.allowed, true
+}
+
+func (c *decisionCache) set(u user.Info, networkID string, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.decisions) >= maxDecisions {
+		for key, d := range c.decisions {
+			if now.After(d.expires) {
+				delete(c.decisions, key)
+			}
+		}
+	}
+	c.decisions[decisionKey(u, networkID)] = decision{allowed: allowed, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestDecisionCache(t *testing.T) {
+	c := newDecisionCache(50 * time.Millisecond)
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}}
+	aliceAdmin := &user.DefaultInfo{Name: "alice", Groups: []string{"dev", "admin"}}
+
+	_, found := c.get(alice, "a_ch1")
+	assert.False(t, found)
+
+	c.set(alice, "a_ch1", true)
+	c.set(alice, "a_ch2", false)
+	allowed, found := c.get(alice, "a_ch1")
+	assert.True(t, found)
+	assert.True(t, allowed)
+	allowed, found = c.get(alice, "a_ch2")
+	assert.True(t, found)
+	assert.False(t, allowed)
+	// groups change permissions of a user
+	_, found = c.get(aliceAdmin, "a_ch1")
+	assert.False(t, found)
+
+	time.Sleep(60 * time.Millisecond)
+	_, found = c.get(alice, "a_ch1")
+	assert.False(t, found)
+}
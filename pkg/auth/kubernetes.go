@@ -34,11 +34,13 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
 	"k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/server/options"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -50,22 +52,39 @@ type KubernetesAuthor struct {
 	NetworkLister        v1beta1.NetworkLister
 	ChannelLister        v1beta1.ChannelLister
 	SkipAuthorize        bool
+	// synced tells whether caches of listers are synced
+	synced []cache.InformerSynced
+	// decisions caches networks allowed by network filters
+	decisions *decisionCache
 }
 
 var (
 	ErrNoPermission = errors.New("no permission")
+	errNotSynced    = errors.New("caches of networks and channels are not synced")
 )
 
 const (
 	// TODO valid the external request to the listener
-	ListPath       = "/networks"
-	RegisterPath   = "/network/register"
-	DeregisterPath = "/network/deregister/"
-	CommonPath     = "/networks/"
+	ListPath        = "/networks"
+	RegisterPath    = "/network/register"
+	UpdatePath      = "/network/update"
+	DeregisterPath  = "/network/deregister/"
+	PausePath       = "/network/pause/"
+	ResumePath      = "/network/resume/"
+	DeletionsPath   = "/deletions/"
+	OwnersPath      = "/owners"
+	CommonPath      = "/networks/"
+	NetworkPath     = "/network/"
+	ErrorsSuffix    = "/errors"
+	RetentionSuffix = "/retention"
+	SearchPath      = "/search"
 )
 
 func (k *KubernetesAuthor) New(ctx context.Context) (err error) {
-	restConfig := config.GetConfigOrDie()
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
 	kubeClient, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return err
@@ -94,11 +113,21 @@ func (k *KubernetesAuthor) New(ctx context.Context) (err error) {
 		if err != nil {
 			return fmt.Errorf("failed to create sar authorizer: %w", err)
 		}
-		k.NetworkLister, k.ChannelLister, err = getListers(ctx)
+		k.NetworkLister, k.ChannelLister, k.synced, err = getListers(ctx, restConfig)
+		k.decisions = newDecisionCache(decisionTTL)
 	}
 	return err
 }
 
+func (k *KubernetesAuthor) Ready(_ context.Context) error {
+	for _, synced := range k.synced {
+		if !synced() {
+			return errNotSynced
+		}
+	}
+	return nil
+}
+
 func (k *KubernetesAuthor) Authorizer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		if k.SkipAuthorize {
@@ -117,6 +146,12 @@ func (k *KubernetesAuthor) Authorizer(next http.Handler) http.Handler {
 			return
 		}
 
+		if reqURL, err := url.Parse(req.RequestURI); err == nil && reqURL.Path == SearchPath {
+			// networks searched across are filtered by the handler, each authorized the same as getting it
+			next.ServeHTTP(w, req.WithContext(withNetworkFilter(req.Context(), k.networkFilter(u))))
+			return
+		}
+
 		networkName, channelName, err := k.GetReqName(req.RequestURI)
 		if err != nil {
 			klog.V(2).Infof("parse resource get error:%v", err)
@@ -137,29 +172,7 @@ func (k *KubernetesAuthor) Authorizer(next http.Handler) http.Handler {
 			apiVerb = "delete"
 		}
 
-		attrs := []authorizer.AttributesRecord{
-			{
-				User:            u,
-				Verb:            apiVerb,
-				APIGroup:        "ibp.com",
-				APIVersion:      "v1beta1",
-				Resource:        "networks",
-				Subresource:     "",
-				Name:            networkName,
-				ResourceRequest: true,
-			},
-			{
-				User:            u,
-				Verb:            apiVerb,
-				APIGroup:        "ibp.com",
-				APIVersion:      "v1beta1",
-				Resource:        "channels",
-				Subresource:     "",
-				Name:            channelName,
-				ResourceRequest: true,
-			},
-		}
-		for _, attr := range attrs {
+		for _, attr := range resourceAttributes(u, apiVerb, networkName, channelName) {
 			authorized, reason, err := k.requestAuthorizer.Authorize(req.Context(), attr)
 			msg := fmt.Sprintf("(user=%s, verb=%s, resource=%s, subresource=%s, resourcename=%s)", u.GetName(), attr.GetVerb(), attr.GetResource(), attr.GetSubresource(), attr.GetName())
 			if err != nil {
@@ -179,6 +192,71 @@ func (k *KubernetesAuthor) Authorizer(next http.Handler) http.Handler {
 	})
 }
 
+// resourceAttributes are attributes to authorize a request to a network and its channel
+func resourceAttributes(u user.Info, verb, networkName, channelName string) []authorizer.AttributesRecord {
+	return []authorizer.AttributesRecord{
+		{
+			User:            u,
+			Verb:            verb,
+			APIGroup:        "ibp.com",
+			APIVersion:      "v1beta1",
+			Resource:        "networks",
+			Subresource:     "",
+			Name:            networkName,
+			ResourceRequest: true,
+		},
+		{
+			User:            u,
+			Verb:            verb,
+			APIGroup:        "ibp.com",
+			APIVersion:      "v1beta1",
+			Resource:        "channels",
+			Subresource:     "",
+			Name:            channelName,
+			ResourceRequest: true,
+		},
+	}
+}
+
+// networkFilter allows networks the user can get, networks or channels not found are not allowed.
+// Decisions are cached for decisionTTL, so a search doesn't send subject access reviews for every network.
+func (k *KubernetesAuthor) networkFilter(u user.Info) NetworkFilter {
+	return func(ctx context.Context, networkID string) (bool, error) {
+		if k.decisions != nil {
+			if allowed, found := k.decisions.get(u, networkID); found {
+				return allowed, nil
+			}
+		}
+		allowed, err := k.authorizeNetwork(ctx, u, networkID)
+		if err != nil {
+			return false, err
+		}
+		if k.decisions != nil {
+			k.decisions.set(u, networkID, allowed)
+		}
+		return allowed, nil
+	}
+}
+
+// authorizeNetwork tells whether the user can get the network and its channel
+func (k *KubernetesAuthor) authorizeNetwork(ctx context.Context, u user.Info, networkID string) (bool, error) {
+	networkName, channelName, err := k.resolve(CommonPath+networkID, networkID)
+	if err != nil {
+		klog.V(5).Infof("resolve network %s get error:%v", networkID, err)
+		return false, nil
+	}
+	for _, attr := range resourceAttributes(u, "get", networkName, channelName) {
+		authorized, _, err := k.requestAuthorizer.Authorize(ctx, attr)
+		if err != nil {
+			return false, err
+		}
+		if authorized != authorizer.DecisionAllow {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func (k *KubernetesAuthor) Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		klog.V(5).InfoS("try to get user")
@@ -210,39 +288,50 @@ func (k *KubernetesAuthor) GetReqName(rawURL string) (network, channelName strin
 	if u.Path == ListPath {
 		return "", "", ErrNoPermission
 	}
-	if u.Path == RegisterPath {
+	if u.Path == RegisterPath || u.Path == UpdatePath || u.Path == OwnersPath {
 		return "", "", ErrNoPermission
 	}
-	if strings.HasPrefix(u.Path, DeregisterPath) {
+	if strings.HasPrefix(u.Path, DeregisterPath) || strings.HasPrefix(u.Path, PausePath) || strings.HasPrefix(u.Path, ResumePath) || strings.HasPrefix(u.Path, DeletionsPath) {
 		return "", "", ErrNoPermission
 	}
+	if strings.HasPrefix(u.Path, NetworkPath) && strings.HasSuffix(u.Path, RetentionSuffix) {
+		return "", "", ErrNoPermission
+	}
+	if strings.HasPrefix(u.Path, NetworkPath) && strings.HasSuffix(u.Path, ErrorsSuffix) {
+		// errors of a network are visible to those who can get it
+		return k.resolve(u.Path, strings.TrimSuffix(strings.TrimPrefix(u.Path, NetworkPath), ErrorsSuffix))
+	}
 	if strings.HasPrefix(u.Path, CommonPath) {
 		t := strings.Split(strings.TrimPrefix(u.Path, CommonPath), "/")
 		if len(t) == 0 {
 			return "", "", fmt.Errorf("wrong uri:%s", u.Path)
 		}
-		networkNameChannelID := t[0]
-		networkName, channelID, found := strings.Cut(networkNameChannelID, "_")
-		if !found {
-			return "", "", fmt.Errorf("wrong uri:%s", u.Path)
-		}
-		if _, err := k.NetworkLister.Get(networkName); err != nil {
-			return "", "", err
-		}
-		list, err := k.ChannelLister.List(labels.Everything())
-		if err != nil {
-			return "", "", err
-		}
-		for _, ch := range list {
-			if ch.GetChannelID() == channelID && ch.Spec.Network == networkName {
-				return networkName, ch.GetName(), nil
-			}
-		}
-		return "", "", fmt.Errorf("from channelID:%s cant find channel", channelID)
+		return k.resolve(u.Path, t[0])
 	}
 	return
 }
 
+// resolve finds network and channel from network id `{network}_{channelID}`
+func (k *KubernetesAuthor) resolve(path, networkNameChannelID string) (network, channelName string, err error) {
+	networkName, channelID, found := strings.Cut(networkNameChannelID, "_")
+	if !found {
+		return "", "", fmt.Errorf("wrong uri:%s", path)
+	}
+	if _, err := k.NetworkLister.Get(networkName); err != nil {
+		return "", "", err
+	}
+	list, err := k.ChannelLister.List(labels.Everything())
+	if err != nil {
+		return "", "", err
+	}
+	for _, ch := range list {
+		if ch.GetChannelID() == channelID && ch.Spec.Network == networkName {
+			return networkName, ch.GetName(), nil
+		}
+	}
+	return "", "", fmt.Errorf("from channelID:%s cant find channel", channelID)
+}
+
 func (k *KubernetesAuthor) Run() fiber.Handler {
 	return adaptor.HTTPMiddleware(func(handler http.Handler) http.Handler {
 		handler = k.Authorizer(handler)
@@ -250,8 +339,8 @@ func (k *KubernetesAuthor) Run() fiber.Handler {
 	})
 }
 
-func getListers(ctx context.Context) (networkLister v1beta1.NetworkLister, channelLister v1beta1.ChannelLister, err error) {
-	restConfig := config.GetConfigOrDie()
+// getListers starts informers of networks and channels without waiting for caches synced
+func getListers(ctx context.Context, restConfig *rest.Config) (networkLister v1beta1.NetworkLister, channelLister v1beta1.ChannelLister, synced []cache.InformerSynced, err error) {
 	var vclient *versioned.Clientset
 	vclient, err = versioned.NewForConfig(restConfig)
 	if err != nil {
@@ -263,11 +352,7 @@ func getListers(ctx context.Context) (networkLister v1beta1.NetworkLister, chann
 	channelLister = channelInformer.Lister()
 	networkInformer := informerFactory.Ibp().V1beta1().Networks()
 	networkLister = networkInformer.Lister()
+	synced = []cache.InformerSynced{channelInformer.Informer().HasSynced, networkInformer.Informer().HasSynced}
 	informerFactory.Start(ctx.Done())
-	if !cache.WaitForNamedCacheSync("auth", ctx.Done(), channelInformer.Informer().HasSynced, networkInformer.Informer().HasSynced) {
-		err = fmt.Errorf("waitForCacheSync failed")
-		klog.ErrorS(err, "cannot sync caches")
-		return
-	}
 	return
 }
@@ -28,6 +28,10 @@ func (_ NoneAuthor) New(_ context.Context) error {
 	return nil
 }
 
+func (_ NoneAuthor) Ready(_ context.Context) error {
+	return nil
+}
+
 func (_ NoneAuthor) Run() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		return ctx.Next()
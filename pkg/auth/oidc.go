@@ -38,10 +38,6 @@ type OIDCAuthor struct {
 }
 
 func (o *OIDCAuthor) New(ctx context.Context) (err error) {
-	if err := o.KubernetesAuthor.New(ctx); err != nil {
-		return err
-	}
-
 	fileName := os.Getenv("OIDC_CA_FILE")
 	if fileName == "" {
 		return errors.New("no ca file")
@@ -65,7 +61,8 @@ func (o *OIDCAuthor) New(ctx context.Context) (err error) {
 		return err
 	}
 	o.oidcAuthenticator = bearertoken.New(tokenAuthenticator)
-	return err
+	// informers are started at last, so that they are not started again on retries
+	return o.KubernetesAuthor.New(ctx)
 }
 
 func (o *OIDCAuthor) Authentication(next http.Handler) http.Handler {
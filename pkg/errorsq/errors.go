@@ -16,33 +16,153 @@ limitations under the License.
 
 package errorsq
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/bestchains/bc-explorer/pkg/metrics"
+)
+
+var (
+	// queueSize is how many errors wait for logging, errors are dropped from logging once the queue is full
+	queueSize = 1000
+	// historySize is how many recent errors are kept for each network
+	historySize = 100
+)
+
+var errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "errors_total",
+	Help:      "Number of errors reported by network and stage.",
+}, []string{"network", "stage"})
+
+// Stage is where an error occurs
+type Stage string
+
+const (
+	// StageRegister is registering, updating or storing a network
+	StageRegister Stage = "register"
+	// StageListen is starting to listen a stored network
+	StageListen Stage = "listen"
+	// StageSubscribe is connecting to peers and receiving block events
+	StageSubscribe Stage = "subscribe"
+	// StageDecode is decoding a block and its transactions
+	StageDecode Stage = "decode"
+	// StageCommit is storing a decoded block
+	StageCommit Stage = "commit"
+	// StageStatus is changing status of a network
+	StageStatus Stage = "status"
+	// StageLease is acquiring or releasing the lease of a network
+	StageLease Stage = "lease"
+	// StageReconcile is reconciling networks among replicas
+	StageReconcile Stage = "reconcile"
+	// StageRetention is pruning history out of retention
+	StageRetention Stage = "retention"
+	// StageServe is serving http requests
+	StageServe Stage = "serve"
+)
+
+// Error is an error tagged with where it occurs
+type Error struct {
+	Network string
+	// BlockNumber starts from 1 as stored blocks, 0 means the error is not about a block
+	BlockNumber uint64
+	Stage       Stage
+	Err         error
+}
+
+func (e *Error) Error() string {
+	tags := make([]string, 0, 3)
+	if e.Stage != "" {
+		tags = append(tags, string(e.Stage))
+	}
+	if e.Network != "" {
+		tags = append(tags, "network "+e.Network)
+	}
+	if e.BlockNumber != 0 {
+		tags = append(tags, fmt.Sprintf("block %d", e.BlockNumber))
+	}
+	return fmt.Sprintf("[%s] %s", strings.Join(tags, " "), e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Tag tags an error with the network and stage where it occurs, nil is returned for nil error
+func Tag(err error, network string, stage Stage) error {
+	return TagBlock(err, network, 0, stage)
+}
+
+// TagBlock tags an error with the network, block and stage where it occurs, nil is returned for nil error
+func TagBlock(err error, network string, blockNumber uint64, stage Stage) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{
+		Network:     network,
+		BlockNumber: blockNumber,
+		Stage:       stage,
+		Err:         err,
+	}
+}
+
+// Entry is an error kept in history
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Network     string    `json:"network,omitempty"`
+	BlockNumber uint64    `json:"blockNumber,omitempty"`
+	Stage       Stage     `json:"stage,omitempty"`
+	Message     string    `json:"message"`
+}
 
 type Errorsq interface {
+	// Send reports an error, which never blocks
 	Send(error)
+	// History returns recent errors of a network, the latest first
+	History(network string) []Entry
+	// Forget drops history and error counts of a network, which is deregistered or deleted
+	Forget(network string)
 }
 
 type errorq struct {
 	ctx    context.Context
 	errCh  chan error
 	logger func(error)
+
+	// dropped counts errors not logged since the queue is full
+	dropped uint64
+
+	lock    sync.RWMutex
+	history map[string][]Entry
+	// stages are stages of errors counted for each network, whose series of errorsTotal are deleted once it's forgotten
+	stages map[string]map[Stage]struct{}
 }
 
 func NewErrorsq(ctx context.Context, logger func(error)) Errorsq {
 	errs := &errorq{
-		ctx:    ctx,
-		logger: logger,
-		errCh:  make(chan error, 10),
+		ctx:     ctx,
+		logger:  logger,
+		errCh:   make(chan error, queueSize),
+		history: map[string][]Entry{},
+		stages:  map[string]map[Stage]struct{}{},
 	}
 	go func() {
 		for {
 			select {
 			case <-errs.ctx.Done():
-				close(errs.errCh)
 				return
-			case err, ok := <-errs.errCh:
-				if !ok {
-					return
+			case err := <-errs.errCh:
+				if dropped := atomic.SwapUint64(&errs.dropped, 0); dropped > 0 {
+					errs.logger(fmt.Errorf("%d errors are dropped from logging since too many errors", dropped))
 				}
 				errs.logger(err)
 			}
@@ -52,5 +172,68 @@ func NewErrorsq(ctx context.Context, logger func(error)) Errorsq {
 }
 
 func (errs *errorq) Send(err error) {
-	errs.errCh <- err
+	if err == nil {
+		return
+	}
+	errs.record(err)
+	select {
+	case errs.errCh <- err:
+	default:
+		atomic.AddUint64(&errs.dropped, 1)
+	}
+}
+
+// record counts errors, and keeps errors tagged with a network in its history
+func (errs *errorq) record(err error) {
+	var tagged *Error
+	if !errors.As(err, &tagged) {
+		errorsTotal.WithLabelValues("", "").Inc()
+		return
+	}
+	if tagged.Network == "" {
+		errorsTotal.WithLabelValues("", string(tagged.Stage)).Inc()
+		return
+	}
+	entry := Entry{
+		Time:        time.Now(),
+		Network:     tagged.Network,
+		BlockNumber: tagged.BlockNumber,
+		Stage:       tagged.Stage,
+		Message:     tagged.Err.Error(),
+	}
+
+	errs.lock.Lock()
+	defer errs.lock.Unlock()
+	errorsTotal.WithLabelValues(tagged.Network, string(tagged.Stage)).Inc()
+	if errs.stages[entry.Network] == nil {
+		errs.stages[entry.Network] = map[Stage]struct{}{}
+	}
+	errs.stages[entry.Network][entry.Stage] = struct{}{}
+	entries := errs.history[entry.Network]
+	if len(entries) >= historySize {
+		copy(entries, entries[len(entries)-historySize+1:])
+		entries = entries[:historySize-1]
+	}
+	errs.history[entry.Network] = append(entries, entry)
+}
+
+func (errs *errorq) History(network string) []Entry {
+	errs.lock.RLock()
+	defer errs.lock.RUnlock()
+	entries := errs.history[network]
+	result := make([]Entry, len(entries))
+	for i, entry := range entries {
+		result[len(entries)-1-i] = entry
+	}
+	return result
+}
+
+func (errs *errorq) Forget(network string) {
+	errs.lock.Lock()
+	defer errs.lock.Unlock()
+	delete(errs.history, network)
+	for stage := range errs.stages[network] {
+		errorsTotal.DeleteLabelValues(network, string(stage))
+	}
+	delete(errs.stages, network)
 }
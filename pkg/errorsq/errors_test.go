@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errorsq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorsq(t *testing.T) {
+	historySize = 3
+	errBad := errors.New("bad block")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errq := NewErrorsq(ctx, func(error) {})
+	for i := uint64(1); i <= 5; i++ {
+		errq.Send(TagBlock(errBad, "network_channel", i, StageDecode))
+	}
+	errq.Send(Tag(errors.New("lease lost"), "other_channel", StageLease))
+	errq.Send(errors.New("untagged"))
+	errq.Send(nil)
+
+	history := errq.History("network_channel")
+	require.Len(t, history, 3)
+	for i, entry := range history {
+		assert.Equal(t, uint64(5-i), entry.BlockNumber)
+		assert.Equal(t, StageDecode, entry.Stage)
+		assert.Equal(t, "bad block", entry.Message)
+	}
+	assert.Len(t, errq.History("other_channel"), 1)
+	assert.Empty(t, errq.History("unknown_channel"))
+
+	// series of network_channel, other_channel and untagged errors
+	assert.Equal(t, 3, testutil.CollectAndCount(errorsTotal))
+	errq.Forget("other_channel")
+	assert.Empty(t, errq.History("other_channel"))
+	assert.Len(t, errq.History("network_channel"), 3)
+	assert.Equal(t, 2, testutil.CollectAndCount(errorsTotal))
+	assert.Equal(t, float64(5), testutil.ToFloat64(errorsTotal.WithLabelValues("network_channel", string(StageDecode))))
+
+	err := TagBlock(errBad, "network_channel", 1, StageDecode)
+	assert.ErrorIs(t, err, errBad)
+	assert.Equal(t, "[decode network network_channel block 1] bad block", err.Error())
+
+	// sending never blocks or panics, even if the queue is full or stopped
+	cancel()
+	for i := 0; i < queueSize*2; i++ {
+		errq.Send(Tag(fmt.Errorf("error %d", i), "network_channel", StageCommit))
+	}
+	assert.Equal(t, fmt.Sprintf("error %d", queueSize*2-1), errq.History("network_channel")[0].Message)
+}
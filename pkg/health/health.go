@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves liveness and readiness of bc-explorer services
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// HealthzPath serves liveness, which fails if the service needs a restart
+	HealthzPath = "/healthz"
+	// ReadyzPath serves readiness, which fails if the service can not serve requests for now
+	ReadyzPath = "/readyz"
+)
+
+var (
+	// checkTimeout bounds each check
+	checkTimeout = 5 * time.Second
+	// initialBackoff and maxBackoff bound the interval between retries
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Check returns an error if a dependency is unhealthy
+type Check func(ctx context.Context) error
+
+// Result is the result of all checks
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Checker runs named liveness and readiness checks
+type Checker struct {
+	lock      sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+}
+
+// AddLiveness adds a check to both liveness and readiness
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.liveness[name] = check
+}
+
+// AddReadiness adds a check to readiness only
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readiness[name] = check
+}
+
+// Healthz serves liveness
+func (c *Checker) Healthz(ctx *fiber.Ctx) error {
+	return c.serve(ctx, false)
+}
+
+// Readyz serves readiness
+func (c *Checker) Readyz(ctx *fiber.Ctx) error {
+	return c.serve(ctx, true)
+}
+
+func (c *Checker) serve(ctx *fiber.Ctx, ready bool) error {
+	result, ok := c.Run(ctx.UserContext(), ready)
+	if !ok {
+		ctx.Status(fiber.StatusServiceUnavailable)
+	}
+	return ctx.JSON(result)
+}
+
+// Run runs liveness checks, along with readiness checks if ready is true
+func (c *Checker) Run(ctx context.Context, ready bool) (Result, bool) {
+	c.lock.RLock()
+	checks := make(map[string]Check, len(c.liveness)+len(c.readiness))
+	for name, check := range c.liveness {
+		checks[name] = check
+	}
+	if ready {
+		for name, check := range c.readiness {
+			checks[name] = check
+		}
+	}
+	c.lock.RUnlock()
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := Result{Status: "ok", Checks: make(map[string]string, len(checks))}
+	ok := true
+	for _, name := range names {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := checks[name](checkCtx)
+		cancel()
+		if err != nil {
+			klog.Warningf("Health check %s failed: %s", name, err.Error())
+			result.Checks[name] = err.Error()
+			ok = false
+			continue
+		}
+		result.Checks[name] = "ok"
+	}
+	if !ok {
+		result.Status = "failed"
+	}
+	return result, ok
+}
+
+// Retry calls fn until it succeeds or ctx is done, waiting longer between attempts up to maxBackoff
+func Retry(ctx context.Context, name string, fn func() error) error {
+	backoff := initialBackoff
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		klog.Warningf("Failed to %s, retry in %s: %s", name, backoff, err.Error())
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	synced := false
+	checker := NewChecker()
+	checker.AddLiveness("listener", func(context.Context) error { return nil })
+	checker.AddReadiness("auth", func(context.Context) error {
+		if !synced {
+			return errors.New("not synced")
+		}
+		return nil
+	})
+	app := fiber.New()
+	app.Get(HealthzPath, checker.Healthz)
+	app.Get(ReadyzPath, checker.Readyz)
+
+	get := func(path string) (int, Result) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result Result
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	code, result := get(HealthzPath)
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, map[string]string{"listener": "ok"}, result.Checks)
+
+	code, result = get(ReadyzPath)
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, "failed", result.Status)
+	assert.Equal(t, "not synced", result.Checks["auth"])
+
+	synced = true
+	code, _ = get(ReadyzPath)
+	assert.Equal(t, fiber.StatusOK, code)
+}
+
+func TestRetry(t *testing.T) {
+	initialBackoff = time.Millisecond
+	maxBackoff = 2 * time.Millisecond
+
+	attempts := 0
+	err := Retry(context.Background(), "connect", func() error {
+		attempts++
+		if attempts < 4 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Retry(ctx, "connect", func() error { return errors.New("unavailable") })
+	assert.EqualError(t, err, "unavailable")
+}
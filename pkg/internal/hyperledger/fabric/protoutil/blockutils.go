@@ -0,0 +1,36 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// GetTxValidationCode returns validation code of the transaction at index, which committing peers record
+// in the transactions filter of block metadata. It's NOT_VALIDATED if the filter is missing.
+func GetTxValidationCode(block *common.Block, index int) peer.TxValidationCode {
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return peer.TxValidationCode_NOT_VALIDATED
+	}
+	filter := metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	if index >= len(filter) {
+		return peer.TxValidationCode_NOT_VALIDATED
+	}
+	return peer.TxValidationCode(filter[index])
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTxValidationCode(t *testing.T) {
+	block := &common.Block{
+		// the transactions filter is at index 2 of metadata
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{
+			nil, nil, {byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_MVCC_READ_CONFLICT)},
+		}},
+	}
+	assert.Equal(t, peer.TxValidationCode_VALID, GetTxValidationCode(block, 0))
+	assert.Equal(t, peer.TxValidationCode_MVCC_READ_CONFLICT, GetTxValidationCode(block, 1))
+	assert.Equal(t, peer.TxValidationCode_NOT_VALIDATED, GetTxValidationCode(block, 2))
+	assert.Equal(t, peer.TxValidationCode_NOT_VALIDATED, GetTxValidationCode(&common.Block{}, 0))
+}
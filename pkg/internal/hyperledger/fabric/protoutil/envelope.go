@@ -0,0 +1,297 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/rwsetutil"
+)
+
+// DecodedEnvelope is a transaction envelope with all nested messages decoded.
+// Messages are encoded in protojson, and bytes which are not messages in base64.
+type DecodedEnvelope struct {
+	ChannelHeader   json.RawMessage         `json:"channelHeader"`
+	SignatureHeader *DecodedSignatureHeader `json:"signatureHeader"`
+	Signature       []byte                  `json:"signature"`
+	// Actions are chaincode actions of an endorser transaction
+	Actions []*DecodedAction `json:"actions,omitempty"`
+	// Config is the config envelope of a config transaction
+	Config json.RawMessage `json:"config,omitempty"`
+	// ConfigUpdate is the config update envelope of a config update transaction, along with its config update
+	ConfigUpdate *DecodedConfigUpdate `json:"configUpdate,omitempty"`
+}
+
+type DecodedIdentity struct {
+	Mspid string `json:"mspid"`
+	// IdBytes is the certificate in PEM usually
+	IdBytes string `json:"idBytes"`
+}
+
+type DecodedSignatureHeader struct {
+	Creator *DecodedIdentity `json:"creator"`
+	Nonce   []byte           `json:"nonce"`
+}
+
+type DecodedConfigUpdate struct {
+	ConfigUpdate json.RawMessage `json:"configUpdate"`
+	Signatures   json.RawMessage `json:"signatures"`
+}
+
+// DecodedAction is a chaincode action, which is the proposal of a client along with the endorsed response
+type DecodedAction struct {
+	Header           *DecodedSignatureHeader  `json:"header"`
+	Proposal         *DecodedProposal         `json:"proposal"`
+	ProposalResponse *DecodedProposalResponse `json:"proposalResponse"`
+	Endorsements     []*DecodedEndorsement    `json:"endorsements"`
+}
+
+type DecodedProposal struct {
+	// Input is the chaincode invocation spec, transient data is never in transactions
+	Input json.RawMessage `json:"input"`
+}
+
+type DecodedProposalResponse struct {
+	ProposalHash []byte            `json:"proposalHash"`
+	ChaincodeID  json.RawMessage   `json:"chaincodeId"`
+	Response     json.RawMessage   `json:"response"`
+	Results      []*DecodedNsRwSet `json:"results"`
+	Events       json.RawMessage   `json:"events,omitempty"`
+}
+
+type DecodedNsRwSet struct {
+	Namespace string `json:"namespace"`
+	// Rwset is the public kv read-write set
+	Rwset                  json.RawMessage           `json:"rwset"`
+	CollectionHashedRwsets []*DecodedCollHashedRwSet `json:"collectionHashedRwsets,omitempty"`
+}
+
+type DecodedCollHashedRwSet struct {
+	CollectionName string          `json:"collectionName"`
+	HashedRwset    json.RawMessage `json:"hashedRwset"`
+	PvtRwsetHash   []byte          `json:"pvtRwsetHash"`
+}
+
+type DecodedEndorsement struct {
+	Endorser  *DecodedIdentity `json:"endorser"`
+	Signature []byte           `json:"signature"`
+}
+
+// GetTxIDFromEnvelope returns the tx id in channel header of an envelope
+func GetTxIDFromEnvelope(txEnvelopBytes []byte) (string, error) {
+	txEnvelope, err := UnmarshalEnvelope(txEnvelopBytes)
+	if err != nil {
+		return "", err
+	}
+	txPayload, err := UnmarshalPayload(txEnvelope.Payload)
+	if err != nil {
+		return "", err
+	}
+	if txPayload.Header == nil {
+		return "", errors.New("missing header in payload")
+	}
+	chdr, err := UnmarshalChannelHeader(txPayload.Header.ChannelHeader)
+	if err != nil {
+		return "", err
+	}
+	return chdr.TxId, nil
+}
+
+// DecodeEnvelope decodes a transaction envelope and all messages nested in it as bytes
+func DecodeEnvelope(txEnvelopBytes []byte) (*DecodedEnvelope, error) {
+	txEnvelope, err := UnmarshalEnvelope(txEnvelopBytes)
+	if err != nil {
+		return nil, err
+	}
+	txPayload, err := UnmarshalPayload(txEnvelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if txPayload.Header == nil {
+		return nil, errors.New("missing header in payload")
+	}
+	chdr, err := UnmarshalChannelHeader(txPayload.Header.ChannelHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "channel header")
+	}
+	sighdr, err := decodeSignatureHeader(txPayload.Header.SignatureHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "signature header")
+	}
+	decoded := &DecodedEnvelope{
+		ChannelHeader:   marshalJSON(chdr),
+		SignatureHeader: sighdr,
+		Signature:       txEnvelope.Signature,
+	}
+
+	switch chdr.Type {
+	case int32(common.HeaderType_CONFIG):
+		config, err := UnmarshalConfigEnvelope(txPayload.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "config envelope")
+		}
+		decoded.Config = marshalJSON(config)
+	case int32(common.HeaderType_CONFIG_UPDATE):
+		envelope, err := UnmarshalConfigUpdateEnvelope(txPayload.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "config update envelope")
+		}
+		configUpdate, err := UnmarshalConfigUpdate(envelope.ConfigUpdate)
+		if err != nil {
+			return nil, errors.Wrap(err, "config update")
+		}
+		decoded.ConfigUpdate = &DecodedConfigUpdate{
+			ConfigUpdate: marshalJSON(configUpdate),
+			Signatures:   marshalJSON(&common.ConfigUpdateEnvelope{Signatures: envelope.Signatures}),
+		}
+	case int32(common.HeaderType_ENDORSER_TRANSACTION):
+		tx, err := UnmarshalTransaction(txPayload.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "transaction")
+		}
+		for index, action := range tx.Actions {
+			decodedAction, err := decodeAction(action)
+			if err != nil {
+				return nil, errors.Wrapf(err, "action %d", index)
+			}
+			decoded.Actions = append(decoded.Actions, decodedAction)
+		}
+	default:
+	}
+	return decoded, nil
+}
+
+func decodeAction(action *peer.TransactionAction) (*DecodedAction, error) {
+	header, err := decodeSignatureHeader(action.Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "signature header")
+	}
+	ccPayload, err := UnmarshalChaincodeActionPayload(action.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "chaincode action payload")
+	}
+	ccProposalPayload, err := UnmarshalChaincodeProposalPayload(ccPayload.ChaincodeProposalPayload)
+	if err != nil {
+		return nil, errors.Wrap(err, "chaincode proposal payload")
+	}
+	invocationSpec, err := UnmarshalChaincodeInvocationSpec(ccProposalPayload.Input)
+	if err != nil {
+		return nil, errors.Wrap(err, "chaincode invocation spec")
+	}
+	decoded := &DecodedAction{
+		Header:   header,
+		Proposal: &DecodedProposal{Input: marshalJSON(invocationSpec)},
+	}
+	if ccPayload.Action == nil {
+		return decoded, nil
+	}
+
+	for index, endorsement := range ccPayload.Action.Endorsements {
+		endorser, err := decodeIdentity(endorsement.Endorser)
+		if err != nil {
+			return nil, errors.Wrapf(err, "endorsement %d", index)
+		}
+		decoded.Endorsements = append(decoded.Endorsements, &DecodedEndorsement{
+			Endorser:  endorser,
+			Signature: endorsement.Signature,
+		})
+	}
+
+	pRespPayload, err := UnmarshalProposalResponsePayload(ccPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, errors.Wrap(err, "proposal response payload")
+	}
+	ccAction, err := UnmarshalChaincodeAction(pRespPayload.Extension)
+	if err != nil {
+		return nil, errors.Wrap(err, "chaincode action")
+	}
+	resp := &DecodedProposalResponse{
+		ProposalHash: pRespPayload.ProposalHash,
+		ChaincodeID:  marshalJSON(ccAction.ChaincodeId),
+		Response:     marshalJSON(ccAction.Response),
+	}
+	if len(ccAction.Events) > 0 {
+		event, err := UnmarshalChaincodeEvents(ccAction.Events)
+		if err != nil {
+			return nil, errors.Wrap(err, "chaincode event")
+		}
+		resp.Events = marshalJSON(event)
+	}
+	rwset, err := UnmarshalRWSet(ccAction.Results)
+	if err != nil {
+		return nil, errors.Wrap(err, "read-write set")
+	}
+	txRWSet, err := rwsetutil.TxRwSetFromProtoMsg(rwset)
+	if err != nil {
+		return nil, errors.Wrap(err, "read-write set")
+	}
+	for _, nsRwSet := range txRWSet.NsRwSets {
+		decodedNsRwSet := &DecodedNsRwSet{
+			Namespace: nsRwSet.NameSpace,
+			Rwset:     marshalJSON(nsRwSet.KvRwSet),
+		}
+		for _, coll := range nsRwSet.CollHashedRwSets {
+			decodedNsRwSet.CollectionHashedRwsets = append(decodedNsRwSet.CollectionHashedRwsets, &DecodedCollHashedRwSet{
+				CollectionName: coll.CollectionName,
+				HashedRwset:    marshalJSON(coll.HashedRwSet),
+				PvtRwsetHash:   coll.PvtRwSetHash,
+			})
+		}
+		resp.Results = append(resp.Results, decodedNsRwSet)
+	}
+	decoded.ProposalResponse = resp
+	return decoded, nil
+}
+
+func decodeSignatureHeader(bytes []byte) (*DecodedSignatureHeader, error) {
+	sighdr, err := UnmarshalSignatureHeader(bytes)
+	if err != nil {
+		return nil, err
+	}
+	creator, err := decodeIdentity(sighdr.Creator)
+	if err != nil {
+		return nil, err
+	}
+	return &DecodedSignatureHeader{Creator: creator, Nonce: sighdr.Nonce}, nil
+}
+
+func decodeIdentity(bytes []byte) (*DecodedIdentity, error) {
+	identity, err := UnmarshalSerializedIdentity(bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "serialized identity")
+	}
+	return &DecodedIdentity{Mspid: identity.Mspid, IdBytes: string(identity.IdBytes)}, nil
+}
+
+// marshalJSON encodes a message in protojson, nil messages are null
+func marshalJSON(m proto.Message) json.RawMessage {
+	if m == nil || !m.ProtoReflect().IsValid() {
+		return json.RawMessage("null")
+	}
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		// only invalid UTF-8 in strings fails, which is kept as the error
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return data
+}
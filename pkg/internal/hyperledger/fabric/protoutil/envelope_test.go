@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func mustMarshal(t *testing.T, m proto.Message) []byte {
+	data, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return data
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	identity := func(mspid string) []byte {
+		return mustMarshal(t, &msp.SerializedIdentity{Mspid: mspid, IdBytes: []byte("-----BEGIN CERTIFICATE-----")})
+	}
+	kvRWSet := &kvrwset.KVRWSet{
+		Reads:  []*kvrwset.KVRead{{Key: "a", Version: &kvrwset.Version{BlockNum: 1, TxNum: 2}}},
+		Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}},
+	}
+	results := mustMarshal(t, &rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: "basic", Rwset: mustMarshal(t, kvRWSet)}},
+	})
+	ccAction := &peer.ChaincodeAction{
+		Results:     results,
+		Events:      mustMarshal(t, &peer.ChaincodeEvent{ChaincodeId: "basic", EventName: "Set"}),
+		Response:    &peer.Response{Status: 200},
+		ChaincodeId: &peer.ChaincodeID{Name: "basic", Version: "1"},
+	}
+	input := mustMarshal(t, &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: "basic"},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte("Set"), []byte("a"), []byte("1")}},
+	}})
+	ccActionPayload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: mustMarshal(t, &peer.ChaincodeProposalPayload{Input: input}),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: mustMarshal(t, &peer.ProposalResponsePayload{ProposalHash: []byte("hash"), Extension: mustMarshal(t, ccAction)}),
+			Endorsements:            []*peer.Endorsement{{Endorser: identity("Org2MSP"), Signature: []byte("sig")}},
+		},
+	}
+	sighdr := mustMarshal(t, &common.SignatureHeader{Creator: identity("Org1MSP"), Nonce: []byte("nonce")})
+	tx := &peer.Transaction{Actions: []*peer.TransactionAction{{Header: sighdr, Payload: mustMarshal(t, ccActionPayload)}}}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   mustMarshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: "tx1", ChannelId: "channel"}),
+			SignatureHeader: sighdr,
+		},
+		Data: mustMarshal(t, tx),
+	}
+	envelope := mustMarshal(t, &common.Envelope{Payload: mustMarshal(t, payload), Signature: []byte("sig")})
+
+	txID, err := GetTxIDFromEnvelope(envelope)
+	require.NoError(t, err)
+	assert.Equal(t, "tx1", txID)
+
+	decoded, err := DecodeEnvelope(envelope)
+	require.NoError(t, err)
+	assert.Equal(t, "Org1MSP", decoded.SignatureHeader.Creator.Mspid)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----", decoded.SignatureHeader.Creator.IdBytes)
+	require.Len(t, decoded.Actions, 1)
+	action := decoded.Actions[0]
+	require.Len(t, action.Endorsements, 1)
+	assert.Equal(t, "Org2MSP", action.Endorsements[0].Endorser.Mspid)
+	require.Len(t, action.ProposalResponse.Results, 1)
+	assert.Equal(t, "basic", action.ProposalResponse.Results[0].Namespace)
+
+	// nested messages are protojson, so the whole envelope is readable json
+	data, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "tx1", doc["channelHeader"].(map[string]interface{})["txId"])
+	assert.Equal(t, float64(common.HeaderType_ENDORSER_TRANSACTION), doc["channelHeader"].(map[string]interface{})["type"])
+	resp := doc["actions"].([]interface{})[0].(map[string]interface{})["proposalResponse"].(map[string]interface{})
+	assert.Equal(t, "Set", resp["events"].(map[string]interface{})["eventName"])
+	rws := resp["results"].([]interface{})[0].(map[string]interface{})["rwset"].(map[string]interface{})
+	assert.Equal(t, "a", rws["reads"].([]interface{})[0].(map[string]interface{})["key"])
+
+	_, err = DecodeEnvelope([]byte("invalid"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+// ParseReadVersion parses version of a read stored in models.Read, which is the prototext of kvrwset.Version.
+// It returns nil if the key did not exist when read.
+func ParseReadVersion(version string) (*kvrwset.Version, error) {
+	if version == "" || version == "<nil>" {
+		return nil, nil
+	}
+	v := &kvrwset.Version{}
+	if err := prototext.Unmarshal([]byte(version), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -99,52 +99,38 @@ func GetTransactionFromEnvelope(txEnvelopBytes []byte) (*models.Transaction, err
 	case int32(common.HeaderType_ENDORSER_TRANSACTION):
 		tx.Type = models.EndorserTransaction
 
-		invocationSpec, action, err := GetTxDetailsFromPayload(txPayload)
+		invocationSpecs, actions, err := GetTxActionsFromPayload(txPayload)
 		if err != nil {
 			return nil, err
 		}
 
-		tx.ChaincodeID = action.ChaincodeId.Name + "_" + action.ChaincodeId.Version
-		if len(invocationSpec.ChaincodeSpec.Input.Args) > 0 {
-			tx.Method = string(invocationSpec.ChaincodeSpec.Input.Args[0])
-			for _, arg := range invocationSpec.ChaincodeSpec.Input.Args[1:] {
+		// the contract called is of the first action, while events and read-write sets are of all actions
+		tx.ChaincodeID = actions[0].ChaincodeId.Name + "_" + actions[0].ChaincodeId.Version
+		if args := invocationSpecs[0].GetChaincodeSpec().GetInput().GetArgs(); len(args) > 0 {
+			tx.Method = string(args[0])
+			for _, arg := range args[1:] {
 				tx.Args = append(tx.Args, string(arg))
 			}
 		}
 
-		rwset, err := UnmarshalRWSet(action.GetResults())
-		if err != nil {
-			return nil, err
-		}
-		txRWSet, err := rwsetutil.TxRwSetFromProtoMsg(rwset)
-		if err != nil {
-			return nil, err
-		}
-
-		fabRWSets := make([]models.FabRWSet, len(txRWSet.NsRwSets))
-		for index, rwset := range txRWSet.NsRwSets {
-			fabRWSet := models.FabRWSet{
-				Namespace: rwset.NameSpace,
-			}
-			reads := make([]models.Read, 0)
-			writes := make([]models.Write, 0)
-			for _, read := range rwset.KvRwSet.Reads {
-				reads = append(reads, models.Read{
-					Key:     strings.Replace(read.GetKey(), "\u0000", "", -1),
-					Version: read.GetVersion().String(),
-				})
-			}
-			for _, write := range rwset.KvRwSet.Writes {
-				writes = append(writes, models.Write{
-					Key:      strings.Replace(write.GetKey(), "\u0000", "", -1),
-					Value:    string(write.GetValue()),
-					IsDelete: write.IsDelete,
+		fabRWSets := make([]models.FabRWSet, 0)
+		for _, action := range actions {
+			if len(action.GetEvents()) > 0 {
+				event, err := UnmarshalChaincodeEvents(action.GetEvents())
+				if err != nil {
+					return nil, err
+				}
+				tx.Events = append(tx.Events, models.ChaincodeEvent{
+					ChaincodeID: event.GetChaincodeId(),
+					EventName:   event.GetEventName(),
 				})
 			}
-			fabRWSet.Reads = reads
-			fabRWSet.Writes = writes
 
-			fabRWSets[index] = fabRWSet
+			rwsets, err := getFabRWSets(action)
+			if err != nil {
+				return nil, err
+			}
+			fabRWSets = append(fabRWSets, rwsets...)
 		}
 
 		raw, err := json.Marshal(fabRWSets)
@@ -158,8 +144,92 @@ func GetTransactionFromEnvelope(txEnvelopBytes []byte) (*models.Transaction, err
 	return tx, nil
 }
 
-// GetPayloads gets the underlying payload objects in a TransactionAction
+// getFabRWSets returns the public read-write sets of a chaincode action
+func getFabRWSets(action *peer.ChaincodeAction) ([]models.FabRWSet, error) {
+	rwset, err := UnmarshalRWSet(action.GetResults())
+	if err != nil {
+		return nil, err
+	}
+	txRWSet, err := rwsetutil.TxRwSetFromProtoMsg(rwset)
+	if err != nil {
+		return nil, err
+	}
+
+	fabRWSets := make([]models.FabRWSet, len(txRWSet.NsRwSets))
+	for index, rwset := range txRWSet.NsRwSets {
+		fabRWSet := models.FabRWSet{
+			Namespace: rwset.NameSpace,
+		}
+		reads := make([]models.Read, 0)
+		writes := make([]models.Write, 0)
+		for _, read := range rwset.KvRwSet.Reads {
+			reads = append(reads, models.Read{
+				Key:     strings.Replace(read.GetKey(), "\u0000", "", -1),
+				Version: read.GetVersion().String(),
+			})
+		}
+		for _, write := range rwset.KvRwSet.Writes {
+			writes = append(writes, models.Write{
+				Key:      strings.Replace(write.GetKey(), "\u0000", "", -1),
+				Value:    string(write.GetValue()),
+				IsDelete: write.IsDelete,
+			})
+		}
+		fabRWSet.Reads = reads
+		fabRWSet.Writes = writes
+
+		fabRWSets[index] = fabRWSet
+	}
+	return fabRWSets, nil
+}
+
+// GetTxRwSetFromEnvelope returns the tx id along with the public read-write set of a transaction.
+// The read-write set is empty if it is not an endorser transaction.
+func GetTxRwSetFromEnvelope(txEnvelopBytes []byte) (string, *rwsetutil.TxRwSet, error) {
+	txEnvelope, err := UnmarshalEnvelope(txEnvelopBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	txPayload, err := UnmarshalPayload(txEnvelope.Payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	chdr, err := UnmarshalChannelHeader(txPayload.Header.ChannelHeader)
+	if err != nil {
+		return "", nil, err
+	}
+	if chdr.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return chdr.TxId, &rwsetutil.TxRwSet{}, nil
+	}
+
+	_, action, err := GetTxDetailsFromPayload(txPayload)
+	if err != nil {
+		return "", nil, err
+	}
+	rwset, err := UnmarshalRWSet(action.GetResults())
+	if err != nil {
+		return "", nil, err
+	}
+	txRWSet, err := rwsetutil.TxRwSetFromProtoMsg(rwset)
+	if err != nil {
+		return "", nil, err
+	}
+	return chdr.TxId, txRWSet, nil
+}
+
+// GetPayloads gets the underlying payload objects in the first TransactionAction
 func GetTxDetailsFromPayload(payload *common.Payload) (*peer.ChaincodeInvocationSpec, *peer.ChaincodeAction, error) {
+	invocationSpecs, actions, err := GetTxActionsFromPayload(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return invocationSpecs[0], actions[0], nil
+}
+
+// GetTxActionsFromPayload gets the underlying payload objects of every TransactionAction, in order
+func GetTxActionsFromPayload(payload *common.Payload) ([]*peer.ChaincodeInvocationSpec, []*peer.ChaincodeAction, error) {
 	payloadTx, err := UnmarshalTransaction(payload.Data)
 	if err != nil {
 		return nil, nil, err
@@ -168,7 +238,21 @@ func GetTxDetailsFromPayload(payload *common.Payload) (*peer.ChaincodeInvocation
 		return nil, nil, errors.New("at least one TransactionAction required")
 	}
 
-	ccPayload, err := UnmarshalChaincodeActionPayload(payloadTx.Actions[0].Payload)
+	invocationSpecs := make([]*peer.ChaincodeInvocationSpec, 0, len(payloadTx.Actions))
+	actions := make([]*peer.ChaincodeAction, 0, len(payloadTx.Actions))
+	for _, txAction := range payloadTx.Actions {
+		invocationSpec, action, err := getTxActionDetails(txAction)
+		if err != nil {
+			return nil, nil, err
+		}
+		invocationSpecs = append(invocationSpecs, invocationSpec)
+		actions = append(actions, action)
+	}
+	return invocationSpecs, actions, nil
+}
+
+func getTxActionDetails(txAction *peer.TransactionAction) (*peer.ChaincodeInvocationSpec, *peer.ChaincodeAction, error) {
+	ccPayload, err := UnmarshalChaincodeActionPayload(txAction.Payload)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestGetTransactionFromEnvelope(t *testing.T) {
+	sighdr := mustMarshal(t, &common.SignatureHeader{Creator: mustMarshal(t, &msp.SerializedIdentity{Mspid: "Org1MSP"})})
+	txAction := func(chaincode, method, key, event string) *peer.TransactionAction {
+		results := mustMarshal(t, &rwset.TxReadWriteSet{
+			DataModel: rwset.TxReadWriteSet_KV,
+			NsRwset: []*rwset.NsReadWriteSet{{
+				Namespace: chaincode,
+				Rwset:     mustMarshal(t, &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: key, Value: []byte("1")}}}),
+			}},
+		})
+		ccAction := &peer.ChaincodeAction{
+			Results:     results,
+			Events:      mustMarshal(t, &peer.ChaincodeEvent{ChaincodeId: chaincode, EventName: event}),
+			ChaincodeId: &peer.ChaincodeID{Name: chaincode, Version: "1"},
+		}
+		input := mustMarshal(t, &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+			Input: &peer.ChaincodeInput{Args: [][]byte{[]byte(method), []byte(key)}},
+		}})
+		return &peer.TransactionAction{Header: sighdr, Payload: mustMarshal(t, &peer.ChaincodeActionPayload{
+			ChaincodeProposalPayload: mustMarshal(t, &peer.ChaincodeProposalPayload{Input: input}),
+			Action: &peer.ChaincodeEndorsedAction{
+				ProposalResponsePayload: mustMarshal(t, &peer.ProposalResponsePayload{Extension: mustMarshal(t, ccAction)}),
+			},
+		})}
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   mustMarshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: "tx1"}),
+			SignatureHeader: sighdr,
+		},
+		Data: mustMarshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{
+			txAction("basic", "Set", "a", "Set"),
+			txAction("token", "Mint", "b", "Minted"),
+		}}),
+	}
+	envelope := mustMarshal(t, &common.Envelope{Payload: mustMarshal(t, payload)})
+
+	tx, err := GetTransactionFromEnvelope(envelope)
+	require.NoError(t, err)
+	assert.Equal(t, "basic_1", tx.ChaincodeID)
+	assert.Equal(t, "Set", tx.Method)
+	assert.Equal(t, []string{"a"}, tx.Args)
+	// events and read-write sets of every action are kept
+	assert.Equal(t, []models.ChaincodeEvent{{ChaincodeID: "basic", EventName: "Set"}, {ChaincodeID: "token", EventName: "Minted"}}, tx.Events)
+	var rwsets []models.FabRWSet
+	require.NoError(t, json.Unmarshal(tx.Payload, &rwsets))
+	require.Len(t, rwsets, 2)
+	assert.Equal(t, "basic", rwsets[0].Namespace)
+	assert.Equal(t, "token", rwsets[1].Namespace)
+	assert.Equal(t, "b", rwsets[1].Writes[0].Key)
+}
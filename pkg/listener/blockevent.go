@@ -21,28 +21,92 @@ import (
 	"crypto/sha256"
 	"encoding/asn1"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
 	"github.com/bestchains/bc-explorer/pkg/network"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
 	"github.com/pkg/errors"
 	"google.golang.org/protobuf/proto"
 	"k8s.io/klog/v2"
 
 	"github.com/bestchains/bc-explorer/pkg/errorsq"
 	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
 )
 
 var (
-	errInvalidFabTx = errors.New("invalid fabric transaction")
+	errInvalidFabTx        = errors.New("invalid fabric transaction")
+	errPeerLagging         = errors.New("peer is lagging behind others")
+	errAllPeersUnavailable = errors.New("all peers are unavailable")
+)
+
+var (
+	// lagCheckInterval is how often listener checks current peer's height, and compares it with other peers
+	lagCheckInterval = time.Minute
+	// lagCheckTimeout is the timeout to query heights of all peers
+	lagCheckTimeout = 10 * time.Second
+	// reconnectBackoff is how long listener waits before retrying when all peers are unavailable
+	reconnectBackoff = 5 * time.Second
+	// commitBackoff is how long listener waits before retrying a block failed to inject, doubled up to maxCommitBackoff
+	commitBackoff    = time.Second
+	maxCommitBackoff = time.Minute
 )
 
 type BlockEventListener interface {
 	CheckPoint() uint64
+	// Forward moves checkpoint forward, blocks before it will be skipped
+	Forward(checkpoint uint64)
+	// Close stops listening and waits for the block in handling to be committed
 	Close()
 	Events()
+	// ActiveAt is when the listening loop was last active, which is updated at least every lagCheckInterval while running
+	ActiveAt() time.Time
+}
+
+// fabEventSource provides block events of a fabric channel, which is implemented by `client.Network`
+type fabEventSource interface {
+	BlockEvents(ctx context.Context, options ...client.BlockEventsOption) (<-chan *common.Block, error)
+	FilteredBlockEvents(ctx context.Context, options ...client.BlockEventsOption) (<-chan *peer.FilteredBlock, error)
+	BlockAndPrivateDataEvents(ctx context.Context, options ...client.BlockEventsOption) (<-chan *peer.BlockAndPrivateData, error)
+}
+
+// fabPeer is a connection to one peer of a fabric network
+type fabPeer interface {
+	fabEventSource
+	Height(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number uint64) (*common.Block, error)
+	Close()
+}
+
+// fabPeerDialer connects to a peer endpoint
+type fabPeerDialer func(endpoint network.NodeEndpoint) (fabPeer, error)
+
+// fabClientPeer serves a fabPeer with a fabric client
+type fabClientPeer struct {
+	*client.Network
+	*network.FabricClient
+}
+
+func newFabClientDialer(net *network.Network) fabPeerDialer {
+	return func(endpoint network.NodeEndpoint) (fabPeer, error) {
+		fabclient, err := network.NewFabricClientWithEndpoint(net, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return &fabClientPeer{
+			Network:      fabclient.Channel(""),
+			FabricClient: fabclient,
+		}, nil
+	}
 }
 
 type fabEventListener struct {
@@ -53,107 +117,448 @@ type fabEventListener struct {
 
 	nid string
 
-	startBlock uint64
-
-	events <-chan *common.Block
+	// checkpoint is the number of next block to handle
+	checkpoint uint64
+	// received is the number of next block to submit to pipeline, blocks before it are being decoded or committed
+	received uint64
+	pipeline *pipeline
+	// height is the latest known block height of the channel
+	height uint64
+	// activeAt is unix nano when the listening loop was last active
+	activeAt int64
+	// running tracks the Events goroutine
+	running sync.WaitGroup
+
+	// endpoints are peers to fail over between, current is the index of peer in use
+	endpoints   []network.NodeEndpoint
+	current     int
+	maxBlockLag uint64
+	dial        fabPeerDialer
+
+	lock         sync.Mutex
+	peer         fabPeer
+	streamCancel context.CancelFunc
+
+	mode           network.EventMode
+	events         <-chan *common.Block
+	filteredEvents <-chan *peer.FilteredBlock
+	pvtDataEvents  <-chan *peer.BlockAndPrivateData
+
+	// collectionAllowed checks whether private writes of a collection can be stored
+	collectionAllowed func(namespace, collection string) bool
 
 	injector Injector
+	// keepRaw is true if injector keeps original blocks
+	keepRaw bool
 }
 
-func newFabEventListener(pctx context.Context, errq errorsq.Errorsq, injector Injector, net *network.Network, startBlock uint64) (BlockEventListener, error) {
+// newFabEventListener creates a listener which connects to peers by dial
+func newFabEventListener(pctx context.Context, errq errorsq.Errorsq, injector Injector, net *network.Network, startBlock uint64, dial fabPeerDialer) (BlockEventListener, error) {
 	if errq == nil {
 		return nil, errors.New("nil errorsq")
 	}
+	return newFabEventListenerWithDialer(pctx, errq, injector, net, startBlock, dial)
+}
+
+func newFabEventListenerWithDialer(pctx context.Context, errq errorsq.Errorsq, injector Injector, net *network.Network, startBlock uint64, dial fabPeerDialer) (*fabEventListener, error) {
 	ctx, cancel := context.WithCancel(pctx)
 	listener := &fabEventListener{
-		ctx:        ctx,
-		cancel:     cancel,
-		errq:       errq,
-		nid:        net.ID,
-		injector:   injector,
-		startBlock: startBlock,
-	}
-	fabclient, err := network.NewFabricClient(net)
-	if err != nil {
+		ctx:               ctx,
+		cancel:            cancel,
+		errq:              errq,
+		nid:               net.ID,
+		injector:          injector,
+		checkpoint:        startBlock,
+		activeAt:          time.Now().UnixNano(),
+		endpoints:         net.FabProfile.PeerEndpoints(),
+		maxBlockLag:       net.FabProfile.MaxBlockLag,
+		dial:              dial,
+		mode:              net.FabProfile.EventMode,
+		collectionAllowed: net.FabProfile.CollectionAllowed,
+	}
+	_, listener.keepRaw = injector.(RawBlockInjector)
+	if err := listener.connect(0); err != nil {
 		cancel()
 		return nil, err
 	}
-	events, err := fabclient.Channel("").BlockEvents(ctx, client.WithStartBlock(startBlock))
+	return listener, nil
+}
+
+// connect tries peers in order starting from index `from`, and subscribes block events from checkpoint on the first available one
+func (listener *fabEventListener) connect(from int) error {
+	errs := make([]string, 0, len(listener.endpoints))
+	for i := 0; i < len(listener.endpoints); i++ {
+		index := (from + i) % len(listener.endpoints)
+		endpoint := listener.endpoints[index]
+		if err := listener.subscribe(endpoint); err != nil {
+			klog.Warningf("Failed to subscribe block events from peer %s for network %s: %s", endpoint.URL, listener.nid, err.Error())
+			errs = append(errs, fmt.Sprintf("%s: %s", endpoint.URL, err.Error()))
+			continue
+		}
+		listener.current = index
+		klog.Infof("Subscribed block events from peer %s for network %s at block %d", endpoint.URL, listener.nid, listener.CheckPoint())
+		return nil
+	}
+	return errors.Wrap(errAllPeersUnavailable, strings.Join(errs, "; "))
+}
+
+func (listener *fabEventListener) subscribe(endpoint network.NodeEndpoint) error {
+	conn, err := listener.dial(endpoint)
+	if err != nil {
+		return err
+	}
+
+	// each subscription has its own context, so that it can be cancelled on fail over
+	ctx, cancel := context.WithCancel(listener.ctx)
+	var events <-chan *common.Block
+	var filteredEvents <-chan *peer.FilteredBlock
+	var pvtDataEvents <-chan *peer.BlockAndPrivateData
+	startBlock := client.WithStartBlock(listener.CheckPoint())
+	switch listener.mode {
+	case network.FilteredBlockEventMode:
+		filteredEvents, err = conn.FilteredBlockEvents(ctx, startBlock)
+	case network.PrivateDataEventMode:
+		pvtDataEvents, err = conn.BlockAndPrivateDataEvents(ctx, startBlock)
+	default:
+		events, err = conn.BlockEvents(ctx, startBlock)
+	}
 	if err != nil {
 		cancel()
-		return nil, err
+		conn.Close()
+		return err
 	}
+
+	listener.closePeer()
+	listener.lock.Lock()
+	listener.peer = conn
+	listener.streamCancel = cancel
+	listener.lock.Unlock()
 	listener.events = events
-	return listener, nil
+	listener.filteredEvents = filteredEvents
+	listener.pvtDataEvents = pvtDataEvents
+	return nil
+}
+
+func (listener *fabEventListener) closePeer() {
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	if listener.streamCancel != nil {
+		listener.streamCancel()
+		listener.streamCancel = nil
+	}
+	if listener.peer != nil {
+		listener.peer.Close()
+		listener.peer = nil
+	}
 }
 
 func (listener *fabEventListener) CheckPoint() uint64 {
-	return listener.startBlock
+	return atomic.LoadUint64(&listener.checkpoint)
+}
+
+func (listener *fabEventListener) Forward(checkpoint uint64) {
+	for {
+		current := listener.CheckPoint()
+		if checkpoint <= current || atomic.CompareAndSwapUint64(&listener.checkpoint, current, checkpoint) {
+			return
+		}
+	}
+}
+
+func (listener *fabEventListener) ActiveAt() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&listener.activeAt))
+}
+
+func (listener *fabEventListener) touch() {
+	atomic.StoreInt64(&listener.activeAt, time.Now().UnixNano())
 }
 
 func (listener *fabEventListener) Close() {
 	listener.cancel()
+	// closePeer takes the lock after cancel, so Events either has been counted by running or will never run
+	listener.closePeer()
+	listener.running.Wait()
 }
 
 func (listener *fabEventListener) Events() {
+	listener.lock.Lock()
+	if listener.ctx.Err() != nil {
+		listener.lock.Unlock()
+		return
+	}
+	listener.running.Add(1)
+	listener.lock.Unlock()
+
 	klog.Infof("Start block event listening on network %s", listener.nid)
+	listener.pipeline = newPipeline(listener.ctx, decodeWorkers, decodeBuffer, listener.commit)
 	defer func() {
+		listener.closePeer()
+		listener.pipeline.close()
 		klog.Infof("Stop block event listening on network %s", listener.nid)
+		listener.running.Done()
 	}()
 	for {
-		blk, ok := <-listener.events
-		if !ok {
+		err := listener.consume()
+		if listener.ctx.Err() != nil {
 			return
 		}
-		klog.V(5).Infof("Received new block %d for network %s", blk.Header.Number+1, listener.nid)
-		if err := listener.fabBlkHandler(blk); err != nil {
-			listener.errq.Send(err)
+		endpoint := listener.endpoints[listener.current]
+		if err != nil {
+			listener.errq.Send(errorsq.Tag(errors.Wrapf(err, "peer %s", endpoint.URL), listener.nid, errorsq.StageSubscribe))
+		}
+		klog.Warningf("Block events from peer %s stopped for network %s, failing over", endpoint.URL, listener.nid)
+		// try the next peer, and wait a moment if all peers are unavailable
+		for {
+			err = listener.connect(listener.current + 1)
+			if err == nil {
+				reconnects.WithLabelValues(listener.nid).Inc()
+				break
+			}
+			listener.touch()
+			select {
+			case <-listener.ctx.Done():
+				return
+			case <-time.After(reconnectBackoff):
+			}
+			listener.errq.Send(errorsq.Tag(err, listener.nid, errorsq.StageSubscribe))
 		}
 	}
 }
 
-func (listener *fabEventListener) fabBlkHandler(block *common.Block) error {
-	var err error
+// consume handles block events from current peer until the events stop or the peer is lagging
+func (listener *fabEventListener) consume() error {
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	lagCheck := ticker.C
+	for {
+		listener.touch()
+		select {
+		case <-listener.ctx.Done():
+			return nil
+		case <-lagCheck:
+			if err := listener.checkLag(); err != nil {
+				return err
+			}
+		case blk, ok := <-listener.events:
+			if !ok {
+				return nil
+			}
+			klog.V(5).Infof("Received new block %d for network %s", blk.Header.Number+1, listener.nid)
+			listener.handleBlock(blk.Header.Number, func() (*decodedBlock, []func() error) {
+				return listener.decodeFabBlock(blk)
+			})
+		case blk, ok := <-listener.filteredEvents:
+			if !ok {
+				return nil
+			}
+			klog.V(5).Infof("Received new filtered block %d for network %s", blk.Number+1, listener.nid)
+			receivedAt := time.Now().Unix()
+			listener.handleBlock(blk.Number, func() (*decodedBlock, []func() error) {
+				return listener.decodeFabFilteredBlock(blk, receivedAt)
+			})
+		case data, ok := <-listener.pvtDataEvents:
+			if !ok {
+				return nil
+			}
+			klog.V(5).Infof("Received new block %d with private data for network %s", data.GetBlock().GetHeader().GetNumber()+1, listener.nid)
+			listener.handleBlock(data.GetBlock().GetHeader().GetNumber(), func() (*decodedBlock, []func() error) {
+				return listener.decodeFabPvtData(data)
+			})
+		}
+	}
+}
 
-	blk := &models.Block{
-		Network:           listener.nid,
-		BlockNumber:       block.Header.Number + 1, // postgresql treat 0 as null,so we start from 1
-		BlockHash:         hex.EncodeToString(blockHash(block.Header)),
-		PrevioudBlockHash: hex.EncodeToString(block.Header.PreviousHash),
-		DataHash:          hex.EncodeToString(block.Header.DataHash),
-		BlockSize:         proto.Size(block),
+// handleBlock submits a block to pipeline, and skips blocks before checkpoint or already in pipeline,
+// which might be delivered again after fail over
+func (listener *fabEventListener) handleBlock(number uint64, decode func() (*decodedBlock, []func() error)) {
+	if listener.ctx.Err() != nil {
+		return
+	}
+	if number < listener.CheckPoint() || number < listener.received {
+		klog.V(5).Infof("Skip block %d for network %s which has been handled", number+1, listener.nid)
+		return
+	}
+	decoded, tasks := decode()
+	if listener.pipeline.submit(number, decoded, tasks...) {
+		listener.received = number + 1
 	}
+}
 
-	txsData := block.Data.GetData()
-	var txs = make([]*models.Transaction, len(txsData))
-	for index, txData := range txsData {
-		tx, err := parseFabTx(listener.nid, blk.BlockNumber, txData)
-		if err != nil {
-			return errors.Wrap(errInvalidFabTx, err.Error())
+// commit injects a decoded block and moves checkpoint forward
+func (listener *fabEventListener) commit(pb *pendingBlock) {
+	// checkpoint might be forwarded while the block is decoding
+	if pb.number < listener.CheckPoint() {
+		klog.V(5).Infof("Skip block %d for network %s which has been handled", pb.number+1, listener.nid)
+		return
+	}
+	if pb.err != nil {
+		// decoding again won't help, the block is skipped
+		listener.errq.Send(errorsq.TagBlock(pb.err, listener.nid, pb.number+1, errorsq.StageDecode))
+	} else {
+		// the block is injected again until it succeeds, so checkpoint never skips a block failed to store.
+		// Following blocks wait in pipeline, and listening continues from checkpoint if it stops meanwhile.
+		backoff := commitBackoff
+		for {
+			err := listener.inject(pb.decoded)
+			if err == nil {
+				break
+			}
+			listener.errq.Send(errorsq.TagBlock(err, listener.nid, pb.number+1, errorsq.StageCommit))
+			// retrying is alive, the database failing is reported by readiness instead
+			listener.touch()
+			select {
+			case <-listener.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxCommitBackoff {
+				backoff = maxCommitBackoff
+			}
 		}
-		txs[index] = tx
+		blocksIngested.WithLabelValues(listener.nid).Inc()
+		txsIngested.WithLabelValues(listener.nid).Add(float64(len(pb.decoded.txs)))
+		ingestionLatency.WithLabelValues(listener.nid).Observe(time.Since(pb.receivedAt).Seconds())
+	}
+	listener.Forward(pb.number + 1)
+	listener.observeHeight(pb.number + 1)
+}
 
-		if blk.CreatedAt == 0 {
-			blk.CreatedAt = tx.CreatedAt
+// observeHeight updates metrics of height and lag, height only grows with blocks received between checks
+func (listener *fabEventListener) observeHeight(height uint64) {
+	for {
+		current := atomic.LoadUint64(&listener.height)
+		if height <= current || atomic.CompareAndSwapUint64(&listener.height, current, height) {
+			break
 		}
 	}
+	observeHeight(listener.nid, atomic.LoadUint64(&listener.height), listener.CheckPoint())
+}
 
-	blk.TxCount = len(txs)
-
-	if listener.injector != nil {
-		err = listener.injector.InjectBlocks(blk)
-		if err != nil {
+func (listener *fabEventListener) inject(decoded *decodedBlock) error {
+	if listener.injector == nil {
+		return nil
+	}
+	decoded.seal()
+	// raw blocks are kept first, so that data failed to inject can be rebuilt from them
+	if decoded.raw != nil {
+		if err := listener.injector.(RawBlockInjector).InjectRawBlocks(decoded.raw); err != nil {
 			return err
 		}
-		err = listener.injector.InjectTransactions(txs...)
-		if err != nil {
+	}
+	if err := listener.injector.InjectBlocks(decoded.block); err != nil {
+		return err
+	}
+	if err := listener.injector.InjectTransactions(decoded.txs...); err != nil {
+		return err
+	}
+	if len(decoded.keyWrites) > 0 {
+		if err := listener.injector.InjectKeyWrites(decoded.keyWrites...); err != nil {
 			return err
 		}
 	}
+	if len(decoded.pvtData) > 0 {
+		if err := listener.injector.InjectPrivateData(decoded.pvtData...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLag checks current peer's height, and compares it with other peers if max block lag is set
+func (listener *fabEventListener) checkLag() error {
+	ctx, cancel := context.WithTimeout(listener.ctx, lagCheckTimeout)
+	defer cancel()
 
+	listener.lock.Lock()
+	current := listener.peer
+	listener.lock.Unlock()
+	if current == nil {
+		return nil
+	}
+	height, err := current.Height(ctx)
+	if err != nil {
+		return err
+	}
+	listener.observeHeight(height)
+	if listener.maxBlockLag == 0 || len(listener.endpoints) < 2 {
+		return nil
+	}
+	for index, endpoint := range listener.endpoints {
+		if index == listener.current {
+			continue
+		}
+		other, err := listener.dial(endpoint)
+		if err != nil {
+			klog.V(5).Infof("Skip lag check with peer %s for network %s: %s", endpoint.URL, listener.nid, err.Error())
+			continue
+		}
+		otherHeight, err := other.Height(ctx)
+		other.Close()
+		if err != nil {
+			klog.V(5).Infof("Skip lag check with peer %s for network %s: %s", endpoint.URL, listener.nid, err.Error())
+			continue
+		}
+		if otherHeight > height+listener.maxBlockLag {
+			return errors.Wrapf(errPeerLagging, "height %d while peer %s at %d", height, endpoint.URL, otherHeight)
+		}
+	}
 	return nil
 }
 
+// decodeFabBlock returns a block with decoding tasks of its transactions
+func (listener *fabEventListener) decodeFabBlock(block *common.Block) (*decodedBlock, []func() error) {
+	return decodeFabBlock(listener.nid, block, listener.keepRaw)
+}
+
+// decodeFabBlock returns a block of network with decoding tasks of its transactions, and of itself if keepRaw
+func decodeFabBlock(nid string, block *common.Block, keepRaw bool) (*decodedBlock, []func() error) {
+	blk := &models.Block{
+		Network:           nid,
+		BlockNumber:       block.Header.Number + 1, // postgresql treat 0 as null,so we start from 1
+		BlockHash:         hex.EncodeToString(blockHash(block.Header)),
+		PrevioudBlockHash: hex.EncodeToString(block.Header.PreviousHash),
+		DataHash:          hex.EncodeToString(block.Header.DataHash),
+		BlockSize:         proto.Size(block),
+	}
+
+	txsData := block.Data.GetData()
+	decoded := &decodedBlock{
+		block:    blk,
+		txs:      make([]*models.Transaction, len(txsData)),
+		txWrites: make([][]*models.KeyWrite, len(txsData)),
+	}
+	tasks := make([]func() error, len(txsData), len(txsData)+1)
+	for index, txData := range txsData {
+		index, txData := index, txData
+		tasks[index] = func() error {
+			tx, err := parseFabTx(nid, blk.BlockNumber, txData)
+			if err != nil {
+				return errors.Wrap(errInvalidFabTx, err.Error())
+			}
+			tx.TxIndex = index
+			// an envelope in a block is not a processed transaction, its validation code is in block metadata
+			tx.ValidationCode = int32(protoutil.GetTxValidationCode(block, index))
+			decoded.txs[index] = tx
+			if decoded.txWrites[index], err = parseFabKeyWrites(tx); err != nil {
+				return errors.Wrap(errInvalidFabTx, err.Error())
+			}
+			return nil
+		}
+	}
+	if keepRaw {
+		tasks = append(tasks, func() error {
+			raw, err := rawstore.NewRawBlock(nid, block)
+			if err != nil {
+				return err
+			}
+			decoded.raw = raw
+			return nil
+		})
+	}
+
+	return decoded, tasks
+}
+
 func blockHash(b *common.BlockHeader) []byte {
 	sum := sha256.Sum256(blockHeaderBytes(b))
 	return sum[:]
@@ -189,3 +594,15 @@ func parseFabTx(network string, blockNumber uint64, txData []byte) (*models.Tran
 
 	return tx, nil
 }
+
+// parseFabKeyWrites returns key writes of a valid endorser transaction from its read-write sets in payload
+func parseFabKeyWrites(tx *models.Transaction) ([]*models.KeyWrite, error) {
+	if tx.Type != models.EndorserTransaction || tx.ValidationCode != 0 {
+		return nil, nil
+	}
+	var rwsets []models.FabRWSet
+	if err := json.Unmarshal(tx.Payload, &rwsets); err != nil {
+		return nil, err
+	}
+	return models.KeyWrites(tx, rwsets), nil
+}
@@ -0,0 +1,499 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/errorsq"
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+// fakePeer feeds prepared events instead of connecting to a real peer
+type fakePeer struct {
+	height    uint64
+	heightErr error
+	// ledger serves BlockByNumber
+	ledger   []*common.Block
+	blocks   chan *common.Block
+	filtered chan *peer.FilteredBlock
+	pvtData  chan *peer.BlockAndPrivateData
+}
+
+func newFakePeer(height uint64) *fakePeer {
+	return &fakePeer{
+		height:   height,
+		blocks:   make(chan *common.Block, 10),
+		filtered: make(chan *peer.FilteredBlock, 10),
+		pvtData:  make(chan *peer.BlockAndPrivateData, 10),
+	}
+}
+
+func (p *fakePeer) BlockEvents(_ context.Context, _ ...client.BlockEventsOption) (<-chan *common.Block, error) {
+	return p.blocks, nil
+}
+
+func (p *fakePeer) FilteredBlockEvents(_ context.Context, _ ...client.BlockEventsOption) (<-chan *peer.FilteredBlock, error) {
+	return p.filtered, nil
+}
+
+func (p *fakePeer) BlockAndPrivateDataEvents(_ context.Context, _ ...client.BlockEventsOption) (<-chan *peer.BlockAndPrivateData, error) {
+	return p.pvtData, nil
+}
+
+func (p *fakePeer) Height(_ context.Context) (uint64, error) {
+	return p.height, p.heightErr
+}
+
+func (p *fakePeer) BlockByNumber(_ context.Context, number uint64) (*common.Block, error) {
+	if number >= uint64(len(p.ledger)) {
+		return nil, errors.Errorf("block %d not found", number)
+	}
+	return p.ledger[number], nil
+}
+
+func (p *fakePeer) Close() {}
+
+// fakeDialer dials fake peers by endpoint url
+func fakeDialer(peers map[string]*fakePeer) fabPeerDialer {
+	return func(endpoint network.NodeEndpoint) (fabPeer, error) {
+		p, ok := peers[endpoint.URL]
+		if !ok {
+			return nil, errors.Errorf("peer %s unreachable", endpoint.URL)
+		}
+		return p, nil
+	}
+}
+
+// fakeInjector records everything injected
+type fakeInjector struct {
+	lock    sync.Mutex
+	blocks  []*models.Block
+	txs     []*models.Transaction
+	pvtData []*models.PrivateData
+	writes  []*models.KeyWrite
+	jobs    map[string]models.DeletionJob
+	// earliest and earliestPayload are recorded by Truncate
+	earliest        uint64
+	earliestPayload uint64
+}
+
+func (itr *fakeInjector) InjectNetworks(...*models.Network) error { return nil }
+func (itr *fakeInjector) DeleteNetwork(string) error              { return nil }
+
+func (itr *fakeInjector) InjectDeletionJobs(jobs ...*models.DeletionJob) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	if itr.jobs == nil {
+		itr.jobs = make(map[string]models.DeletionJob)
+	}
+	for _, job := range jobs {
+		itr.jobs[job.ID] = *job
+	}
+	return nil
+}
+func (itr *fakeInjector) SetRetention(string, *models.Retention) error { return nil }
+
+// PruneNetworkData deletes rows before block number, ignoring network
+func (itr *fakeInjector) PruneNetworkData(_ string, model interface{}, before uint64, limit int) (int, error) {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	var n int
+	switch model.(type) {
+	case *models.Block:
+		itr.blocks, n = pruneBefore(itr.blocks, func(b *models.Block) bool { return b.BlockNumber < before }, limit)
+	case *models.Transaction:
+		itr.txs, n = pruneBefore(itr.txs, func(tx *models.Transaction) bool { return tx.BlockNumber < before }, limit)
+	case *models.PrivateData:
+		itr.pvtData, n = pruneBefore(itr.pvtData, func(pd *models.PrivateData) bool { return pd.BlockNumber < before }, limit)
+	case *models.KeyWrite:
+		itr.writes, n = pruneBefore(itr.writes, func(w *models.KeyWrite) bool { return w.BlockNumber < before }, limit)
+	}
+	return n, nil
+}
+
+func pruneBefore[T any](rows []T, prune func(T) bool, limit int) ([]T, int) {
+	kept := rows[:0]
+	var n int
+	for _, row := range rows {
+		if n < limit && prune(row) {
+			n++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept, n
+}
+
+func (itr *fakeInjector) StripPayloads(_ string, before uint64, limit int) (int, error) {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	var n int
+	for _, tx := range itr.txs {
+		if n < limit && tx.BlockNumber < before && tx.Payload != nil {
+			tx.Payload = nil
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (itr *fakeInjector) Truncate(_ string, earliestBlock uint64, earliestPayloadBlock uint64) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	if earliestBlock > itr.earliest {
+		itr.earliest = earliestBlock
+	}
+	if earliestPayloadBlock > itr.earliestPayload {
+		itr.earliestPayload = earliestPayloadBlock
+	}
+	return nil
+}
+
+// DeleteNetworkData deletes rows from the head, ignoring network
+func (itr *fakeInjector) DeleteNetworkData(_ string, model interface{}, limit int) (int, error) {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	var n int
+	switch model.(type) {
+	case *models.Block:
+		n = len(itr.blocks)
+		if n > limit {
+			n = limit
+		}
+		itr.blocks = itr.blocks[n:]
+	case *models.Transaction:
+		n = len(itr.txs)
+		if n > limit {
+			n = limit
+		}
+		itr.txs = itr.txs[n:]
+	case *models.PrivateData:
+		n = len(itr.pvtData)
+		if n > limit {
+			n = limit
+		}
+		itr.pvtData = itr.pvtData[n:]
+	case *models.KeyWrite:
+		n = len(itr.writes)
+		if n > limit {
+			n = limit
+		}
+		itr.writes = itr.writes[n:]
+	}
+	return n, nil
+}
+
+func (itr *fakeInjector) InjectBlocks(blks ...*models.Block) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	itr.blocks = append(itr.blocks, blks...)
+	return nil
+}
+
+func (itr *fakeInjector) InjectTransactions(txs ...*models.Transaction) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	itr.txs = append(itr.txs, txs...)
+	return nil
+}
+
+func (itr *fakeInjector) InjectPrivateData(pvtData ...*models.PrivateData) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	itr.pvtData = append(itr.pvtData, pvtData...)
+	return nil
+}
+
+func (itr *fakeInjector) InjectKeyWrites(writes ...*models.KeyWrite) error {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	itr.writes = append(itr.writes, writes...)
+	return nil
+}
+
+func (itr *fakeInjector) Blocks() []*models.Block {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	return append([]*models.Block{}, itr.blocks...)
+}
+
+func (itr *fakeInjector) PrivateData() []*models.PrivateData {
+	itr.lock.Lock()
+	defer itr.lock.Unlock()
+	return append([]*models.PrivateData{}, itr.pvtData...)
+}
+
+type fakeErrorsq struct {
+	lock sync.Mutex
+	errs []error
+}
+
+func (q *fakeErrorsq) Send(err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.errs = append(q.errs, err)
+}
+
+func (q *fakeErrorsq) History(string) []errorsq.Entry { return nil }
+func (q *fakeErrorsq) Forget(string)                  {}
+
+func (q *fakeErrorsq) Errors() []error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return append([]error{}, q.errs...)
+}
+
+// runEvents runs listener.Events in background and returns a channel closed once it stops
+func runEvents(listener BlockEventListener) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.Events()
+	}()
+	return done
+}
+
+func newBlock(number uint64) *common.Block {
+	return &common.Block{
+		Header: &common.BlockHeader{Number: number},
+		Data:   &common.BlockData{},
+	}
+}
+
+func TestFailOverWithoutDuplication(t *testing.T) {
+	reconnectBackoff = 10 * time.Millisecond
+
+	// peer0 delivers block 0 and then becomes unreachable
+	peer0 := newFakePeer(1)
+	peer0.blocks <- newBlock(0)
+	close(peer0.blocks)
+	// peer1 delivers from block 0 again
+	peer1 := newFakePeer(2)
+	peer1.blocks <- newBlock(0)
+	peer1.blocks <- newBlock(1)
+
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:   "channel",
+			Endpoints: []network.NodeEndpoint{{URL: "peer0"}, {URL: "peer1"}},
+		},
+	}
+	injector := &fakeInjector{}
+	listener, err := newFabEventListenerWithDialer(context.Background(), &fakeErrorsq{}, injector, net, 0, fakeDialer(map[string]*fakePeer{"peer0": peer0, "peer1": peer1}))
+	require.NoError(t, err)
+
+	done := runEvents(listener)
+	require.Eventually(t, func() bool { return listener.CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+	listener.Close()
+	<-done
+
+	blocks := injector.Blocks()
+	require.Len(t, blocks, 2)
+	assert.Equal(t, uint64(1), blocks[0].BlockNumber)
+	assert.Equal(t, uint64(2), blocks[1].BlockNumber)
+}
+
+// flakyInjector fails to inject blocks while failing is set
+type flakyInjector struct {
+	*fakeInjector
+	failing atomic.Bool
+}
+
+func (itr *flakyInjector) InjectBlocks(blks ...*models.Block) error {
+	if itr.failing.Load() {
+		return errors.New("database unavailable")
+	}
+	return itr.fakeInjector.InjectBlocks(blks...)
+}
+
+func TestRetryFailedCommit(t *testing.T) {
+	commitBackoff = time.Millisecond
+	maxCommitBackoff = 5 * time.Millisecond
+
+	peer0 := newFakePeer(2)
+	peer0.blocks <- newBlock(0)
+	peer0.blocks <- newBlock(1)
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:   "channel",
+			Endpoints: []network.NodeEndpoint{{URL: "peer0"}},
+		},
+	}
+	injector := &flakyInjector{fakeInjector: &fakeInjector{}}
+	injector.failing.Store(true)
+	errq := &fakeErrorsq{}
+	listener, err := newFabEventListenerWithDialer(context.Background(), errq, injector, net, 0, fakeDialer(map[string]*fakePeer{"peer0": peer0}))
+	require.NoError(t, err)
+
+	done := runEvents(listener)
+	require.Eventually(t, func() bool { return len(errq.Errors()) >= 3 }, time.Second, time.Millisecond)
+	// checkpoint stays at the block failed to store
+	assert.Equal(t, uint64(0), listener.CheckPoint())
+	assert.Empty(t, injector.Blocks())
+	// retrying keeps the listener alive
+	activeAt := listener.ActiveAt()
+	require.Eventually(t, func() bool { return listener.ActiveAt().After(activeAt) }, time.Second, time.Millisecond)
+
+	injector.failing.Store(false)
+	require.Eventually(t, func() bool { return listener.CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+	listener.Close()
+	<-done
+
+	blocks := injector.Blocks()
+	require.Len(t, blocks, 2)
+	assert.Equal(t, uint64(1), blocks[0].BlockNumber)
+	assert.Equal(t, uint64(2), blocks[1].BlockNumber)
+}
+
+func TestFailOverWhenLagging(t *testing.T) {
+	lagCheckInterval = 10 * time.Millisecond
+
+	// peer0 is far behind peer1
+	peer0 := newFakePeer(1)
+	peer0.blocks <- newBlock(0)
+	peer1 := newFakePeer(10)
+	peer1.blocks <- newBlock(1)
+
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:     "channel",
+			Endpoints:   []network.NodeEndpoint{{URL: "peer0"}, {URL: "peer1"}},
+			MaxBlockLag: 5,
+		},
+	}
+	injector := &fakeInjector{}
+	errq := &fakeErrorsq{}
+	listener, err := newFabEventListenerWithDialer(context.Background(), errq, injector, net, 0, fakeDialer(map[string]*fakePeer{"peer0": peer0, "peer1": peer1}))
+	require.NoError(t, err)
+
+	done := runEvents(listener)
+	require.Eventually(t, func() bool { return listener.CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+	listener.Close()
+	<-done
+
+	assert.Len(t, injector.Blocks(), 2)
+	require.NotEmpty(t, errq.Errors())
+	assert.ErrorIs(t, errq.Errors()[0], errPeerLagging)
+}
+
+func TestAllPeersUnavailable(t *testing.T) {
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:   "channel",
+			Endpoints: []network.NodeEndpoint{{URL: "peer0"}, {URL: "peer1"}},
+		},
+	}
+	_, err := newFabEventListenerWithDialer(context.Background(), &fakeErrorsq{}, &fakeInjector{}, net, 0, fakeDialer(nil))
+	assert.ErrorIs(t, err, errAllPeersUnavailable)
+}
+
+func TestSwapListenerWithoutDuplication(t *testing.T) {
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:   "channel",
+			Endpoints: []network.NodeEndpoint{{URL: "peer0"}},
+		},
+	}
+	injector := &fakeInjector{}
+	oldPeer := newFakePeer(2)
+	oldPeer.blocks <- newBlock(0)
+	oldPeer.blocks <- newBlock(1)
+	oldListener, err := newFabEventListenerWithDialer(context.Background(), &fakeErrorsq{}, injector, net, 0, fakeDialer(map[string]*fakePeer{"peer0": oldPeer}))
+	require.NoError(t, err)
+	oldDone := runEvents(oldListener)
+	require.Eventually(t, func() bool { return oldListener.CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+
+	// the new listener subscribes from block 2 while the old one is still handling it
+	newPeer := newFakePeer(4)
+	newPeer.blocks <- newBlock(2)
+	newPeer.blocks <- newBlock(3)
+	newListener, err := newFabEventListenerWithDialer(context.Background(), &fakeErrorsq{}, injector, net, oldListener.CheckPoint(), fakeDialer(map[string]*fakePeer{"peer0": newPeer}))
+	require.NoError(t, err)
+	oldPeer.blocks <- newBlock(2)
+	require.Eventually(t, func() bool { return oldListener.CheckPoint() == 3 }, time.Second, 10*time.Millisecond)
+
+	oldListener.Close()
+	<-oldDone
+	newListener.Forward(oldListener.CheckPoint())
+	newDone := runEvents(newListener)
+	require.Eventually(t, func() bool { return newListener.CheckPoint() == 4 }, time.Second, 10*time.Millisecond)
+	newListener.Close()
+	<-newDone
+
+	blocks := injector.Blocks()
+	require.Len(t, blocks, 4)
+	for i, blk := range blocks {
+		assert.Equal(t, uint64(i+1), blk.BlockNumber)
+	}
+}
+
+func TestDecodeFabBlock(t *testing.T) {
+	kvRWSet := &kvrwset.KVRWSet{
+		Reads:  []*kvrwset.KVRead{{Key: "a", Version: &kvrwset.Version{BlockNum: 1}}},
+		Writes: []*kvrwset.KVWrite{{Key: "a", Value: []byte("1")}, {Key: "b", IsDelete: true}},
+	}
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 2},
+		Data: &common.BlockData{Data: [][]byte{
+			newEndorserTxWithRWSet(t, "tx1", "samplecc", kvRWSet, nil),
+			newEndorserTxWithRWSet(t, "tx2", "samplecc", kvRWSet, nil),
+		}},
+		// the transactions filter is at index 2 of metadata
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{
+			nil, nil, {byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_MVCC_READ_CONFLICT)},
+		}},
+	}
+
+	decoded, tasks := decodeFabBlock("network_channel", block, false)
+	for _, task := range tasks {
+		require.NoError(t, task())
+	}
+	decoded.seal()
+	require.Len(t, decoded.txs, 2)
+	for index, tx := range decoded.txs {
+		assert.Equal(t, index, tx.TxIndex)
+	}
+	assert.Equal(t, int32(peer.TxValidationCode_VALID), decoded.txs[0].ValidationCode)
+	assert.Equal(t, int32(peer.TxValidationCode_MVCC_READ_CONFLICT), decoded.txs[1].ValidationCode)
+
+	// only writes of the valid transaction are kept
+	require.Len(t, decoded.keyWrites, 2)
+	assert.Equal(t, &models.KeyWrite{
+		Network: "network_channel", Namespace: "samplecc", Key: "a", BlockNumber: 3, TxIndex: 0, TxID: "tx1",
+		CreatedAt: decoded.txs[0].CreatedAt, Value: []byte("1"),
+	}, decoded.keyWrites[0])
+	assert.True(t, decoded.keyWrites[1].IsDelete)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// Coordinator makes sure each network is owned by exactly one listener replica
+type Coordinator interface {
+	// Identity identifies this replica
+	Identity() string
+	// Acquire acquires or renews the lease of a network, and returns whether this replica owns it
+	Acquire(nid string) (bool, error)
+	// Release releases the lease of a network if this replica owns it
+	Release(nid string) error
+	// Leases lists all leases
+	Leases() ([]models.Lease, error)
+	// Heartbeat tells other replicas this replica is alive
+	Heartbeat() error
+	// Replicas lists replicas alive, sorted by id
+	Replicas() ([]models.Replica, error)
+}
+
+var _ Coordinator = new(pqCoordinator)
+
+// pqCoordinator keeps leases in postgreSQL, a lease can be taken over by other replicas once it expires.
+// Lease time uses the database clock, so replicas' clocks do not matter.
+type pqCoordinator struct {
+	db       *pg.DB
+	identity string
+	address  string
+	// ttl is how long a lease or a heartbeat lasts
+	ttl time.Duration
+}
+
+func NewPQCoordinator(db *pg.DB, identity string, address string, ttl time.Duration) (Coordinator, error) {
+	if err := models.Init(db); err != nil {
+		return nil, err
+	}
+	return &pqCoordinator{
+		db:       db,
+		identity: identity,
+		address:  address,
+		ttl:      ttl,
+	}, nil
+}
+
+func (pqc *pqCoordinator) Identity() string {
+	return pqc.identity
+}
+
+func (pqc *pqCoordinator) Acquire(nid string) (bool, error) {
+	res, err := pqc.db.Exec(`
+		INSERT INTO leases ("id", "holder", "expiresAt") VALUES (?, ?, now() + ?::interval)
+		ON CONFLICT ("id") DO UPDATE SET "holder" = EXCLUDED."holder", "expiresAt" = EXCLUDED."expiresAt"
+		WHERE leases."holder" = EXCLUDED."holder" OR leases."expiresAt" < now();`,
+		nid, pqc.identity, fmt.Sprintf("%d milliseconds", pqc.ttl.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	owned := res.RowsAffected() == 1
+	klog.V(5).Infof("Coordinator: %s acquires lease of network %s: %t", pqc.identity, nid, owned)
+	return owned, nil
+}
+
+func (pqc *pqCoordinator) Release(nid string) error {
+	klog.V(5).Infof("Coordinator: %s releases lease of network %s", pqc.identity, nid)
+	_, err := pqc.db.Exec(`DELETE FROM leases WHERE "id" = ? AND "holder" = ?;`, nid, pqc.identity)
+	return err
+}
+
+func (pqc *pqCoordinator) Leases() ([]models.Lease, error) {
+	var leases []models.Lease
+	err := pqc.db.Model(&leases).Order("id").Select()
+	return leases, err
+}
+
+func (pqc *pqCoordinator) Heartbeat() error {
+	_, err := pqc.db.Exec(`
+		INSERT INTO replicas ("id", "address", "heartbeatAt") VALUES (?, ?, now())
+		ON CONFLICT ("id") DO UPDATE SET "address" = EXCLUDED."address", "heartbeatAt" = EXCLUDED."heartbeatAt";`,
+		pqc.identity, pqc.address)
+	return err
+}
+
+func (pqc *pqCoordinator) Replicas() ([]models.Replica, error) {
+	var replicas []models.Replica
+	err := pqc.db.Model(&replicas).
+		Where(`"heartbeatAt" > now() - ?::interval`, fmt.Sprintf("%d milliseconds", pqc.ttl.Milliseconds())).
+		Order("id").Select()
+	return replicas, err
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	errDeletionJobNotFound = errors.New("deletion job not found")
+)
+
+var (
+	// deletionBatchSize is the max number of rows deleted by one statement
+	deletionBatchSize = 1000
+	// deletionBatchInterval is how long a deletion job sleeps between batches, so it won't lock tables for long
+	deletionBatchInterval = 100 * time.Millisecond
+	// maxFinishedDeletionJobs is the number of finished jobs kept for querying progress
+	maxFinishedDeletionJobs = 100
+)
+
+// deletionModels are deleted in order, blocks are deleted after their transactions
+var deletionModels = []interface{}{
+	(*models.RawBlock)(nil),
+	(*models.PrivateData)(nil),
+	(*models.KeyWrite)(nil),
+	(*models.Transaction)(nil),
+	(*models.Block)(nil),
+}
+
+// deleter runs deletion jobs and stores their progress by injector
+type deleter struct {
+	lock sync.Mutex
+	// jobs caches running and recently finished jobs, others are queried by selector
+	jobs map[string]*models.DeletionJob
+	// running maps network id to its running job id
+	running  map[string]string
+	finished []string
+	// workers tracks goroutines running jobs
+	workers sync.WaitGroup
+
+	injector Injector
+	selector Selector
+	// coordinator makes sure no replica is listening the network while deleting, nil if there is only one replica
+	coordinator Coordinator
+}
+
+func newDeleter(injector Injector, selector Selector, coordinator Coordinator) *deleter {
+	return &deleter{
+		jobs:        make(map[string]*models.DeletionJob),
+		running:     make(map[string]string),
+		injector:    injector,
+		selector:    selector,
+		coordinator: coordinator,
+	}
+}
+
+// start starts a deletion job of the network, or returns the running one.
+// The latest unfinished job of the network is continued, so a job interrupted by a restart keeps its id.
+// finish is called to delete the network itself once all data is deleted.
+func (d *deleter) start(ctx context.Context, nid string, finish func() error) models.DeletionJob {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if jid, ok := d.running[nid]; ok {
+		return *d.jobs[jid]
+	}
+	job, err := d.selector.NetworkDeletionJob(nid)
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		klog.Warningf("Failed to get last deletion job of network %s: %s", nid, err.Error())
+	}
+	if err == nil && job.Status != models.JobSucceeded {
+		job.Status = models.JobRunning
+		job.FinishedAt = 0
+		job.Error = ""
+		klog.Infof("Continue deletion job %s of network %s", job.ID, nid)
+	} else {
+		job = &models.DeletionJob{
+			ID:        fmt.Sprintf("%s-%d", nid, time.Now().UnixNano()),
+			Network:   nid,
+			Status:    models.JobRunning,
+			StartedAt: time.Now().Unix(),
+		}
+		klog.Infof("Start deletion job %s of network %s", job.ID, nid)
+	}
+	d.jobs[job.ID] = job
+	d.running[nid] = job.ID
+	d.save(*job)
+
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		err := d.run(ctx, job, finish)
+		d.done(job, err)
+	}()
+	return *job
+}
+
+// wait waits for running jobs to return, which stop after the batch in deleting once ctx is done
+func (d *deleter) wait() {
+	d.workers.Wait()
+}
+
+func (d *deleter) run(ctx context.Context, job *models.DeletionJob, finish func() error) error {
+	if d.coordinator != nil {
+		// wait for the owner to stop listening and release the network
+		for {
+			owned, err := d.coordinator.Acquire(job.Network)
+			if err != nil {
+				return err
+			}
+			if owned {
+				break
+			}
+			klog.V(5).Infof("Deletion job %s waits for network %s to be released", job.ID, job.Network)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(reconcileInterval):
+			}
+		}
+		defer func() {
+			if err := d.coordinator.Release(job.Network); err != nil {
+				klog.Errorf("Deletion job %s failed to release network %s: %s", job.ID, job.Network, err.Error())
+			}
+		}()
+	}
+
+	total, err := d.selector.NetworkDataCount(job.Network)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	// rows deleted before the job is interrupted are not counted again
+	job.Total = job.Deleted + total
+	snapshot := *job
+	d.lock.Unlock()
+	d.save(snapshot)
+
+	for _, model := range deletionModels {
+		for {
+			deleted, err := d.injector.DeleteNetworkData(job.Network, model, deletionBatchSize)
+			if err != nil {
+				return err
+			}
+			if deleted == 0 {
+				break
+			}
+			d.lock.Lock()
+			job.Deleted += deleted
+			snapshot := *job
+			d.lock.Unlock()
+			d.save(snapshot)
+			if d.coordinator != nil {
+				// renew the lease, a long deletion won't be taken over
+				if _, err = d.coordinator.Acquire(job.Network); err != nil {
+					return err
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(deletionBatchInterval):
+			}
+		}
+	}
+	return finish()
+}
+
+func (d *deleter) done(job *models.DeletionJob, err error) {
+	d.lock.Lock()
+	defer func() {
+		snapshot := *job
+		d.lock.Unlock()
+		d.save(snapshot)
+	}()
+
+	delete(d.running, job.Network)
+	job.FinishedAt = time.Now().Unix()
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+		klog.Errorf("Deletion job %s of network %s failed: %s", job.ID, job.Network, err.Error())
+	} else {
+		job.Status = models.JobSucceeded
+		klog.Infof("Deletion job %s of network %s succeeded, %d rows deleted", job.ID, job.Network, job.Deleted)
+	}
+
+	d.finished = append(d.finished, job.ID)
+	if len(d.finished) > maxFinishedDeletionJobs {
+		// a failed job continued again is still running
+		if evicted := d.jobs[d.finished[0]]; evicted != nil && evicted.Status != models.JobRunning {
+			delete(d.jobs, d.finished[0])
+		}
+		d.finished = d.finished[1:]
+	}
+}
+
+// save stores progress of the job. The job keeps running if it fails, only the stored progress falls behind.
+func (d *deleter) save(job models.DeletionJob) {
+	if err := d.injector.InjectDeletionJobs(&job); err != nil {
+		klog.Warningf("Failed to save deletion job %s: %s", job.ID, err.Error())
+	}
+}
+
+// get returns a snapshot of the job
+func (d *deleter) get(jid string) (models.DeletionJob, error) {
+	d.lock.Lock()
+	job, ok := d.jobs[jid]
+	var snapshot models.DeletionJob
+	if ok {
+		snapshot = *job
+	}
+	d.lock.Unlock()
+	if ok {
+		return snapshot, nil
+	}
+
+	job, err := d.selector.DeletionJob(jid)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return models.DeletionJob{}, errors.Wrap(errDeletionJobNotFound, jid)
+		}
+		return models.DeletionJob{}, err
+	}
+	return *job, nil
+}
+
+// deletionJobNetwork returns id of the network a job deletes, which prefixes the job id
+func deletionJobNetwork(jid string) string {
+	if i := strings.LastIndex(jid, "-"); i > 0 {
+		return jid[:i]
+	}
+	return jid
+}
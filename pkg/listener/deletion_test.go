@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// fakeSelector counts data and reads deletion jobs in fakeInjector
+type fakeSelector struct {
+	Selector
+	injector *fakeInjector
+}
+
+func (s *fakeSelector) NetworkDataCount(string) (int, error) {
+	s.injector.lock.Lock()
+	defer s.injector.lock.Unlock()
+	return len(s.injector.blocks) + len(s.injector.txs) + len(s.injector.pvtData), nil
+}
+
+func (s *fakeSelector) DeletionJob(jid string) (*models.DeletionJob, error) {
+	s.injector.lock.Lock()
+	defer s.injector.lock.Unlock()
+	job, ok := s.injector.jobs[jid]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &job, nil
+}
+
+func (s *fakeSelector) NetworkDeletionJob(nid string) (*models.DeletionJob, error) {
+	s.injector.lock.Lock()
+	defer s.injector.lock.Unlock()
+	var latest *models.DeletionJob
+	for _, job := range s.injector.jobs {
+		if job.Network == nid && (latest == nil || job.StartedAt > latest.StartedAt) {
+			job := job
+			latest = &job
+		}
+	}
+	if latest == nil {
+		return nil, pg.ErrNoRows
+	}
+	return latest, nil
+}
+
+func TestDeletionJob(t *testing.T) {
+	deletionBatchSize = 2
+	deletionBatchInterval = time.Millisecond
+
+	injector := &fakeInjector{}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, injector.InjectBlocks(&models.Block{}))
+		require.NoError(t, injector.InjectTransactions(&models.Transaction{}, &models.Transaction{}))
+	}
+	d := newDeleter(injector, &fakeSelector{injector: injector}, nil)
+
+	finished := make(chan struct{})
+	job := d.start(context.Background(), "network_channel", func() error {
+		close(finished)
+		return nil
+	})
+	assert.Equal(t, models.JobRunning, job.Status)
+	// a running job is returned if the network is deleted again
+	assert.Equal(t, job.ID, d.start(context.Background(), "network_channel", nil).ID)
+
+	<-finished
+	require.Eventually(t, func() bool {
+		job, err := d.get(job.ID)
+		require.NoError(t, err)
+		return job.Status == models.JobSucceeded
+	}, time.Second, 10*time.Millisecond)
+	job, _ = d.get(job.ID)
+	assert.Equal(t, 15, job.Total)
+	assert.Equal(t, 15, job.Deleted)
+	assert.Empty(t, injector.Blocks())
+
+	_, err := d.get("unknown")
+	assert.ErrorIs(t, err, errDeletionJobNotFound)
+
+	// finished jobs are stored for other replicas and restarts
+	require.Eventually(t, func() bool {
+		stored, err := newDeleter(injector, &fakeSelector{injector: injector}, nil).get(job.ID)
+		require.NoError(t, err)
+		return stored == job
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestContinueDeletionJob(t *testing.T) {
+	deletionBatchSize = 2
+	deletionBatchInterval = time.Millisecond
+
+	injector := &fakeInjector{}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, injector.InjectBlocks(&models.Block{}))
+	}
+	// the job was interrupted after deleting 4 rows
+	interrupted := &models.DeletionJob{
+		ID:         "network_channel-1",
+		Network:    "network_channel",
+		Status:     models.JobFailed,
+		Total:      7,
+		Deleted:    4,
+		StartedAt:  1,
+		FinishedAt: 2,
+		Error:      context.Canceled.Error(),
+	}
+	require.NoError(t, injector.InjectDeletionJobs(interrupted))
+	d := newDeleter(injector, &fakeSelector{injector: injector}, nil)
+
+	finished := make(chan struct{})
+	job := d.start(context.Background(), "network_channel", func() error {
+		close(finished)
+		return nil
+	})
+	assert.Equal(t, interrupted.ID, job.ID)
+	assert.Equal(t, models.JobRunning, job.Status)
+	assert.Empty(t, job.Error)
+
+	<-finished
+	require.Eventually(t, func() bool {
+		job, err := d.get(job.ID)
+		require.NoError(t, err)
+		return job.Status == models.JobSucceeded
+	}, time.Second, 10*time.Millisecond)
+	job, _ = d.get(job.ID)
+	assert.Equal(t, 7, job.Total)
+	assert.Equal(t, 7, job.Deleted)
+	// the progress is stored after the job is done
+	require.Eventually(t, func() bool {
+		stored, err := (&fakeSelector{injector: injector}).DeletionJob(job.ID)
+		require.NoError(t, err)
+		return *stored == job
+	}, time.Second, 10*time.Millisecond)
+
+	// a new job is started once the last one succeeded
+	next := d.start(context.Background(), "network_channel", func() error { return nil })
+	assert.NotEqual(t, job.ID, next.ID)
+	d.wait()
+}
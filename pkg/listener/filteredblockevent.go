@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// decodeFabFilteredBlock decodes a filtered block in place, which is cheap enough to skip workers
+func (listener *fabEventListener) decodeFabFilteredBlock(block *peer.FilteredBlock, receivedAt int64) (*decodedBlock, []func() error) {
+	blk := parseFabFilteredBlock(listener.nid, block, receivedAt)
+	txs := make([]*models.Transaction, len(block.GetFilteredTransactions()))
+	for index, ftx := range block.GetFilteredTransactions() {
+		txs[index] = parseFabFilteredTx(listener.nid, blk.BlockNumber, blk.CreatedAt, ftx)
+		txs[index].TxIndex = index
+	}
+	return &decodedBlock{block: blk, txs: txs}, nil
+}
+
+// parseFabFilteredBlock builds a block from a filtered block.
+// Filtered blocks carry no header, so a key `{network}-{blockNumber}` takes the place of block hash
+// and `createdAt` is the time when the block was received.
+func parseFabFilteredBlock(network string, block *peer.FilteredBlock, receivedAt int64) *models.Block {
+	blockNumber := block.GetNumber() + 1 // postgresql treat 0 as null,so we start from 1
+	return &models.Block{
+		Network:     network,
+		BlockNumber: blockNumber,
+		BlockHash:   fmt.Sprintf("%s-%d", network, blockNumber),
+		CreatedAt:   receivedAt,
+		TxCount:     len(block.GetFilteredTransactions()),
+		Filtered:    true,
+	}
+}
+
+func parseFabFilteredTx(network string, blockNumber uint64, receivedAt int64, ftx *peer.FilteredTransaction) *models.Transaction {
+	tx := &models.Transaction{
+		ID:             ftx.GetTxid(),
+		Network:        network,
+		BlockNumber:    blockNumber,
+		CreatedAt:      receivedAt,
+		ValidationCode: int32(ftx.GetTxValidationCode()),
+		Filtered:       true,
+	}
+
+	switch ftx.GetType() {
+	case common.HeaderType_CONFIG:
+		tx.Type = models.Config
+	case common.HeaderType_CONFIG_UPDATE:
+		tx.Type = models.ConfigUpdate
+	case common.HeaderType_ENDORSER_TRANSACTION:
+		tx.Type = models.EndorserTransaction
+	}
+
+	for _, action := range ftx.GetTransactionActions().GetChaincodeActions() {
+		event := action.GetChaincodeEvent()
+		if event == nil {
+			continue
+		}
+		// chaincode version is not available in filtered blocks
+		if tx.ChaincodeID == "" {
+			tx.ChaincodeID = event.GetChaincodeId()
+		}
+		tx.Events = append(tx.Events, models.ChaincodeEvent{
+			ChaincodeID: event.GetChaincodeId(),
+			EventName:   event.GetEventName(),
+		})
+	}
+
+	return tx
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestParseFabFilteredBlock(t *testing.T) {
+	block := &peer.FilteredBlock{
+		ChannelId: "channel",
+		Number:    4,
+		FilteredTransactions: []*peer.FilteredTransaction{
+			{
+				Txid:             "tx1",
+				Type:             common.HeaderType_ENDORSER_TRANSACTION,
+				TxValidationCode: peer.TxValidationCode_MVCC_READ_CONFLICT,
+				Data: &peer.FilteredTransaction_TransactionActions{
+					TransactionActions: &peer.FilteredTransactionActions{
+						ChaincodeActions: []*peer.FilteredChaincodeAction{
+							{ChaincodeEvent: &peer.ChaincodeEvent{ChaincodeId: "samplecc", EventName: "PutValue"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	blk := parseFabFilteredBlock("network_channel", block, 1234)
+	assert.Equal(t, uint64(5), blk.BlockNumber)
+	assert.Equal(t, "network_channel-5", blk.BlockHash)
+	assert.Equal(t, int64(1234), blk.CreatedAt)
+	assert.Equal(t, 1, blk.TxCount)
+	assert.True(t, blk.Filtered)
+
+	tx := parseFabFilteredTx("network_channel", blk.BlockNumber, blk.CreatedAt, block.FilteredTransactions[0])
+	assert.Equal(t, "tx1", tx.ID)
+	assert.Equal(t, models.EndorserTransaction, tx.Type)
+	assert.Equal(t, int32(peer.TxValidationCode_MVCC_READ_CONFLICT), tx.ValidationCode)
+	assert.Equal(t, "samplecc", tx.ChaincodeID)
+	assert.Equal(t, []models.ChaincodeEvent{{ChaincodeID: "samplecc", EventName: "PutValue"}}, tx.Events)
+	assert.True(t, tx.Filtered)
+}
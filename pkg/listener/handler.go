@@ -21,8 +21,10 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/bestchains/bc-explorer/pkg/models"
 	"github.com/bestchains/bc-explorer/pkg/network"
 	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -30,18 +32,20 @@ var (
 )
 
 type Handler struct {
-	listener Listener
+	listener   Listener
+	forwarding Forwarding
 }
 
-func NewHandler(listener Listener) *Handler {
+func NewHandler(listener Listener, forwarding Forwarding) *Handler {
 	handler := &Handler{
-		listener: listener,
+		listener:   listener,
+		forwarding: forwarding,
 	}
 	return handler
 }
 
 func (handler *Handler) List(c *fiber.Ctx) error {
-	nets, err := handler.listener.Selector().Networks("id", "type", "platform", "status")
+	nets, err := handler.listener.Selector().Networks("id", "type", "platform", "status", `"earliestBlockNumber"`, `"earliestPayloadBlockNumber"`, "retention")
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
@@ -56,32 +60,224 @@ func (handler *Handler) Register(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s: %s", errInvalidNetwork.Error(), err.Error()))
 	}
 
-	err = handler.listener.Register(net)
+	opts := RegisterOptions{
+		DryRun: c.QueryBool("dryRun"),
+		Start: Start{
+			Position:  StartPosition(c.Query("start")),
+			Block:     uint64(c.QueryInt("startBlock", 0)),
+			Timestamp: int64(c.QueryInt("startTime", 0)),
+		},
+	}
+	if err = opts.Start.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if forwarded, err := handler.forward(c, networkID(net)); forwarded {
+		return err
+	}
+
+	report, err := handler.listener.Register(net, opts)
 	if err != nil {
+		if errors.Is(err, errPreflightFailed) {
+			return c.Status(fiber.StatusBadRequest).JSON(report)
+		}
+		if errors.Is(err, errInvalidStartPosition) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, errInvalidStatus) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(report)
+}
+
+func (handler *Handler) Update(c *fiber.Ctx) error {
+	var err error
+	net := new(network.Network)
+	err = c.BodyParser(net)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s: %s", errInvalidNetwork.Error(), err.Error()))
+	}
+
+	if forwarded, err := handler.forward(c, networkID(net)); forwarded {
+		return err
+	}
+
+	report, err := handler.listener.Update(net)
+	if err != nil {
+		if errors.Is(err, errNetworkNotListening) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if errors.Is(err, errPreflightFailed) {
+			return c.Status(fiber.StatusBadRequest).JSON(report)
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(report)
+}
+
+// forward sends the request to the replica which the network is assigned to, and returns whether it is forwarded.
+// The request is handled locally if the owner is unreachable, or if it can't be forwarded safely.
+// A request forwarded by another replica is handled locally only if its signature is valid.
+func (handler *Handler) forward(c *fiber.Ctx, nid string) (bool, error) {
+	if by := c.Get(ForwardedHeader); by != "" {
+		if err := verifyForward(handler.forwarding.Secret, c.Get(ForwardSignatureHeader), by, c.Method(), c.OriginalURL(), c.Body()); err != nil {
+			return true, fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		return false, nil
+	}
+	if len(handler.forwarding.Secret) == 0 {
+		return false, nil
+	}
+	owner, self := handler.listener.Owner(nid)
+	if self {
+		return false, nil
+	}
+	header := map[string]string{}
+	for _, key := range []string{fiber.HeaderAuthorization, fiber.HeaderContentType} {
+		if value := c.Get(key); value != "" {
+			header[key] = value
+		}
+	}
+	status, contentType, body, err := forward(handler.forwarding, owner, handler.listener.Identity(), c.Method(), c.OriginalURL(), header, c.Body())
+	if err != nil {
+		klog.Warningf("Handle request of network %s locally: %s", nid, err.Error())
+		return false, nil
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return true, c.Status(status).Send(body)
 }
 
 func (handler *Handler) Deregister(c *fiber.Ctx) error {
 	nid := c.Params("nid")
+	if forwarded, err := handler.forward(c, nid); forwarded {
+		return err
+	}
 
 	err := handler.listener.Deregister(nid)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		return fiber.NewError(statusCode(err), err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (handler *Handler) Pause(c *fiber.Ctx) error {
+	nid := c.Params("nid")
+	if forwarded, err := handler.forward(c, nid); forwarded {
+		return err
+	}
+
+	err := handler.listener.Pause(nid)
+	if err != nil {
+		return fiber.NewError(statusCode(err), err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (handler *Handler) Resume(c *fiber.Ctx) error {
+	nid := c.Params("nid")
+	if forwarded, err := handler.forward(c, nid); forwarded {
+		return err
+	}
+
+	err := handler.listener.Resume(nid)
+	if err != nil {
+		return fiber.NewError(statusCode(err), err.Error())
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// statusCode maps errors about network status to http status code
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, errNetworkNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, errInvalidStatus):
+		return fiber.StatusConflict
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
+
 func (handler *Handler) Delete(c *fiber.Ctx) error {
 	nid := c.Params("nid")
+	// the owner stops listening at once and runs the deletion job, so its progress can be queried from it
+	if forwarded, err := handler.forward(c, nid); forwarded {
+		return err
+	}
 
-	err := handler.listener.Delete(nid)
+	job, err := handler.listener.Delete(nid)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		return fiber.NewError(statusCode(err), err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// Errors lists recent errors of a network, which are kept by the replica listening it
+func (handler *Handler) Errors(c *fiber.Ctx) error {
+	nid := c.Params("nid")
+	if forwarded, err := handler.forward(c, nid); forwarded {
+		return err
+	}
+
+	entries, err := handler.listener.Errors(nid)
+	if err != nil {
+		return fiber.NewError(statusCode(err), err.Error())
+	}
+
+	return c.JSON(entries)
+}
+
+// SetRetention sets retention of a network, an empty body keeps all history
+func (handler *Handler) SetRetention(c *fiber.Ctx) error {
+	nid := c.Params("nid")
+	var retention *models.Retention
+	if len(c.Body()) > 0 {
+		retention = new(models.Retention)
+		if err := c.BodyParser(retention); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s: %s", models.ErrInvalidRetention.Error(), err.Error()))
+		}
+	}
+
+	err := handler.listener.SetRetention(nid, retention)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRetention) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return fiber.NewError(statusCode(err), err.Error())
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+func (handler *Handler) DeletionJob(c *fiber.Ctx) error {
+	jid := c.Params("jid")
+	// the owner runs the job and knows its latest progress, others read the stored one if it is unreachable
+	if forwarded, err := handler.forward(c, deletionJobNetwork(jid)); forwarded {
+		return err
+	}
+
+	job, err := handler.listener.DeletionJob(jid)
+	if err != nil {
+		if errors.Is(err, errDeletionJobNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(job)
+}
+
+func (handler *Handler) Owners(c *fiber.Ctx) error {
+	owners, err := handler.listener.Owners()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(owners)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errListenerBusy = errors.New("listener is busy for too long")
+	errStalled      = errors.New("listener goroutines stalled")
+)
+
+var (
+	// stallTimeout is how long a goroutine can stay inactive before the listener is considered unhealthy
+	stallTimeout = 5 * time.Minute
+)
+
+func (l *listener) Check(ctx context.Context) error {
+	// the lock might be held by a stuck operation, so it's acquired in background
+	activeAt := make(chan map[string]time.Time, 1)
+	go func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		snapshot := make(map[string]time.Time, len(l.networks))
+		for nid, blkListener := range l.networks {
+			snapshot[nid] = blkListener.ActiveAt()
+		}
+		activeAt <- snapshot
+	}()
+
+	var snapshot map[string]time.Time
+	select {
+	case <-ctx.Done():
+		return errListenerBusy
+	case snapshot = <-activeAt:
+	}
+
+	stalled := make([]string, 0)
+	for nid, at := range snapshot {
+		if time.Since(at) > stallTimeout {
+			stalled = append(stalled, "network "+nid)
+		}
+	}
+	if l.coordinator != nil && time.Since(time.Unix(0, atomic.LoadInt64(&l.reconciledAt))) > stallTimeout {
+		stalled = append(stalled, "reconcile")
+	}
+	if len(stalled) > 0 {
+		sort.Strings(stalled)
+		return errors.Wrap(errStalled, strings.Join(stalled, ", "))
+	}
+	return nil
+}
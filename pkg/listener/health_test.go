@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	active := &fabEventListener{activeAt: time.Now().UnixNano()}
+	stalled := &fabEventListener{activeAt: time.Now().Add(-2 * stallTimeout).UnixNano()}
+	l := &listener{
+		networks: map[string]BlockEventListener{"active_channel": active},
+	}
+	assert.NoError(t, l.Check(context.Background()))
+
+	l.networks["stalled_channel"] = stalled
+	err := l.Check(context.Background())
+	assert.ErrorIs(t, err, errStalled)
+	assert.Contains(t, err.Error(), "network stalled_channel")
+	assert.NotContains(t, err.Error(), "active_channel")
+
+	// a stuck operation holding the lock
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Check(ctx), errListenerBusy)
+}
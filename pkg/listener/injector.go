@@ -17,7 +17,11 @@ limitations under the License.
 package listener
 
 import (
+	"context"
+	"time"
+
 	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
 	"github.com/go-pg/pg/v10"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
@@ -25,9 +29,35 @@ import (
 
 type Injector interface {
 	InjectNetworks(...*models.Network) error
+	// InjectBlocks, InjectTransactions, InjectPrivateData and InjectKeyWrites skip rows already stored,
+	// so a block failed halfway can be injected again
 	InjectBlocks(...*models.Block) error
 	InjectTransactions(...*models.Transaction) error
+	InjectPrivateData(...*models.PrivateData) error
+	InjectKeyWrites(...*models.KeyWrite) error
+	// InjectDeletionJobs creates deletion jobs or updates their progress
+	InjectDeletionJobs(...*models.DeletionJob) error
+	// DeleteNetworkData deletes at most limit rows of a network's data in table of model, and returns how many rows are deleted
+	DeleteNetworkData(nid string, model interface{}, limit int) (int, error)
+	// DeleteNetwork deletes the network itself, its data should be deleted by DeleteNetworkData first
 	DeleteNetwork(string) error
+	// SetRetention sets retention of a network, nil keeps all history
+	SetRetention(nid string, retention *models.Retention) error
+	// PruneNetworkData deletes at most limit rows of a network's data in table of model before block number,
+	// and returns how many rows are deleted
+	PruneNetworkData(nid string, model interface{}, before uint64, limit int) (int, error)
+	// StripPayloads drops payloads, arguments and events of at most limit transactions of a network before block number,
+	// and returns how many transactions are stripped
+	StripPayloads(nid string, before uint64, limit int) (int, error)
+	// Truncate records history of a network is truncated before earliestBlock, and payloads before earliestPayloadBlock.
+	// Zero leaves it unchanged, and neither goes backwards.
+	Truncate(nid string, earliestBlock uint64, earliestPayloadBlock uint64) error
+}
+
+// RawBlockInjector is an Injector which also keeps original blocks, so that derived data can be rebuilt from them
+type RawBlockInjector interface {
+	Injector
+	InjectRawBlocks(...*models.RawBlock) error
 }
 
 var _ Injector = new(logInjector)
@@ -48,11 +78,43 @@ func (litr *logInjector) InjectNetworks(nets ...*models.Network) error {
 	}
 	return nil
 }
+func (litr *logInjector) InjectDeletionJobs(jobs ...*models.DeletionJob) error {
+	for _, job := range jobs {
+		litr.logger("Inject deletion job:%s network:%s status:%s deleted:%d/%d", job.ID, job.Network, job.Status, job.Deleted, job.Total)
+	}
+	return nil
+}
+
+func (litr *logInjector) DeleteNetworkData(nid string, model interface{}, limit int) (int, error) {
+	litr.logger("Delete network:%s data:%T limit:%d", nid, model, limit)
+	return 0, nil
+}
+
 func (litr *logInjector) DeleteNetwork(nid string) error {
 	litr.logger("Delete network:%s", nid)
 	return nil
 }
 
+func (litr *logInjector) SetRetention(nid string, retention *models.Retention) error {
+	litr.logger("Set network:%s retention:%+v", nid, retention)
+	return nil
+}
+
+func (litr *logInjector) PruneNetworkData(nid string, model interface{}, before uint64, limit int) (int, error) {
+	litr.logger("Prune network:%s data:%T before:%d limit:%d", nid, model, before, limit)
+	return 0, nil
+}
+
+func (litr *logInjector) StripPayloads(nid string, before uint64, limit int) (int, error) {
+	litr.logger("Strip network:%s payloads before:%d limit:%d", nid, before, limit)
+	return 0, nil
+}
+
+func (litr *logInjector) Truncate(nid string, earliestBlock uint64, earliestPayloadBlock uint64) error {
+	litr.logger("Truncate network:%s earliest block:%d earliest payload block:%d", nid, earliestBlock, earliestPayloadBlock)
+	return nil
+}
+
 func (litr *logInjector) InjectBlocks(blks ...*models.Block) error {
 	for _, blk := range blks {
 		litr.logger("Inject block:%d network:%s", blk.BlockNumber, blk.Network)
@@ -67,13 +129,46 @@ func (litr *logInjector) InjectTransactions(txs ...*models.Transaction) error {
 	return nil
 }
 
-func NewPQInjector(db *pg.DB) (Injector, error) {
+func (litr *logInjector) InjectPrivateData(pvtData ...*models.PrivateData) error {
+	for _, pd := range pvtData {
+		litr.logger("Inject private data tx:%s collection:%s/%s network:%s", pd.TxID, pd.Namespace, pd.Collection, pd.Network)
+	}
+	return nil
+}
+
+func (litr *logInjector) InjectKeyWrites(writes ...*models.KeyWrite) error {
+	for _, w := range writes {
+		litr.logger("Inject key write tx:%s key:%s/%s network:%s", w.TxID, w.Namespace, w.Key, w.Network)
+	}
+	return nil
+}
+
+// NewPQInjector creates an injector of postgreSQL.
+// Blocks and transactions are partitioned by network and time ranges of partitionInterval if it's positive,
+// and original blocks are kept in raw if it's not nil.
+func NewPQInjector(db *pg.DB, partitionInterval time.Duration, raw rawstore.Store) (Injector, error) {
 	if err := models.Init(db); err != nil {
 		return nil, err
 	}
-	return &pqInjector{
+	pqitr := &pqInjector{
 		db: db,
-	}, nil
+	}
+	if partitionInterval > 0 {
+		if err := models.EnablePartitioning(context.Background(), db, partitionInterval); err != nil {
+			return nil, err
+		}
+		pqitr.partitions = newPartitioner(db, partitionInterval)
+		pqitr.partitioned = true
+	} else if partitioned, err := models.Partitioned(context.Background(), db); err != nil {
+		return nil, err
+	} else if partitioned {
+		klog.Warningln("PQInjector: tables are partitioned but partition interval is not set, new rows are kept in default partitions")
+		pqitr.partitioned = true
+	}
+	if raw != nil {
+		return &rawPQInjector{pqInjector: pqitr, raw: raw}, nil
+	}
+	return pqitr, nil
 }
 
 var _ Injector = new(pqInjector)
@@ -81,12 +176,32 @@ var _ Injector = new(pqInjector)
 // pqInjector used to inject data into postgreSQL
 type pqInjector struct {
 	db *pg.DB
+	// partitions is nil if partition interval is not set
+	partitions *partitioner
+	// partitioned tells whether blocks and transactions are partitioned, so they are kept unique by their keys
+	partitioned bool
+}
+
+// partitioner returns the partitioner creating partitions before injecting rows, nil if partition interval is not set
+func (pqitr *pqInjector) partitioner() *partitioner {
+	return pqitr.partitions
+}
+
+// ensurePartitions creates partitions for a row before injecting it.
+// Rows are still stored in default partitions if it fails, so the error is only logged.
+func (pqitr *pqInjector) ensurePartitions(nid string, createdAt int64) {
+	if pqitr.partitions == nil {
+		return
+	}
+	if err := pqitr.partitions.ensure(context.Background(), nid, createdAt); err != nil {
+		klog.Warningf("PQInjector: failed to create partitions of network %s at %d: %s", nid, createdAt, err.Error())
+	}
 }
 
 func (pqitr *pqInjector) InjectNetworks(nets ...*models.Network) error {
 	for _, net := range nets {
 		klog.V(5).Infof("PQInjector: inject network %s", net.ID)
-		_, err := pqitr.db.Model(net).OnConflict("(id) DO UPDATE").Set("status = EXCLUDED.status, profile = EXCLUDED.profile").Insert()
+		_, err := pqitr.db.Model(net).OnConflict("(id) DO UPDATE").Set(`status = EXCLUDED.status, profile = EXCLUDED.profile, "earliestBlockNumber" = COALESCE(EXCLUDED."earliestBlockNumber", network."earliestBlockNumber")`).Insert()
 		if err != nil {
 			return err
 		}
@@ -94,25 +209,103 @@ func (pqitr *pqInjector) InjectNetworks(nets ...*models.Network) error {
 	return nil
 }
 
+func (pqitr *pqInjector) InjectDeletionJobs(jobs ...*models.DeletionJob) error {
+	for _, job := range jobs {
+		klog.V(5).Infof("PQInjector: inject deletion job %s", job.ID)
+		_, err := pqitr.db.Model(job).OnConflict("(id) DO UPDATE").Set(`status = EXCLUDED.status, total = EXCLUDED.total, deleted = EXCLUDED.deleted, "finishedAt" = EXCLUDED."finishedAt", error = EXCLUDED.error`).Insert()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pqitr *pqInjector) DeleteNetworkData(nid string, model interface{}, limit int) (int, error) {
+	klog.V(5).Infof("PQInjector: delete at most %d rows of %T in network %s", limit, model, nid)
+	if pqitr.partitioned {
+		if n, deleted, err := models.DeletePartitioned(context.Background(), pqitr.db, model, `"network" = ? LIMIT ?`, nid, limit); deleted {
+			return n, errors.Wrapf(err, "delete network's %T", model)
+		}
+	}
+	res, err := pqitr.db.Model(model).
+		// ctid is unique only in a partition, so it's paired with tableoid for partitioned tables
+		Where(`(tableoid, ctid) IN (SELECT tableoid, ctid FROM ?TableName WHERE "network" = ? LIMIT ?)`, nid, limit).
+		Delete()
+	if err != nil {
+		return 0, errors.Wrapf(err, "delete network's %T", model)
+	}
+	return res.RowsAffected(), nil
+}
+
 func (pqitr *pqInjector) DeleteNetwork(nid string) error {
 	klog.Infof("PQInjector: delete network %s", nid)
 	net := &models.Network{
 		ID: nid,
 	}
-	// delete network
 	_, err := pqitr.db.Model(net).WherePK().ForceDelete()
 	if err != nil {
 		return errors.Wrap(err, "delete network")
 	}
-	// delete all blocks
-	_, err = pqitr.db.Model(&models.Block{}).Where(`"network" = ?`, nid).Delete()
+	if pqitr.partitions != nil {
+		if err := pqitr.partitions.drop(context.Background(), nid); err != nil {
+			return errors.Wrap(err, "drop partitions of network")
+		}
+	}
+	return nil
+}
+
+func (pqitr *pqInjector) SetRetention(nid string, retention *models.Retention) error {
+	klog.Infof("PQInjector: set retention of network %s to %+v", nid, retention)
+	_, err := pqitr.db.Model(&models.Network{ID: nid, Retention: retention}).Column("retention").WherePK().Update()
 	if err != nil {
-		return errors.Wrap(err, "delete network's blocks")
+		return errors.Wrap(err, "set retention")
 	}
-	// delete all txs
-	_, err = pqitr.db.Model(&models.Transaction{}).Where(`"network" = ?`, nid).Delete()
+	return nil
+}
+
+func (pqitr *pqInjector) PruneNetworkData(nid string, model interface{}, before uint64, limit int) (int, error) {
+	klog.V(5).Infof("PQInjector: prune at most %d rows of %T before block %d in network %s", limit, model, before, nid)
+	if pqitr.partitioned {
+		if n, deleted, err := models.DeletePartitioned(context.Background(), pqitr.db, model, `"network" = ? AND "blockNumber" < ? LIMIT ?`, nid, before, limit); deleted {
+			return n, errors.Wrapf(err, "prune network's %T", model)
+		}
+	}
+	res, err := pqitr.db.Model(model).
+		Where(`(tableoid, ctid) IN (SELECT tableoid, ctid FROM ?TableName WHERE "network" = ? AND "blockNumber" < ? LIMIT ?)`, nid, before, limit).
+		Delete()
 	if err != nil {
-		return errors.Wrap(err, "delete network's transactions")
+		return 0, errors.Wrapf(err, "prune network's %T", model)
+	}
+	return res.RowsAffected(), nil
+}
+
+func (pqitr *pqInjector) StripPayloads(nid string, before uint64, limit int) (int, error) {
+	klog.V(5).Infof("PQInjector: strip payloads of at most %d transactions before block %d in network %s", limit, before, nid)
+	res, err := pqitr.db.Model((*models.Transaction)(nil)).
+		Set(`"payload" = NULL, "args" = NULL, "events" = NULL`).
+		Where(`(tableoid, ctid) IN (SELECT tableoid, ctid FROM ?TableName WHERE "network" = ? AND "blockNumber" < ? AND "payload" IS NOT NULL LIMIT ?)`, nid, before, limit).
+		Update()
+	if err != nil {
+		return 0, errors.Wrap(err, "strip network's payloads")
+	}
+	return res.RowsAffected(), nil
+}
+
+func (pqitr *pqInjector) Truncate(nid string, earliestBlock uint64, earliestPayloadBlock uint64) error {
+	klog.V(5).Infof("PQInjector: truncate network %s before block %d, payloads before block %d", nid, earliestBlock, earliestPayloadBlock)
+	if earliestBlock == 0 && earliestPayloadBlock == 0 {
+		return nil
+	}
+	q := pqitr.db.Model((*models.Network)(nil)).Where(`"id" = ?`, nid)
+	if earliestBlock > 0 {
+		q = q.Set(`"earliestBlockNumber" = GREATEST("earliestBlockNumber", ?)`, earliestBlock)
+	}
+	if earliestPayloadBlock > 0 {
+		q = q.Set(`"earliestPayloadBlockNumber" = GREATEST("earliestPayloadBlockNumber", ?)`, earliestPayloadBlock)
+	}
+	_, err := q.Update()
+	if err != nil {
+		return errors.Wrap(err, "truncate network")
 	}
 	return nil
 }
@@ -120,7 +313,13 @@ func (pqitr *pqInjector) DeleteNetwork(nid string) error {
 func (pqitr *pqInjector) InjectBlocks(blks ...*models.Block) error {
 	for _, blk := range blks {
 		klog.V(5).Infof("PQInjector: inject block %d %s", blk.BlockNumber, blk.BlockHash)
-		_, err := pqitr.db.Model(blk).Insert()
+		pqitr.ensurePartitions(blk.Network, blk.CreatedAt)
+		var err error
+		if pqitr.partitioned {
+			err = models.InsertPartitioned(context.Background(), pqitr.db, blk, &models.BlockKey{Network: blk.Network, BlockNumber: blk.BlockNumber})
+		} else {
+			_, err = pqitr.db.Model(blk).OnConflict("DO NOTHING").Insert()
+		}
 		if err != nil {
 			return err
 		}
@@ -131,10 +330,71 @@ func (pqitr *pqInjector) InjectBlocks(blks ...*models.Block) error {
 func (pqitr *pqInjector) InjectTransactions(txs ...*models.Transaction) error {
 	for _, tx := range txs {
 		klog.V(5).Infof("PQInjector: inject transaction %s", tx.ID)
-		_, err := pqitr.db.Model(tx).Insert()
+		pqitr.ensurePartitions(tx.Network, tx.CreatedAt)
+		var err error
+		if pqitr.partitioned {
+			err = models.InsertPartitioned(context.Background(), pqitr.db, tx, &models.TransactionKey{Network: tx.Network, ID: tx.ID})
+		} else {
+			_, err = pqitr.db.Model(tx).OnConflict("DO NOTHING").Insert()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pqitr *pqInjector) InjectPrivateData(pvtData ...*models.PrivateData) error {
+	for _, pd := range pvtData {
+		klog.V(5).Infof("PQInjector: inject private data %s", pd.ID)
+		_, err := pqitr.db.Model(pd).OnConflict("DO NOTHING").Insert()
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func (pqitr *pqInjector) InjectKeyWrites(writes ...*models.KeyWrite) error {
+	klog.V(5).Infof("PQInjector: inject %d key writes", len(writes))
+	_, err := pqitr.db.Model(&writes).OnConflict("DO NOTHING").Insert()
+	return err
+}
+
+var _ RawBlockInjector = new(rawPQInjector)
+
+// rawPQInjector is a pqInjector keeping original blocks in a raw block store
+type rawPQInjector struct {
+	*pqInjector
+	raw rawstore.Store
+}
+
+func (pqitr *rawPQInjector) InjectRawBlocks(blks ...*models.RawBlock) error {
+	for _, blk := range blks {
+		klog.V(5).Infof("PQInjector: inject raw block %d %s", blk.BlockNumber, blk.Hash)
+		if err := pqitr.raw.Put(context.Background(), blk); err != nil {
+			return errors.Wrap(err, "store raw block")
+		}
+	}
+	return nil
+}
+
+// DeleteNetworkData deletes raw blocks from the raw block store, which might not be a table
+func (pqitr *rawPQInjector) DeleteNetworkData(nid string, model interface{}, limit int) (int, error) {
+	if _, ok := model.(*models.RawBlock); ok {
+		return pqitr.PruneNetworkData(nid, model, rawstore.AllBlocks, limit)
+	}
+	return pqitr.pqInjector.DeleteNetworkData(nid, model, limit)
+}
+
+func (pqitr *rawPQInjector) PruneNetworkData(nid string, model interface{}, before uint64, limit int) (int, error) {
+	if _, ok := model.(*models.RawBlock); ok {
+		klog.V(5).Infof("PQInjector: prune at most %d raw blocks before block %d in network %s", limit, before, nid)
+		n, err := pqitr.raw.Prune(context.Background(), nid, before, limit)
+		if err != nil {
+			return n, errors.Wrap(err, "prune network's raw blocks")
+		}
+		return n, nil
+	}
+	return pqitr.pqInjector.PruneNetworkData(nid, model, before, limit)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// testDSNEnv is the postgreSQL tests run against, tests using it are skipped if it's not set.
+// The database is partitioned by tests, so it should be dedicated to them.
+const testDSNEnv = "BC_EXPLORER_TEST_DSN"
+
+func TestInjectFilteredBlockTwiceIntoPartitionedTables(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("env %s is not set", testDSNEnv)
+	}
+	opts, err := pg.ParseURL(dsn)
+	require.NoError(t, err)
+	db := pg.Connect(opts)
+	t.Cleanup(func() { db.Close() })
+	day := 24 * time.Hour
+	injector, err := NewPQInjector(db, day, nil)
+	require.NoError(t, err)
+
+	network := fmt.Sprintf("filtered_%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = models.DropPartitions(context.Background(), db, network) })
+	count := func(model interface{}) int {
+		n, err := db.Model(model).Where(`"network" = ?`, network).Count()
+		require.NoError(t, err)
+		return n
+	}
+	block := &peer.FilteredBlock{
+		Number:               4,
+		FilteredTransactions: []*peer.FilteredTransaction{{Txid: network + "-tx1", Type: common.HeaderType_ENDORSER_TRANSACTION}},
+	}
+	inject := func(receivedAt int64) {
+		blk := parseFabFilteredBlock(network, block, receivedAt)
+		require.NoError(t, injector.InjectBlocks(blk))
+		require.NoError(t, injector.InjectTransactions(parseFabFilteredTx(network, blk.BlockNumber, receivedAt, block.FilteredTransactions[0])))
+	}
+
+	// the block is delivered again a day later after reconnecting, so its createdAt falls in another partition
+	now := time.Now()
+	inject(now.Unix())
+	inject(now.Add(day).Unix())
+	assert.Equal(t, 1, count((*models.Block)(nil)))
+	assert.Equal(t, 1, count((*models.Transaction)(nil)))
+
+	// keys are deleted along with rows, so the block is stored again, e.g. when rebuilding
+	n, err := injector.DeleteNetworkData(network, (*models.Block)(nil), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = injector.DeleteNetworkData(network, (*models.Transaction)(nil), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	inject(now.Unix())
+	assert.Equal(t, 1, count((*models.Block)(nil)))
+	assert.Equal(t, 1, count((*models.Transaction)(nil)))
+}
@@ -21,10 +21,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/bestchains/bc-explorer/pkg/errorsq"
 	"github.com/bestchains/bc-explorer/pkg/models"
 	"github.com/bestchains/bc-explorer/pkg/network"
+	"github.com/bestchains/bc-explorer/pkg/secret"
+	"github.com/go-pg/pg/v10"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 )
@@ -35,84 +38,171 @@ var (
 	errNetworkTypeUnknown    = errors.New("unknown network type")
 	errInvalidNetworkProfile = errors.New("invalid network profile")
 	errNetworkAlreadyExists  = errors.New("network with this id already exists in this listener")
+	errNetworkNotListening   = errors.New("network is not being listened")
+	errNetworkNotFound       = errors.New("network not found")
+	errInvalidStatus         = errors.New("operation not allowed at current network status")
 )
 
 type Listener interface {
 	Selector() Selector
-	Register(*network.Network) error
+	Register(*network.Network, RegisterOptions) (*PreflightReport, error)
+	Update(*network.Network) (*PreflightReport, error)
 	Deregister(string) error
-	Delete(string) error
+	Pause(string) error
+	Resume(string) error
+	// Delete stops listening a network, and deletes it along with all data in background
+	Delete(string) (models.DeletionJob, error)
+	DeletionJob(jid string) (models.DeletionJob, error)
+	// Owners tells which replica listens each network
+	Owners() ([]Ownership, error)
+	// Owner returns the replica a network is assigned to, and whether it's this replica
+	Owner(nid string) (models.Replica, bool)
+	// Identity identifies this replica
+	Identity() string
+	// Errors returns recent errors of a network reported by this replica, the latest first
+	Errors(nid string) ([]errorsq.Entry, error)
+	// SetRetention sets retention of a network, nil keeps all history
+	SetRetention(nid string, retention *models.Retention) error
+	// Check returns an error if any goroutine of the listener stalls
+	Check(ctx context.Context) error
+	// Close stops listening all networks after blocks in committing are stored, and waits for background jobs to stop
+	Close()
+}
+
+// RegisterOptions controls how a network is registered
+type RegisterOptions struct {
+	// DryRun only runs preflight checks without registering the network
+	DryRun bool
+	// Start is where a new network starts to be listened
+	Start Start
 }
 
 type listener struct {
-	lock sync.Mutex
-	ctx  context.Context
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	errq errorsq.Errorsq
 
 	injector Injector
 	selector Selector
+	// cipher encrypts network profiles before they are stored
+	cipher secret.Cipher
+	// dialer connects to peers of a network in preflight
+	dialer func(*network.Network) fabPeerDialer
 
 	networks map[string]BlockEventListener
+	// profiles are stored profiles of networks being listened, to find out profiles updated by other replicas
+	profiles map[string][]byte
+	deleter  *deleter
+
+	// identity identifies this replica
+	identity string
+	// coordinator is nil unless running with multiple replicas
+	coordinator Coordinator
+	// replicas are alive replicas found by the last reconcile, networks are sharded among them
+	replicas []models.Replica
+	// reconciledAt is unix nano when the last reconcile finished
+	reconciledAt int64
+	// retaining tracks the goroutine pruning history out of retention
+	retaining sync.WaitGroup
 }
 
-func NewListener(ctx context.Context, errq errorsq.Errorsq, injector Injector, selector Selector) (Listener, error) {
-	if errq == nil || injector == nil || selector == nil {
+// NewListener creates a listener. With a coordinator, networks are listened only if this replica owns them.
+func NewListener(ctx context.Context, errq errorsq.Errorsq, injector Injector, selector Selector, cipher secret.Cipher, identity string, coordinator Coordinator) (Listener, error) {
+	if errq == nil || injector == nil || selector == nil || cipher == nil {
 		return nil, errListenerMissingField
 	}
+	ctx, cancel := context.WithCancel(ctx)
 	l := &listener{
-		lock:     sync.Mutex{},
-		ctx:      ctx,
-		errq:     errq,
-		injector: injector,
-		selector: selector,
-		networks: map[string]BlockEventListener{},
+		lock:        sync.Mutex{},
+		ctx:         ctx,
+		cancel:      cancel,
+		errq:        errq,
+		injector:    injector,
+		selector:    selector,
+		cipher:      cipher,
+		dialer:      newFabClientDialer,
+		networks:    map[string]BlockEventListener{},
+		profiles:    map[string][]byte{},
+		deleter:     newDeleter(injector, selector, coordinator),
+		identity:    identity,
+		coordinator: coordinator,
 	}
 
 	nets, err := selector.Networks()
 	if err != nil {
+		cancel()
 		return nil, errors.Wrap(errListNetworks, err.Error())
 	}
 	klog.Infof("Pre-register %d networks", len(nets))
 	for _, net := range nets {
+		if err = l.rotateProfile(&net); err != nil {
+			errq.Send(errorsq.Tag(err, net.ID, errorsq.StageListen))
+		}
+		if net.Status == models.Deleting {
+			// continue the deletion interrupted by last shutdown, reconcile does it for the assigned replica if there are many
+			if coordinator == nil {
+				l.deleter.start(ctx, net.ID, l.finishDeletion(net.ID))
+			}
+			continue
+		}
 		if net.Status != models.Registered {
 			klog.V(5).Infof("Skip pre-register network %s which at status %s", net.ID, net.Status)
 			continue
 		}
-		err = l.preRegister(&net)
+		if coordinator != nil {
+			// networks are listened once their leases are acquired by reconcile
+			continue
+		}
+		err = l.listen(&net)
 		if err != nil {
-			errq.Send(errors.Wrap(err, ""))
+			errq.Send(errorsq.Tag(err, net.ID, errorsq.StageListen))
 			continue
 		}
 	}
 
+	if coordinator != nil {
+		l.reconciledAt = time.Now().UnixNano()
+		go l.runReconcile()
+	}
+	l.retaining.Add(1)
+	go l.runRetention()
+
 	return l, nil
 }
 
-func (l *listener) preRegister(net *models.Network) error {
-	klog.Infof("Pre-register network %s", net.ID)
+// listen starts listening a stored network from its last stored block, or its earliest block if no block stored
+func (l *listener) listen(net *models.Network) error {
+	klog.Infof("Start listening network %s", net.ID)
 
 	n := &network.Network{
 		ID:       net.ID,
 		Platform: network.Platform(net.Platform),
 	}
 
-	var err error
 	var blkListener BlockEventListener
 
 	switch net.Type {
 	case string(network.FABRIC):
 		var fabProfile = new(network.FabProfile)
-		err = json.Unmarshal(net.Profile, fabProfile)
+		profile, err := l.cipher.Decrypt(net.Profile)
+		if err != nil {
+			return errors.Wrap(errInvalidNetworkProfile, err.Error())
+		}
+		err = json.Unmarshal(profile, fabProfile)
 		if err != nil {
 			return errors.Wrap(errInvalidNetworkProfile, err.Error())
 		}
 		n.FabProfile = fabProfile
-		startBlock, err := l.selector.NetworkStartAt(n.ID)
+		startBlock, err := l.startAt(n.ID)
 		if err != nil {
-			l.errq.Send(err)
+			l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageListen))
 		}
-		blkListener, err = newFabEventListener(l.ctx, l.errq, l.injector, n, startBlock)
+		if startBlock == 0 && net.EarliestBlockNumber > 0 {
+			startBlock = net.EarliestBlockNumber - 1
+		}
+		blkListener, err = newFabEventListener(l.ctx, l.errq, l.injector, n, startBlock, l.dialer(n))
 		if err != nil {
 			return err
 		}
@@ -122,47 +212,197 @@ func (l *listener) preRegister(net *models.Network) error {
 
 	go blkListener.Events()
 	l.networks[n.ID] = blkListener
+	l.profiles[n.ID] = net.Profile
 
 	return nil
 }
 
+// closeListener stops listening a network
+func (l *listener) closeListener(nid string) {
+	blkListener, ok := l.networks[nid]
+	if ok {
+		blkListener.Close()
+		delete(l.networks, nid)
+		delete(l.profiles, nid)
+		forgetMetrics(nid)
+	}
+}
+
+// own tries to own a network, which always succeeds without a coordinator
+func (l *listener) own(nid string) bool {
+	if l.coordinator == nil {
+		return true
+	}
+	owned, err := l.coordinator.Acquire(nid)
+	if err != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(err, "acquire lease"), nid, errorsq.StageLease))
+		return false
+	}
+	return owned
+}
+
+// rotateProfile encrypts the stored profile again when it is in plaintext or encrypted by a retired key
+func (l *listener) rotateProfile(net *models.Network) error {
+	if !l.cipher.NeedsRotation(net.Profile) {
+		return nil
+	}
+	klog.Infof("Rotating encryption key of network %s's profile", net.ID)
+	profile, err := l.cipher.Decrypt(net.Profile)
+	if err != nil {
+		return errors.Wrap(errInvalidNetworkProfile, err.Error())
+	}
+	profile, err = l.cipher.Encrypt(profile)
+	if err != nil {
+		return err
+	}
+	net.Profile = profile
+	return l.injector.InjectNetworks(net)
+}
+
 func (l *listener) Selector() Selector {
 	return l.selector
 }
 
-func (l *listener) Register(n *network.Network) error {
+// Register starts listening a network after preflight passed. If the network is being listened, it works as Update.
+func (l *listener) Register(n *network.Network, opts RegisterOptions) (*PreflightReport, error) {
+	setNetworkID(n)
+	report := preflight(l.ctx, n, l.dialer(n))
+	if !report.Passed {
+		return report, errors.Wrap(errPreflightFailed, report.Error())
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, listening := l.networks[n.ID]
+	if !listening && !l.own(n.ID) {
+		// the owner replica restarts listening with the new profile by reconcile
+		klog.Infof("Network %s is owned by another replica, store it only", n.ID)
+		return report, l.store(n)
+	}
+	if err := l.register(n, opts.Start); err != nil {
+		if !listening {
+			// the lease taken for listening is released, so that the assigned replica isn't blocked until it expires
+			l.release(n.ID)
+		}
+		return report, err
+	}
+	return report, nil
+}
+
+// Update replaces profile of a network which is being listened, and continues from its checkpoint
+func (l *listener) Update(n *network.Network) (*PreflightReport, error) {
+	setNetworkID(n)
+	if !l.updatable(n.ID) {
+		return nil, errors.Wrap(errNetworkNotListening, n.ID)
+	}
+	report := preflight(l.ctx, n, l.dialer(n))
+	if !report.Passed {
+		return report, errors.Wrap(errPreflightFailed, report.Error())
+	}
+
 	l.lock.Lock()
 	defer l.lock.Unlock()
+	if _, ok := l.networks[n.ID]; !ok {
+		if !l.updatable(n.ID) {
+			return nil, errors.Wrap(errNetworkNotListening, n.ID)
+		}
+		// the owner replica restarts listening with the new profile by reconcile
+		return report, l.store(n)
+	}
+	return report, l.register(n, Start{})
+}
 
-	// Use {network}_{channel} to identity a blockchain uniquely
+// updatable checks whether a network is being listened by this replica or, with a coordinator, any replica
+func (l *listener) updatable(nid string) bool {
+	l.lock.Lock()
+	_, ok := l.networks[nid]
+	l.lock.Unlock()
+	if ok || l.coordinator == nil {
+		return ok
+	}
+	net, err := l.selector.Network(nid)
+	return err == nil && net.Status == models.Registered
+}
+
+// setNetworkID uses {network}_{channel} to identity a blockchain uniquely
+func setNetworkID(n *network.Network) {
+	n.ID = networkID(n)
+}
+
+func networkID(n *network.Network) string {
 	if n.Type() == network.FABRIC && n.FabProfile.Channel != "" {
-		n.ID = fmt.Sprintf("%s_%s", n.ID, n.FabProfile.Channel)
+		return fmt.Sprintf("%s_%s", n.ID, n.FabProfile.Channel)
 	}
+	return n.ID
+}
 
+func (l *listener) register(n *network.Network, start Start) error {
 	var blkListener BlockEventListener
 	var err error
 
+	if net, err := l.selector.Network(n.ID); err == nil && net.Status == models.Deleting {
+		return errors.Wrapf(errInvalidStatus, "network %s is %s", n.ID, net.Status)
+	}
+
+	oldListener, listening := l.networks[n.ID]
+	var startBlock uint64
+	// earliestBlock is recorded only when the network starts without stored blocks
+	var earliestBlock uint64
+	if listening {
+		startBlock = oldListener.CheckPoint()
+	} else {
+		startBlock, err = l.startAt(n.ID)
+		if err != nil {
+			l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
+			return err
+		}
+		if startBlock == 0 && n.Type() == network.FABRIC {
+			startBlock, err = start.resolve(l.ctx, n.FabProfile.PeerEndpoints(), l.dialer(n))
+			if err != nil {
+				l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
+				return err
+			}
+			earliestBlock = startBlock + 1
+		} else if start.Position != "" {
+			klog.Warningf("Ignore start position %s of network %s which continues from stored block %d", start.Position, n.ID, startBlock)
+		}
+	}
+
 	var profile = make([]byte, 0)
 	switch n.Type() {
 	case network.FABRIC:
-		klog.Infof("Registering a new fabric network: %s", n.ID)
-		profile, err = json.Marshal(n.FabProfile)
+		if listening {
+			klog.Infof("Updating fabric network %s from block %d", n.ID, startBlock)
+		} else {
+			klog.Infof("Registering a new fabric network %s from block %d", n.ID, startBlock)
+		}
+		profile, err = l.encryptProfile(n)
 		if err != nil {
-			l.errq.Send(err)
+			l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
 			return err
 		}
-		blkListener, err = newFabEventListener(l.ctx, l.errq, l.injector, n, 0)
+		// the previous listener keeps running if the new profile fails to connect
+		blkListener, err = newFabEventListener(l.ctx, l.errq, l.injector, n, startBlock, l.dialer(n))
 	default:
 		return errNetworkTypeUnknown
 	}
 
 	if err != nil {
-		l.errq.Send(err)
+		l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
 		return err
 	}
 
+	if listening {
+		// blocks handled by the previous listener after startBlock will be skipped
+		oldListener.Close()
+		blkListener.Forward(oldListener.CheckPoint())
+	}
 	go blkListener.Events()
 	l.networks[n.ID] = blkListener
+	l.profiles[n.ID] = profile
 
 	if l.injector != nil {
 		err = l.injector.InjectNetworks(&models.Network{
@@ -171,9 +411,11 @@ func (l *listener) Register(n *network.Network) error {
 			Type:     string(n.Type()),
 			Profile:  profile,
 			Status:   models.Registered,
+
+			EarliestBlockNumber: earliestBlock,
 		})
 		if err != nil {
-			l.errq.Send(err)
+			l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
 			return err
 		}
 	}
@@ -181,56 +423,235 @@ func (l *listener) Register(n *network.Network) error {
 	return nil
 }
 
+// store only stores the network with status `Registered`
+func (l *listener) store(n *network.Network) error {
+	if net, err := l.selector.Network(n.ID); err == nil && net.Status == models.Deleting {
+		return errors.Wrapf(errInvalidStatus, "network %s is %s", n.ID, net.Status)
+	}
+	if n.Type() != network.FABRIC {
+		return errNetworkTypeUnknown
+	}
+	profile, err := l.encryptProfile(n)
+	if err != nil {
+		l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
+		return err
+	}
+	err = l.injector.InjectNetworks(&models.Network{
+		ID:       n.ID,
+		Platform: string(n.Platform),
+		Type:     string(n.Type()),
+		Profile:  profile,
+		Status:   models.Registered,
+	})
+	if err != nil {
+		l.errq.Send(errorsq.Tag(err, n.ID, errorsq.StageRegister))
+	}
+	return err
+}
+
+func (l *listener) encryptProfile(n *network.Network) ([]byte, error) {
+	profile, err := json.Marshal(n.FabProfile)
+	if err != nil {
+		return nil, err
+	}
+	return l.cipher.Encrypt(profile)
+}
+
+// startAt returns the next block to listen, which is 0 if no block has been stored
+func (l *listener) startAt(nid string) (uint64, error) {
+	startBlock, err := l.selector.NetworkStartAt(nid)
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return 0, err
+	}
+	return startBlock, nil
+}
+
+// Deregister stops listening a network and sets its status to `Deregistered`
 func (l *listener) Deregister(nid string) error {
+	klog.Infof("Deregistering network: %s", nid)
+	if err := l.stop(nid, models.Deregistered, models.Registered, models.Paused); err != nil {
+		return err
+	}
+	l.errq.Forget(nid)
+	return nil
+}
+
+// Pause stops listening a network and sets its status to `Paused`, which can be resumed later
+func (l *listener) Pause(nid string) error {
+	klog.Infof("Pausing network: %s", nid)
+	return l.stop(nid, models.Paused, models.Registered)
+}
+
+// stop stops listening a network, and changes its status to `to` if it is at one of status `from`
+func (l *listener) stop(nid string, to models.Status, from ...models.Status) error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	klog.Infof("Deregistering network: %s", nid)
 
-	// change network's status to `Deregistered`
 	if l.injector != nil && l.selector != nil {
 		// do stats update
-		net, err := l.selector.Network(nid)
+		net, err := l.network(nid)
 		if err != nil {
-			l.errq.Send(err)
+			l.errq.Send(errorsq.Tag(err, nid, errorsq.StageStatus))
 			return err
 		}
-		if net.Status == models.Registered {
-			net.Status = models.Deregistered
+		if net.Status != to {
+			allowed := false
+			for _, status := range from {
+				allowed = allowed || net.Status == status
+			}
+			if !allowed {
+				return errors.Wrapf(errInvalidStatus, "network %s is %s", nid, net.Status)
+			}
+			net.Status = to
 			err = l.injector.InjectNetworks(net)
 			if err != nil {
-				l.errq.Send(err)
+				l.errq.Send(errorsq.Tag(err, nid, errorsq.StageStatus))
 				return err
 			}
 		}
 	}
 
-	blkListener, ok := l.networks[nid]
-	if ok {
-		blkListener.Close()
-		delete(l.networks, nid)
+	if _, ok := l.networks[nid]; ok {
+		l.closeListener(nid)
+		l.release(nid)
 	}
 
 	return nil
 }
 
-func (l *listener) Delete(nid string) error {
+// release releases the lease of a network if there is a coordinator
+func (l *listener) release(nid string) {
+	if l.coordinator == nil {
+		return
+	}
+	if err := l.coordinator.Release(nid); err != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(err, "release lease"), nid, errorsq.StageLease))
+	}
+}
+
+// Resume restarts listening a paused or deregistered network from its last stored block
+func (l *listener) Resume(nid string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	klog.Infof("Resuming network: %s", nid)
+
+	net, err := l.network(nid)
+	if err != nil {
+		return err
+	}
+	if net.Status == models.Deleting {
+		return errors.Wrapf(errInvalidStatus, "network %s is %s", nid, net.Status)
+	}
+	if _, ok := l.networks[nid]; !ok && l.own(nid) {
+		if err = l.listen(net); err != nil {
+			l.errq.Send(errorsq.Tag(err, nid, errorsq.StageListen))
+			l.release(nid)
+			return err
+		}
+	}
+	if net.Status != models.Registered {
+		net.Status = models.Registered
+		if err = l.injector.InjectNetworks(net); err != nil {
+			l.errq.Send(errorsq.Tag(err, nid, errorsq.StageStatus))
+			return err
+		}
+	}
+	return nil
+}
+
+// network gets a stored network, errNetworkNotFound is returned if it does not exist
+func (l *listener) network(nid string) (*models.Network, error) {
+	net, err := l.selector.Network(nid)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, errors.Wrap(errNetworkNotFound, nid)
+		}
+		return nil, err
+	}
+	return net, nil
+}
+
+func (l *listener) Delete(nid string) (models.DeletionJob, error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	klog.Infof("Deleting network: %s", nid)
 
-	if l.injector != nil {
-		err := l.injector.DeleteNetwork(nid)
-		if err != nil {
-			l.errq.Send(err)
+	net, err := l.network(nid)
+	if err != nil {
+		return models.DeletionJob{}, err
+	}
+
+	if _, ok := l.networks[nid]; ok {
+		l.closeListener(nid)
+		l.release(nid)
+	}
+
+	// network at status `Deleting` can not be registered or resumed until the deletion finishes
+	if net.Status != models.Deleting {
+		net.Status = models.Deleting
+		if err = l.injector.InjectNetworks(net); err != nil {
+			l.errq.Send(errorsq.Tag(err, nid, errorsq.StageStatus))
+			return models.DeletionJob{}, err
+		}
+	}
+
+	return l.deleter.start(l.ctx, nid, l.finishDeletion(nid)), nil
+}
+
+// finishDeletion deletes the network itself after all its data is deleted
+func (l *listener) finishDeletion(nid string) func() error {
+	return func() error {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if err := l.injector.DeleteNetwork(nid); err != nil {
 			return err
 		}
+		l.errq.Forget(nid)
+		return nil
 	}
+}
 
-	blkListener, ok := l.networks[nid]
-	if ok {
-		blkListener.Close()
-		delete(l.networks, nid)
+func (l *listener) Close() {
+	klog.Infof("Closing listener")
+	l.cancel()
+
+	l.lock.Lock()
+	for nid := range l.networks {
+		l.closeListener(nid)
+		// other replicas can take over without waiting for the lease to expire
+		l.release(nid)
 	}
+	l.lock.Unlock()
 
-	return nil
+	// deletion jobs take the lock to finish
+	l.deleter.wait()
+	l.retaining.Wait()
+	klog.Infof("Listener closed")
+}
+
+func (l *listener) SetRetention(nid string, retention *models.Retention) error {
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+	}
+	net, err := l.network(nid)
+	if err != nil {
+		return err
+	}
+	if net.Status == models.Deleting {
+		return errors.Wrapf(errInvalidStatus, "network %s is %s", nid, net.Status)
+	}
+	return l.injector.SetRetention(nid, retention)
+}
+
+func (l *listener) Errors(nid string) ([]errorsq.Entry, error) {
+	if _, err := l.network(nid); err != nil {
+		return nil, err
+	}
+	return l.errq.History(nid), nil
+}
+
+func (l *listener) DeletionJob(jid string) (models.DeletionJob, error) {
+	return l.deleter.get(jid)
 }
@@ -0,0 +1,250 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/network"
+	"github.com/bestchains/bc-explorer/pkg/secret"
+)
+
+func TestClose(t *testing.T) {
+	profile, err := json.Marshal(&network.FabProfile{
+		Channel:   "channel",
+		Endpoints: []network.NodeEndpoint{{URL: "peer0"}},
+	})
+	require.NoError(t, err)
+	peer := newFakePeer(2)
+	peer.blocks <- newBlock(0)
+	peer.blocks <- newBlock(1)
+	injector := &fakeInjector{}
+	coordinator := &fakeCoordinator{owned: map[string]bool{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &listener{
+		ctx:         ctx,
+		cancel:      cancel,
+		errq:        &fakeErrorsq{},
+		injector:    injector,
+		selector:    &fakeNetworkSelector{},
+		cipher:      secret.NewPlaintext(),
+		networks:    map[string]BlockEventListener{},
+		profiles:    map[string][]byte{},
+		deleter:     newDeleter(injector, &fakeNetworkSelector{}, nil),
+		coordinator: coordinator,
+		dialer: func(*network.Network) fabPeerDialer {
+			return fakeDialer(map[string]*fakePeer{"peer0": peer})
+		},
+	}
+	require.NoError(t, l.listen(&models.Network{
+		ID:      "network_channel",
+		Type:    string(network.FABRIC),
+		Profile: profile,
+		Status:  models.Registered,
+	}))
+	blkListener := l.networks["network_channel"]
+	require.Eventually(t, func() bool { return blkListener.CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+
+	l.Close()
+	assert.Empty(t, l.networks)
+	assert.Equal(t, []string{"network_channel"}, coordinator.released)
+	assert.Len(t, injector.Blocks(), 2)
+
+	// blocks arriving after close are not stored
+	peer.blocks <- newBlock(2)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, injector.Blocks(), 2)
+	assert.Equal(t, uint64(2), blkListener.CheckPoint())
+}
+
+// fakeNetworkStore keeps networks injected, and serves them along with checkpoints of blocks injected
+type fakeNetworkStore struct {
+	*fakeInjector
+	Selector
+
+	netsLock sync.Mutex
+	nets     map[string]models.Network
+}
+
+func (s *fakeNetworkStore) InjectNetworks(nets ...*models.Network) error {
+	s.netsLock.Lock()
+	defer s.netsLock.Unlock()
+	for _, net := range nets {
+		s.nets[net.ID] = *net
+	}
+	return nil
+}
+
+func (s *fakeNetworkStore) Networks(...string) ([]models.Network, error) {
+	s.netsLock.Lock()
+	defer s.netsLock.Unlock()
+	nets := make([]models.Network, 0, len(s.nets))
+	for _, net := range s.nets {
+		nets = append(nets, net)
+	}
+	return nets, nil
+}
+
+func (s *fakeNetworkStore) Network(nid string) (*models.Network, error) {
+	s.netsLock.Lock()
+	defer s.netsLock.Unlock()
+	net, ok := s.nets[nid]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &net, nil
+}
+
+func (s *fakeNetworkStore) NetworkStartAt(string) (uint64, error) {
+	blocks := s.Blocks()
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+	return blocks[len(blocks)-1].BlockNumber, nil
+}
+
+func TestPauseAndResume(t *testing.T) {
+	profile, err := json.Marshal(&network.FabProfile{
+		Channel:   "channel",
+		Endpoints: []network.NodeEndpoint{{URL: "peer0"}},
+	})
+	require.NoError(t, err)
+	peer := newFakePeer(2)
+	peer.blocks <- newBlock(0)
+	peer.blocks <- newBlock(1)
+	store := &fakeNetworkStore{fakeInjector: &fakeInjector{}, nets: map[string]models.Network{}}
+	require.NoError(t, store.InjectNetworks(&models.Network{
+		ID:      "network_channel",
+		Type:    string(network.FABRIC),
+		Profile: profile,
+		Status:  models.Registered,
+	}))
+	coordinator := &fakeCoordinator{owned: map[string]bool{"network_channel": true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := &listener{
+		ctx:         ctx,
+		cancel:      cancel,
+		errq:        &fakeErrorsq{},
+		injector:    store,
+		selector:    store,
+		cipher:      secret.NewPlaintext(),
+		networks:    map[string]BlockEventListener{},
+		profiles:    map[string][]byte{},
+		coordinator: coordinator,
+		dialer: func(*network.Network) fabPeerDialer {
+			return fakeDialer(map[string]*fakePeer{"peer0": peer})
+		},
+	}
+	listening := func() BlockEventListener {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		return l.networks["network_channel"]
+	}
+	status := func() models.Status {
+		net, err := store.Network("network_channel")
+		require.NoError(t, err)
+		return net.Status
+	}
+
+	l.reconcile()
+	require.NotNil(t, listening())
+	require.Eventually(t, func() bool { return listening().CheckPoint() == 2 }, time.Second, 10*time.Millisecond)
+
+	// paused network stops listening and keeps its checkpoint
+	require.NoError(t, l.Pause("network_channel"))
+	assert.Nil(t, listening())
+	assert.Equal(t, models.Paused, status())
+	assert.Equal(t, []string{"network_channel"}, coordinator.released)
+	checkpoint, err := l.startAt("network_channel")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), checkpoint)
+
+	// reconcile doesn't restart it even though its lease can be acquired
+	peer.blocks <- newBlock(2)
+	l.reconcile()
+	assert.Nil(t, listening())
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, store.Blocks(), 2)
+	// pausing again is a no-op
+	assert.NoError(t, l.Pause("network_channel"))
+	assert.Equal(t, models.Paused, status())
+
+	// resumed network continues from its checkpoint
+	require.NoError(t, l.Resume("network_channel"))
+	assert.Equal(t, models.Registered, status())
+	require.NotNil(t, listening())
+	require.Eventually(t, func() bool { return listening().CheckPoint() == 3 }, time.Second, 10*time.Millisecond)
+	blocks := store.Blocks()
+	require.Len(t, blocks, 3)
+	for i, blk := range blocks {
+		assert.Equal(t, uint64(i+1), blk.BlockNumber)
+	}
+	l.reconcile()
+	assert.NotNil(t, listening())
+}
+
+func TestRegisterReleasesLeaseOnFailure(t *testing.T) {
+	peer := newFakePeer(1)
+	peer.blocks <- newBlock(0)
+	store := &fakeNetworkStore{fakeInjector: &fakeInjector{}, nets: map[string]models.Network{}}
+	// networks being deleted can't be registered again
+	require.NoError(t, store.InjectNetworks(&models.Network{
+		ID:     "network_channel",
+		Type:   string(network.FABRIC),
+		Status: models.Deleting,
+	}))
+	coordinator := &fakeCoordinator{owned: map[string]bool{"network_channel": true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := &listener{
+		ctx:         ctx,
+		cancel:      cancel,
+		errq:        &fakeErrorsq{},
+		injector:    store,
+		selector:    store,
+		cipher:      secret.NewPlaintext(),
+		networks:    map[string]BlockEventListener{},
+		profiles:    map[string][]byte{},
+		coordinator: coordinator,
+		dialer: func(*network.Network) fabPeerDialer {
+			return fakeDialer(map[string]*fakePeer{"peer0": peer})
+		},
+	}
+
+	_, err := l.Register(&network.Network{
+		ID: "network",
+		FabProfile: &network.FabProfile{
+			Channel:      "channel",
+			Organization: "org1",
+			User:         newUser(t),
+			Endpoints:    []network.NodeEndpoint{{URL: "peer0"}},
+		},
+	}, RegisterOptions{})
+	assert.ErrorIs(t, err, errInvalidStatus)
+	assert.Empty(t, l.networks)
+	assert.Equal(t, []string{"network_channel"}, coordinator.released)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/bestchains/bc-explorer/pkg/metrics"
+)
+
+var (
+	blocksIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "blocks_ingested_total",
+		Help:      "Number of blocks stored by network.",
+	}, []string{"network"})
+	txsIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "transactions_ingested_total",
+		Help:      "Number of transactions stored by network.",
+	}, []string{"network"})
+	ingestionLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "ingestion_latency_seconds",
+		Help:      "Time from a block received to stored, including decoding and waiting for blocks before it.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"network"})
+	chainHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "chain_height",
+		Help:      "Block height of the peer a network is listened from.",
+	}, []string{"network"})
+	checkpoint = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "checkpoint",
+		Help:      "Number of blocks handled of a network.",
+	}, []string{"network"})
+	blockLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "block_lag",
+		Help:      "Number of blocks on peer not handled yet of a network.",
+	}, []string{"network"})
+	reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "listener",
+		Name:      "reconnects_total",
+		Help:      "Number of fail overs between peers by network.",
+	}, []string{"network"})
+)
+
+// observeHeight updates height and lag of a network
+func observeHeight(nid string, height uint64, handled uint64) {
+	chainHeight.WithLabelValues(nid).Set(float64(height))
+	checkpoint.WithLabelValues(nid).Set(float64(handled))
+	lag := float64(0)
+	if height > handled {
+		lag = float64(height - handled)
+	}
+	blockLag.WithLabelValues(nid).Set(lag)
+}
+
+// forgetMetrics removes series of a network which is no longer listened, so that series of deregistered,
+// deleted or handed over networks don't pile up. Counters start from zero if it's listened again.
+func forgetMetrics(nid string) {
+	blocksIngested.DeleteLabelValues(nid)
+	txsIngested.DeleteLabelValues(nid)
+	ingestionLatency.DeleteLabelValues(nid)
+	chainHeight.DeleteLabelValues(nid)
+	checkpoint.DeleteLabelValues(nid)
+	blockLag.DeleteLabelValues(nid)
+	reconnects.DeleteLabelValues(nid)
+}
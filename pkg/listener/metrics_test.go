@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForgetMetrics(t *testing.T) {
+	nid := "forget_channel"
+	// series returns names of metrics having series of the network
+	series := func() []string {
+		families, err := prometheus.DefaultGatherer.Gather()
+		require.NoError(t, err)
+		names := make([]string, 0)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "network" && label.GetValue() == nid {
+						names = append(names, family.GetName())
+					}
+				}
+			}
+		}
+		return names
+	}
+
+	blocksIngested.WithLabelValues(nid).Inc()
+	txsIngested.WithLabelValues(nid).Add(2)
+	ingestionLatency.WithLabelValues(nid).Observe(0.1)
+	reconnects.WithLabelValues(nid).Inc()
+	observeHeight(nid, 3, 1)
+	assert.Len(t, series(), 7)
+
+	forgetMetrics(nid)
+	assert.Empty(t, series())
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	// partitionsAhead is how many partitions after the current one are created in advance
+	partitionsAhead = 2
+	// partitionPeriod is the interval to create partitions in advance
+	partitionPeriod = time.Hour
+)
+
+// partitioner creates partitions of networks, remembering those created to skip them later
+type partitioner struct {
+	db       *pg.DB
+	interval time.Duration
+
+	// lock guards created and networks, while partitions of a network are created under its own lock in networks,
+	// so that injecting into other networks doesn't wait for them
+	lock     sync.Mutex
+	created  map[string]struct{}
+	networks map[string]*sync.Mutex
+}
+
+func newPartitioner(db *pg.DB, interval time.Duration) *partitioner {
+	return &partitioner{
+		db:       db,
+		interval: interval,
+		created:  map[string]struct{}{},
+		networks: map[string]*sync.Mutex{},
+	}
+}
+
+// ensure creates partitions of a network covering createdAt if not created yet
+func (p *partitioner) ensure(ctx context.Context, nid string, createdAt int64) error {
+	key := fmt.Sprintf("%s/%d", nid, models.PartitionStart(createdAt, p.interval))
+	if p.isCreated(key) {
+		return nil
+	}
+	network := p.networkLock(nid)
+	network.Lock()
+	defer network.Unlock()
+	if p.isCreated(key) {
+		return nil
+	}
+	if err := models.CreatePartitions(ctx, p.db, nid, createdAt, p.interval); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.created[key] = struct{}{}
+	p.lock.Unlock()
+	return nil
+}
+
+// networkLock returns the lock of a network, under which its partitions are created or dropped
+func (p *partitioner) networkLock(nid string) *sync.Mutex {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	network, ok := p.networks[nid]
+	if !ok {
+		network = &sync.Mutex{}
+		p.networks[nid] = network
+	}
+	return network
+}
+
+func (p *partitioner) isCreated(key string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.created[key]
+	return ok
+}
+
+// ahead creates partitions of registered networks from now to partitionsAhead intervals later.
+// Networks being deleted are skipped, otherwise partitions dropped by deletion might be created again.
+func (p *partitioner) ahead(ctx context.Context) error {
+	var nids []string
+	if err := p.db.ModelContext(ctx, (*models.Network)(nil)).Column("id").Where("status = ?", models.Registered).Select(&nids); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, nid := range nids {
+		for i := 0; i <= partitionsAhead; i++ {
+			if err := p.ensure(ctx, nid, now.Add(time.Duration(i)*p.interval).Unix()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// drop drops partitions of a network and forgets them.
+// It holds the lock of the network, so that partitions being created are not created again after dropped.
+func (p *partitioner) drop(ctx context.Context, nid string) error {
+	network := p.networkLock(nid)
+	network.Lock()
+	defer network.Unlock()
+	if err := models.DropPartitions(ctx, p.db, nid); err != nil {
+		return err
+	}
+	p.forget(nid)
+	return nil
+}
+
+// forget forgets partitions of a network once they are dropped
+func (p *partitioner) forget(nid string) {
+	prefix := nid + "/"
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key := range p.created {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.created, key)
+		}
+	}
+	delete(p.networks, nid)
+}
+
+// MaintainPartitions creates partitions of registered networks in advance every partitionPeriod, until ctx is done.
+// It shares partitions remembered by injector, which is a no-op if injector doesn't create partitions.
+// Partitions missed are created on demand when blocks are injected, and rows are kept in default partitions until then.
+func MaintainPartitions(ctx context.Context, injector Injector) {
+	pqitr, ok := injector.(interface{ partitioner() *partitioner })
+	if !ok || pqitr.partitioner() == nil {
+		return
+	}
+	p := pqitr.partitioner()
+	ticker := time.NewTicker(partitionPeriod)
+	defer ticker.Stop()
+	for {
+		if err := p.ahead(ctx); err != nil {
+			klog.Errorf("Failed to create partitions in advance: %s", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	// decodeWorkers is the number of goroutines decoding transactions of a listener
+	decodeWorkers = runtime.NumCPU()
+	// decodeBuffer is the max number of blocks received but not committed yet of a listener,
+	// listener stops receiving block events once the buffer is full
+	decodeBuffer = 16
+)
+
+// decodedBlock is a block with everything to inject
+type decodedBlock struct {
+	block   *models.Block
+	txs     []*models.Transaction
+	pvtData []*models.PrivateData
+	// raw is the original block, nil if not kept
+	raw *models.RawBlock
+	// txWrites are key writes of each transaction, which are collected into keyWrites in order by seal
+	txWrites  [][]*models.KeyWrite
+	keyWrites []*models.KeyWrite
+}
+
+// seal fills block fields which depend on decoded transactions
+func (decoded *decodedBlock) seal() {
+	decoded.block.TxCount = len(decoded.txs)
+	for _, tx := range decoded.txs {
+		if decoded.block.CreatedAt != 0 {
+			break
+		}
+		decoded.block.CreatedAt = tx.CreatedAt
+	}
+	decoded.keyWrites = decoded.keyWrites[:0]
+	for _, writes := range decoded.txWrites {
+		decoded.keyWrites = append(decoded.keyWrites, writes...)
+	}
+}
+
+// pendingBlock is a block in pipeline, which is committed after all its decoding tasks are done
+type pendingBlock struct {
+	number     uint64
+	decoded    *decodedBlock
+	receivedAt time.Time
+
+	decoding sync.WaitGroup
+	lock     sync.Mutex
+	err      error
+}
+
+func (pb *pendingBlock) fail(err error) {
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
+	if pb.err == nil {
+		pb.err = err
+	}
+}
+
+// pipeline decodes blocks on a pool of workers concurrently and commits them strictly in the order they are submitted.
+// Both decoding tasks and pending blocks are bounded, so submit blocks when decoding or committing falls behind.
+type pipeline struct {
+	ctx context.Context
+
+	tasks   chan func()
+	pending chan *pendingBlock
+	commit  func(pb *pendingBlock)
+
+	workers   sync.WaitGroup
+	committer sync.WaitGroup
+}
+
+func newPipeline(ctx context.Context, workers int, buffer int, commit func(pb *pendingBlock)) *pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	p := &pipeline{
+		ctx:     ctx,
+		tasks:   make(chan func(), workers),
+		pending: make(chan *pendingBlock, buffer),
+		commit:  commit,
+	}
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.workers.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	p.committer.Add(1)
+	go func() {
+		defer p.committer.Done()
+		for pb := range p.pending {
+			pb.decoding.Wait()
+			// blocks not committed yet are dropped once stopped, they are not counted by checkpoint
+			if p.ctx.Err() != nil {
+				continue
+			}
+			p.commit(pb)
+		}
+	}()
+	return p
+}
+
+// submit queues a block with its decoding tasks, which fill decoded concurrently.
+// It returns false if the pipeline is stopped before the block is queued.
+func (p *pipeline) submit(number uint64, decoded *decodedBlock, tasks ...func() error) bool {
+	pb := &pendingBlock{number: number, decoded: decoded, receivedAt: time.Now()}
+	pb.decoding.Add(len(tasks))
+	select {
+	case p.pending <- pb:
+	case <-p.ctx.Done():
+		return false
+	}
+	for i, task := range tasks {
+		task := task
+		run := func() {
+			defer pb.decoding.Done()
+			if p.ctx.Err() != nil {
+				return
+			}
+			if err := task(); err != nil {
+				pb.fail(err)
+			}
+		}
+		select {
+		case p.tasks <- run:
+		case <-p.ctx.Done():
+			pb.decoding.Add(i - len(tasks))
+			return false
+		}
+	}
+	return true
+}
+
+// close waits for workers and committer to exit, it must be called after the last submit
+func (p *pipeline) close() {
+	close(p.tasks)
+	close(p.pending)
+	p.workers.Wait()
+	p.committer.Wait()
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestPipelineCommitsInOrder(t *testing.T) {
+	var lock sync.Mutex
+	var committed []uint64
+	var failed []uint64
+	p := newPipeline(context.Background(), 4, 4, func(pb *pendingBlock) {
+		lock.Lock()
+		defer lock.Unlock()
+		committed = append(committed, pb.number)
+		if pb.err != nil {
+			failed = append(failed, pb.number)
+		}
+	})
+
+	for number := uint64(0); number < 20; number++ {
+		decoded := &decodedBlock{block: &models.Block{}, txs: make([]*models.Transaction, 3)}
+		tasks := make([]func() error, 3)
+		for i := range tasks {
+			i, number := i, number
+			tasks[i] = func() error {
+				// earlier blocks take longer to decode
+				time.Sleep(time.Duration(20-number) * time.Millisecond)
+				if number == 7 && i == 2 {
+					return errors.New("bad tx")
+				}
+				decoded.txs[i] = &models.Transaction{CreatedAt: int64(number)}
+				return nil
+			}
+		}
+		require.True(t, p.submit(number, decoded, tasks...))
+	}
+	p.close()
+
+	require.Len(t, committed, 20)
+	for i, number := range committed {
+		assert.Equal(t, uint64(i), number)
+	}
+	assert.Equal(t, []uint64{7}, failed)
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	p := newPipeline(ctx, 1, 2, func(pb *pendingBlock) {
+		<-release
+	})
+
+	submitted := make(chan uint64, 10)
+	go func() {
+		for number := uint64(0); number < 10; number++ {
+			if !p.submit(number, &decodedBlock{block: &models.Block{}}) {
+				break
+			}
+			submitted <- number
+		}
+		close(submitted)
+	}()
+
+	// one block is being committed and two are buffered, the rest must wait
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, submitted, 3)
+
+	cancel()
+	close(release)
+	for range submitted {
+	}
+	p.close()
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+var (
+	errPreflightFailed = errors.New("network preflight failed")
+	errBlockReadDenied = errors.New("unable to read blocks from channel")
+)
+
+var (
+	// preflightTimeout limits how long the checks on one peer take
+	preflightTimeout = 10 * time.Second
+)
+
+// Checks done by preflight
+const (
+	CheckProfile    = "profile"
+	CheckIdentity   = "identity"
+	CheckConnection = "connection"
+	CheckChannel    = "channel"
+	CheckBlockRead  = "blockRead"
+)
+
+// PreflightCheck is the result of one check
+type PreflightCheck struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PreflightReport tells whether a network can be listened.
+// It passes if the profile is valid and at least one peer passes all checks.
+type PreflightReport struct {
+	Network string `json:"network"`
+	Passed  bool   `json:"passed"`
+	// Height is the highest ledger height among peers
+	Height uint64           `json:"height"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// add records a check, and returns whether it passed
+func (r *PreflightReport) add(name string, endpoint string, err error) bool {
+	check := PreflightCheck{
+		Name:     name,
+		Endpoint: endpoint,
+		Passed:   err == nil,
+	}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+	return check.Passed
+}
+
+func (r *PreflightReport) Error() string {
+	var failed []string
+	for _, check := range r.Checks {
+		if check.Passed {
+			continue
+		}
+		if check.Endpoint != "" {
+			failed = append(failed, fmt.Sprintf("%s(%s): %s", check.Name, check.Endpoint, check.Error))
+		} else {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Name, check.Error))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// preflight checks the profile and identity, then dials every peer to check the identity can read blocks from the channel
+func preflight(ctx context.Context, n *network.Network, dial fabPeerDialer) *PreflightReport {
+	report := &PreflightReport{Network: n.ID}
+	if !report.add(CheckProfile, "", validateProfile(n)) {
+		return report
+	}
+	if !report.add(CheckIdentity, "", validateIdentity(n.FabProfile)) {
+		return report
+	}
+	for _, endpoint := range n.FabProfile.PeerEndpoints() {
+		height, ok := preflightPeer(ctx, report, n.FabProfile.EventMode, endpoint, dial)
+		if ok {
+			report.Passed = true
+		}
+		if height > report.Height {
+			report.Height = height
+		}
+	}
+	klog.Infof("Preflight of network %s passed: %t", n.ID, report.Passed)
+	return report
+}
+
+func validateProfile(n *network.Network) error {
+	if n.Type() != network.FABRIC {
+		return errNetworkTypeUnknown
+	}
+	if n.FabProfile.Channel == "" {
+		return errors.Wrap(errInvalidNetworkProfile, "missing channel")
+	}
+	for _, endpoint := range n.FabProfile.PeerEndpoints() {
+		if endpoint.URL == "" {
+			return errors.Wrap(errInvalidNetworkProfile, "missing peer endpoint url")
+		}
+	}
+	return nil
+}
+
+func validateIdentity(p *network.FabProfile) error {
+	if p.Organization == "" {
+		return errors.Wrap(errInvalidNetworkProfile, "missing organization")
+	}
+	return p.User.Validate()
+}
+
+// preflightPeer returns the peer's ledger height and whether it passed all checks
+func preflightPeer(pctx context.Context, report *PreflightReport, mode network.EventMode, endpoint network.NodeEndpoint, dial fabPeerDialer) (uint64, bool) {
+	ctx, cancel := context.WithTimeout(pctx, preflightTimeout)
+	defer cancel()
+
+	conn, err := dial(endpoint)
+	if !report.add(CheckConnection, endpoint.URL, err) {
+		return 0, false
+	}
+	defer conn.Close()
+
+	// querying chain info requires the identity to be a reader of the channel
+	height, err := conn.Height(ctx)
+	if !report.add(CheckChannel, endpoint.URL, err) {
+		return 0, false
+	}
+
+	var last uint64
+	if height > 0 {
+		last = height - 1
+	}
+	return height, report.add(CheckBlockRead, endpoint.URL, readBlock(ctx, conn, mode, last))
+}
+
+// readBlock waits for the block to be delivered, which fails if the identity is not allowed to read blocks in this mode
+func readBlock(ctx context.Context, conn fabEventSource, mode network.EventMode, number uint64) error {
+	start := client.WithStartBlock(number)
+	switch mode {
+	case network.FilteredBlockEventMode:
+		events, err := conn.FilteredBlockEvents(ctx, start)
+		if err != nil {
+			return errors.Wrap(errBlockReadDenied, err.Error())
+		}
+		return firstEvent(ctx, events)
+	case network.PrivateDataEventMode:
+		events, err := conn.BlockAndPrivateDataEvents(ctx, start)
+		if err != nil {
+			return errors.Wrap(errBlockReadDenied, err.Error())
+		}
+		return firstEvent(ctx, events)
+	default:
+		events, err := conn.BlockEvents(ctx, start)
+		if err != nil {
+			return errors.Wrap(errBlockReadDenied, err.Error())
+		}
+		return firstEvent(ctx, events)
+	}
+}
+
+func firstEvent[T any](ctx context.Context, events <-chan T) error {
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(errBlockReadDenied, ctx.Err().Error())
+	case _, ok := <-events:
+		if !ok {
+			return errors.Wrap(errBlockReadDenied, "block events closed, the identity might not have permission")
+		}
+		return nil
+	}
+}
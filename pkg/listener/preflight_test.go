@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+func newUser(t *testing.T) network.User {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	return network.User{
+		Name: "admin",
+		Cert: network.Pem{Pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+		Key:  network.Pem{Pem: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))},
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	preflightTimeout = 100 * time.Millisecond
+
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:      "channel",
+			Organization: "org1",
+			User:         newUser(t),
+			Endpoints:    []network.NodeEndpoint{{URL: "peer0"}, {URL: "peer1"}, {URL: "peer2"}},
+		},
+	}
+
+	// peer0 is unreachable, peer1 denies block events, peer2 passes
+	peer1 := newFakePeer(5)
+	close(peer1.blocks)
+	peer2 := newFakePeer(6)
+	peer2.blocks <- newBlock(5)
+	report := preflight(context.Background(), net, fakeDialer(map[string]*fakePeer{"peer1": peer1, "peer2": peer2}))
+	assert.True(t, report.Passed)
+	assert.Equal(t, uint64(6), report.Height)
+	failed := map[string]string{}
+	for _, check := range report.Checks {
+		if !check.Passed {
+			failed[check.Endpoint] = check.Name
+		}
+	}
+	assert.Equal(t, map[string]string{"peer0": CheckConnection, "peer1": CheckBlockRead}, failed)
+
+	// the identity is not a member of this channel
+	peer2 = newFakePeer(0)
+	peer2.heightErr = errors.New("access denied")
+	report = preflight(context.Background(), net, fakeDialer(map[string]*fakePeer{"peer2": peer2}))
+	assert.False(t, report.Passed)
+	assert.Contains(t, report.Error(), "channel(peer2): access denied")
+
+	// invalid identity fails without dialing peers
+	net.FabProfile.User.Key = newUser(t).Key
+	report = preflight(context.Background(), net, fakeDialer(nil))
+	assert.False(t, report.Passed)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, CheckIdentity, report.Checks[1].Name)
+}
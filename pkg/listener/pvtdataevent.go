@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/rwsetutil"
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	errInvalidFabPvtData = errors.New("invalid fabric private data")
+)
+
+// decodeFabPvtData returns a block with decoding tasks of its transactions and private data
+func (listener *fabEventListener) decodeFabPvtData(data *peer.BlockAndPrivateData) (*decodedBlock, []func() error) {
+	decoded, tasks := listener.decodeFabBlock(data.GetBlock())
+	tasks = append(tasks, func() error {
+		pvtData, err := parseFabPvtData(listener.nid, data, listener.collectionAllowed)
+		if err != nil {
+			return errors.Wrap(errInvalidFabPvtData, err.Error())
+		}
+		decoded.pvtData = pvtData
+		return nil
+	})
+	return decoded, tasks
+}
+
+// parseFabPvtData extracts cleartext private writes of allowed collections and links them with
+// the private rwset hash recorded in each transaction's public rwset
+func parseFabPvtData(network string, data *peer.BlockAndPrivateData, allowed func(namespace, collection string) bool) ([]*models.PrivateData, error) {
+	block := data.GetBlock()
+	blockNumber := block.GetHeader().GetNumber() + 1 // postgresql treat 0 as null,so we start from 1
+	txsData := block.GetData().GetData()
+
+	// sort by tx sequence in block to keep insert order stable
+	seqs := make([]uint64, 0, len(data.GetPrivateDataMap()))
+	for seq := range data.GetPrivateDataMap() {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	result := make([]*models.PrivateData, 0)
+	for _, seq := range seqs {
+		if seq >= uint64(len(txsData)) {
+			return nil, fmt.Errorf("private data of tx %d is out of block %d", seq, blockNumber)
+		}
+		txID, txRwSet, err := protoutil.GetTxRwSetFromEnvelope(txsData[seq])
+		if err != nil {
+			return nil, err
+		}
+		txPvtRwSet, err := rwsetutil.TxPvtRwSetFromProtoMsg(data.GetPrivateDataMap()[seq])
+		if err != nil {
+			return nil, err
+		}
+		for _, nsPvtRwSet := range txPvtRwSet.NsPvtRwSet {
+			for _, collPvtRwSet := range nsPvtRwSet.CollPvtRwSets {
+				if allowed == nil || !allowed(nsPvtRwSet.NameSpace, collPvtRwSet.CollectionName) {
+					continue
+				}
+				pd := &models.PrivateData{
+					ID:           fmt.Sprintf("%s_%s_%s", txID, nsPvtRwSet.NameSpace, collPvtRwSet.CollectionName),
+					Network:      network,
+					BlockNumber:  blockNumber,
+					TxID:         txID,
+					Namespace:    nsPvtRwSet.NameSpace,
+					Collection:   collPvtRwSet.CollectionName,
+					PvtRwSetHash: hex.EncodeToString(txRwSet.GetPvtDataHash(nsPvtRwSet.NameSpace, collPvtRwSet.CollectionName)),
+					Writes:       make([]models.PrivateWrite, 0),
+				}
+				for _, write := range collPvtRwSet.KvRwSet.GetWrites() {
+					keyHash := sha256.Sum256([]byte(write.GetKey()))
+					pd.Writes = append(pd.Writes, models.PrivateWrite{
+						Key:      strings.Replace(write.GetKey(), "\u0000", "", -1),
+						KeyHash:  hex.EncodeToString(keyHash[:]),
+						Value:    string(write.GetValue()),
+						IsDelete: write.GetIsDelete(),
+					})
+				}
+				result = append(result, pd)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+func mustMarshal(t *testing.T, m proto.Message) []byte {
+	raw, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return raw
+}
+
+// newEndorserTx builds an endorser transaction envelope whose public rwset carries the given hashed collections
+func newEndorserTx(t *testing.T, txID, namespace string, pvtRwSetHashes map[string][]byte) []byte {
+	return newEndorserTxWithRWSet(t, txID, namespace, &kvrwset.KVRWSet{}, pvtRwSetHashes)
+}
+
+// newEndorserTxWithRWSet builds an endorser transaction envelope with the public rwset of namespace
+func newEndorserTxWithRWSet(t *testing.T, txID, namespace string, kvRWSet *kvrwset.KVRWSet, pvtRwSetHashes map[string][]byte) []byte {
+	nsRwSet := &rwset.NsReadWriteSet{
+		Namespace: namespace,
+		Rwset:     mustMarshal(t, kvRWSet),
+	}
+	for coll, hash := range pvtRwSetHashes {
+		nsRwSet.CollectionHashedRwset = append(nsRwSet.CollectionHashedRwset, &rwset.CollectionHashedReadWriteSet{
+			CollectionName: coll,
+			HashedRwset:    mustMarshal(t, &kvrwset.HashedRWSet{}),
+			PvtRwsetHash:   hash,
+		})
+	}
+	action := &peer.ChaincodeAction{
+		Results:     mustMarshal(t, &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV, NsRwset: []*rwset.NsReadWriteSet{nsRwSet}}),
+		ChaincodeId: &peer.ChaincodeID{Name: namespace, Version: "1"},
+	}
+	ccPayload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: mustMarshal(t, &peer.ChaincodeProposalPayload{
+			Input: mustMarshal(t, &peer.ChaincodeInvocationSpec{
+				ChaincodeSpec: &peer.ChaincodeSpec{Input: &peer.ChaincodeInput{Args: [][]byte{[]byte("PutPrivate")}}},
+			}),
+		}),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: mustMarshal(t, &peer.ProposalResponsePayload{Extension: mustMarshal(t, action)}),
+		},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader: mustMarshal(t, &common.ChannelHeader{
+				Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+				TxId:      txID,
+				Timestamp: timestamppb.Now(),
+			}),
+			SignatureHeader: mustMarshal(t, &common.SignatureHeader{
+				Creator: mustMarshal(t, &msp.SerializedIdentity{Mspid: "org1"}),
+			}),
+		},
+		Data: mustMarshal(t, &peer.Transaction{
+			Actions: []*peer.TransactionAction{{Payload: mustMarshal(t, ccPayload)}},
+		}),
+	}
+	return mustMarshal(t, &common.Envelope{Payload: mustMarshal(t, payload)})
+}
+
+func TestPvtDataEvents(t *testing.T) {
+	pvtRwSet := mustMarshal(t, &kvrwset.KVRWSet{
+		Writes: []*kvrwset.KVWrite{{Key: "secret", Value: []byte("value")}},
+	})
+	pvtRwSetHash := sha256.Sum256(pvtRwSet)
+
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 2},
+		Data: &common.BlockData{Data: [][]byte{
+			newEndorserTx(t, "tx1", "samplecc", map[string][]byte{"allowed": pvtRwSetHash[:], "denied": pvtRwSetHash[:]}),
+		}},
+	}
+	data := &peer.BlockAndPrivateData{
+		Block: block,
+		PrivateDataMap: map[uint64]*rwset.TxPvtReadWriteSet{
+			0: {
+				DataModel: rwset.TxReadWriteSet_KV,
+				NsPvtRwset: []*rwset.NsPvtReadWriteSet{{
+					Namespace: "samplecc",
+					CollectionPvtRwset: []*rwset.CollectionPvtReadWriteSet{
+						{CollectionName: "allowed", Rwset: pvtRwSet},
+						{CollectionName: "denied", Rwset: pvtRwSet},
+					},
+				}},
+			},
+		},
+	}
+
+	net := &network.Network{
+		ID: "network_channel",
+		FabProfile: &network.FabProfile{
+			Channel:            "channel",
+			EventMode:          network.PrivateDataEventMode,
+			PrivateCollections: []network.PrivateCollection{{Namespace: "samplecc", Collection: "allowed"}},
+		},
+	}
+	peer := newFakePeer(0)
+	injector := &fakeInjector{}
+	errq := &fakeErrorsq{}
+	listener, err := newFabEventListenerWithDialer(context.Background(), errq, injector, net, 0, fakeDialer(map[string]*fakePeer{"": peer}))
+	require.NoError(t, err)
+
+	peer.pvtData <- data
+	done := runEvents(listener)
+	require.Eventually(t, func() bool { return len(injector.PrivateData()) == 1 }, time.Second, 10*time.Millisecond)
+	listener.Close()
+	<-done
+
+	assert.Empty(t, errq.Errors())
+	require.Len(t, injector.blocks, 1)
+	assert.Equal(t, uint64(3), injector.blocks[0].BlockNumber)
+	require.Len(t, injector.txs, 1)
+	assert.Equal(t, "tx1", injector.txs[0].ID)
+
+	keyHash := sha256.Sum256([]byte("secret"))
+	require.Len(t, injector.pvtData, 1)
+	assert.Equal(t, &models.PrivateData{
+		ID:           "tx1_samplecc_allowed",
+		Network:      "network_channel",
+		BlockNumber:  3,
+		TxID:         "tx1",
+		Namespace:    "samplecc",
+		Collection:   "allowed",
+		PvtRwSetHash: hex.EncodeToString(pvtRwSetHash[:]),
+		Writes: []models.PrivateWrite{{
+			Key:     "secret",
+			KeyHash: hex.EncodeToString(keyHash[:]),
+			Value:   "value",
+		}},
+	}, injector.pvtData[0])
+}
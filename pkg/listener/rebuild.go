@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
+)
+
+var (
+	ErrNetworkListened     = errors.New("network is listened, pause it before rebuilding")
+	ErrRawBlocksIncomplete = errors.New("raw blocks do not start from the earliest block")
+	errStopRange           = errors.New("stop range")
+)
+
+// rebuildModels are derived from raw blocks, which are deleted in order before rebuilding.
+// Private data is not in raw blocks, so it is kept as is.
+var rebuildModels = []interface{}{
+	(*models.KeyWrite)(nil),
+	(*models.Transaction)(nil),
+	(*models.Block)(nil),
+}
+
+// RebuildResult is how many raw blocks are rebuilt, and skipped since they fail to decode
+type RebuildResult struct {
+	Rebuilt int
+	Skipped int
+}
+
+// Rebuild deletes blocks, transactions and key writes of a network, and decodes them again from raw blocks in raw.
+// Blocks failed to decode are skipped like listening does. The network must not be listened while rebuilding,
+// and raw blocks must start from its earliest block, otherwise history before them would be lost.
+func Rebuild(ctx context.Context, injector Injector, raw rawstore.Store, net *models.Network) (RebuildResult, error) {
+	var result RebuildResult
+	nid := net.ID
+	if net.Status == models.Registered {
+		return result, ErrNetworkListened
+	}
+	first, err := firstRawBlock(ctx, raw, nid)
+	if err != nil {
+		return result, err
+	}
+	earliest := net.EarliestBlockNumber
+	if earliest == 0 {
+		earliest = 1
+	}
+	if first == 0 || first > earliest {
+		return result, errors.Wrapf(ErrRawBlocksIncomplete, "first raw block %d, earliest block %d", first, earliest)
+	}
+
+	for _, model := range rebuildModels {
+		for {
+			n, err := injector.DeleteNetworkData(nid, model, deletionBatchSize)
+			if err != nil {
+				return result, err
+			}
+			if n == 0 {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	err = raw.Range(ctx, nid, 1, func(rb *models.RawBlock) error {
+		decoded, err := decodeRawBlock(nid, rb)
+		if err != nil {
+			klog.Warningf("Skip raw block %d of network %s: %s", rb.BlockNumber, nid, err.Error())
+			result.Skipped++
+			return nil
+		}
+		decoded.seal()
+		if err := injector.InjectBlocks(decoded.block); err != nil {
+			return errors.Wrapf(err, "block %d", rb.BlockNumber)
+		}
+		if err := injector.InjectTransactions(decoded.txs...); err != nil {
+			return errors.Wrapf(err, "block %d", rb.BlockNumber)
+		}
+		if len(decoded.keyWrites) > 0 {
+			if err := injector.InjectKeyWrites(decoded.keyWrites...); err != nil {
+				return errors.Wrapf(err, "block %d", rb.BlockNumber)
+			}
+		}
+		result.Rebuilt++
+		if result.Rebuilt%1000 == 0 {
+			klog.Infof("Rebuilt %d blocks of network %s", result.Rebuilt, nid)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// decodeRawBlock decodes a raw block and its transactions
+func decodeRawBlock(nid string, rb *models.RawBlock) (*decodedBlock, error) {
+	block, err := rawstore.Block(rb)
+	if err != nil {
+		return nil, err
+	}
+	decoded, tasks := decodeFabBlock(nid, block, false)
+	for _, task := range tasks {
+		if err := task(); err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+// firstRawBlock returns number of the first raw block of a network, 0 if there is none
+func firstRawBlock(ctx context.Context, raw rawstore.Store, nid string) (uint64, error) {
+	var first uint64
+	err := raw.Range(ctx, nid, 1, func(rb *models.RawBlock) error {
+		first = rb.BlockNumber
+		return errStopRange
+	})
+	if err != nil && !errors.Is(err, errStopRange) {
+		return 0, err
+	}
+	return first, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
+)
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	raw, err := rawstore.NewDirStore(t.TempDir())
+	require.NoError(t, err)
+	net := &models.Network{ID: "network_channel", Status: models.Paused}
+
+	// no raw blocks
+	_, err = Rebuild(ctx, &fakeInjector{}, raw, net)
+	assert.ErrorIs(t, err, ErrRawBlocksIncomplete)
+
+	for i := uint64(0); i < 3; i++ {
+		rb, err := rawstore.NewRawBlock(net.ID, newTimedBlock(t, i, 1000+int64(i)))
+		require.NoError(t, err)
+		require.NoError(t, raw.Put(ctx, rb))
+	}
+	// block 4 can't be decoded
+	require.NoError(t, raw.Put(ctx, &models.RawBlock{Network: net.ID, BlockNumber: 4, Data: []byte("invalid")}))
+
+	// derived data out of date is replaced, while private data is kept
+	injector := &fakeInjector{}
+	require.NoError(t, injector.InjectBlocks(&models.Block{BlockNumber: 1, BlockHash: "stale"}))
+	require.NoError(t, injector.InjectPrivateData(&models.PrivateData{BlockNumber: 1}))
+
+	_, err = Rebuild(ctx, injector, raw, &models.Network{ID: net.ID, Status: models.Registered})
+	assert.ErrorIs(t, err, ErrNetworkListened)
+
+	result, err := Rebuild(ctx, injector, raw, net)
+	require.NoError(t, err)
+	assert.Equal(t, RebuildResult{Rebuilt: 3, Skipped: 1}, result)
+	blocks := injector.Blocks()
+	require.Len(t, blocks, 3)
+	for i, blk := range blocks {
+		assert.Equal(t, uint64(i+1), blk.BlockNumber)
+		assert.Equal(t, int64(1000+i), blk.CreatedAt)
+		assert.Equal(t, 1, blk.TxCount)
+	}
+	assert.Len(t, injector.txs, 3)
+	assert.Len(t, injector.PrivateData(), 1)
+
+	// history before raw blocks would be lost
+	_, err = raw.Prune(ctx, net.ID, 2, 1)
+	require.NoError(t, err)
+	_, err = Rebuild(ctx, injector, raw, net)
+	assert.ErrorIs(t, err, ErrRawBlocksIncomplete)
+	_, err = Rebuild(ctx, injector, raw, &models.Network{ID: net.ID, Status: models.Paused, EarliestBlockNumber: 2})
+	assert.NoError(t, err)
+}
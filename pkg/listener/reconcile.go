@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"bytes"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/errorsq"
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	// reconcileInterval is how often leases are renewed, it should be far less than the lease ttl
+	reconcileInterval = 10 * time.Second
+)
+
+// Ownership tells which replica listens a network
+type Ownership struct {
+	Network string `json:"network"`
+	Holder  string `json:"holder"`
+	// Self is true if the network is owned by the replica serving this request
+	Self      bool       `json:"self"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (l *listener) Owners() ([]Ownership, error) {
+	if l.coordinator == nil {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		owners := make([]Ownership, 0, len(l.networks))
+		for nid := range l.networks {
+			owners = append(owners, Ownership{Network: nid, Holder: l.identity, Self: true})
+		}
+		sort.Slice(owners, func(i, j int) bool { return owners[i].Network < owners[j].Network })
+		return owners, nil
+	}
+
+	leases, err := l.coordinator.Leases()
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]Ownership, len(leases))
+	for i := range leases {
+		owners[i] = Ownership{
+			Network:   leases[i].ID,
+			Holder:    leases[i].Holder,
+			Self:      leases[i].Holder == l.coordinator.Identity(),
+			ExpiresAt: &leases[i].ExpiresAt,
+		}
+	}
+	return owners, nil
+}
+
+// runReconcile reconciles periodically until the listener stops
+func (l *listener) runReconcile() {
+	klog.Infof("Start reconciling network leases as %s", l.coordinator.Identity())
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		l.reconcile()
+		atomic.StoreInt64(&l.reconciledAt, time.Now().UnixNano())
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile renews leases of networks assigned to this replica, takes over assigned networks once their leases are free,
+// hands over networks assigned to other replicas, and follows changes made by other replicas, such as updated profiles or status.
+func (l *listener) reconcile() {
+	if err := l.coordinator.Heartbeat(); err != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(err, "send heartbeat"), "", errorsq.StageReconcile))
+	}
+	replicas, replicasErr := l.coordinator.Replicas()
+	if replicasErr != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(replicasErr, "list replicas"), "", errorsq.StageReconcile))
+	}
+	nets, err := l.selector.Networks()
+	if err != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(errListNetworks, err.Error()), "", errorsq.StageReconcile))
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.ctx.Err() != nil {
+		return
+	}
+	// networks stay assigned as before if replicas are unknown, otherwise every replica would take over all networks
+	if replicasErr == nil {
+		if len(replicas) != len(l.replicas) {
+			klog.Infof("%d listener replicas alive, rebalancing networks", len(replicas))
+		}
+		l.replicas = replicas
+	}
+
+	stored := make(map[string]bool, len(nets))
+	for i := range nets {
+		net := &nets[i]
+		stored[net.ID] = true
+		_, listening := l.networks[net.ID]
+
+		if net.Status != models.Registered {
+			if listening {
+				klog.Infof("Stop listening network %s which is %s", net.ID, net.Status)
+				l.closeListener(net.ID)
+				l.release(net.ID)
+				if net.Status == models.Deregistered {
+					l.errq.Forget(net.ID)
+				}
+			}
+			if net.Status == models.Deleting && l.assigned(net.ID) {
+				// continue the deletion interrupted by a restart or left by a gone replica, or retry the failed one
+				l.deleter.start(l.ctx, net.ID, l.finishDeletion(net.ID))
+			}
+			continue
+		}
+
+		if !l.assigned(net.ID) {
+			if listening {
+				// the assigned replica takes over once the lease is released
+				klog.Infof("Hand over network %s to another replica", net.ID)
+				l.closeListener(net.ID)
+				l.release(net.ID)
+			}
+			continue
+		}
+
+		owned := l.own(net.ID)
+		switch {
+		case !owned && listening:
+			klog.Warningf("Lost lease of network %s, stop listening", net.ID)
+			l.closeListener(net.ID)
+		case owned && !listening:
+			klog.Infof("Acquired lease of network %s, start listening", net.ID)
+			if err = l.listen(net); err != nil {
+				l.errq.Send(errorsq.Tag(err, net.ID, errorsq.StageListen))
+			}
+		case owned && listening && !bytes.Equal(l.profiles[net.ID], net.Profile):
+			klog.Infof("Profile of network %s is updated, restart listening", net.ID)
+			// Close waits for the block in handling, so listen continues from the last stored block
+			l.closeListener(net.ID)
+			if err = l.listen(net); err != nil {
+				l.errq.Send(errorsq.Tag(err, net.ID, errorsq.StageListen))
+			}
+		}
+	}
+
+	for nid := range l.networks {
+		if !stored[nid] {
+			klog.Infof("Stop listening network %s which is deleted", nid)
+			l.closeListener(nid)
+			l.release(nid)
+			l.errq.Forget(nid)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/network"
+	"github.com/bestchains/bc-explorer/pkg/secret"
+)
+
+// fakeCoordinator grants leases by the owned map
+type fakeCoordinator struct {
+	owned    map[string]bool
+	released []string
+	replicas []models.Replica
+	// replicasErr fails listing replicas
+	replicasErr error
+}
+
+func (c *fakeCoordinator) Identity() string                 { return "replica-0" }
+func (c *fakeCoordinator) Acquire(nid string) (bool, error) { return c.owned[nid], nil }
+func (c *fakeCoordinator) Leases() ([]models.Lease, error)  { return nil, nil }
+func (c *fakeCoordinator) Heartbeat() error                 { return nil }
+func (c *fakeCoordinator) Replicas() ([]models.Replica, error) {
+	if c.replicasErr != nil {
+		return nil, c.replicasErr
+	}
+	return c.replicas, nil
+}
+func (c *fakeCoordinator) Release(nid string) error {
+	c.released = append(c.released, nid)
+	return nil
+}
+
+// fakeNetworkSelector serves stored networks
+type fakeNetworkSelector struct {
+	Selector
+	nets []models.Network
+}
+
+func (s *fakeNetworkSelector) Networks(...string) ([]models.Network, error) {
+	return append([]models.Network{}, s.nets...), nil
+}
+
+func (s *fakeNetworkSelector) NetworkStartAt(string) (uint64, error) { return 0, nil }
+
+func TestReconcile(t *testing.T) {
+	profile, err := json.Marshal(&network.FabProfile{
+		Channel:   "channel",
+		Endpoints: []network.NodeEndpoint{{URL: "peer0"}},
+	})
+	require.NoError(t, err)
+	selector := &fakeNetworkSelector{nets: []models.Network{{
+		ID:      "network_channel",
+		Type:    string(network.FABRIC),
+		Profile: profile,
+		Status:  models.Registered,
+	}}}
+	coordinator := &fakeCoordinator{owned: map[string]bool{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := &listener{
+		ctx:         ctx,
+		errq:        &fakeErrorsq{},
+		injector:    &fakeInjector{},
+		selector:    selector,
+		cipher:      secret.NewPlaintext(),
+		networks:    map[string]BlockEventListener{},
+		profiles:    map[string][]byte{},
+		coordinator: coordinator,
+		dialer: func(*network.Network) fabPeerDialer {
+			return fakeDialer(map[string]*fakePeer{"peer0": newFakePeer(0)})
+		},
+	}
+	listening := func() bool {
+		_, ok := l.networks["network_channel"]
+		return ok
+	}
+
+	// owned by another replica
+	l.reconcile()
+	assert.False(t, listening())
+
+	// take over once the lease is acquired
+	coordinator.owned["network_channel"] = true
+	l.reconcile()
+	assert.True(t, listening())
+
+	// restart with profile updated by another replica
+	first := l.networks["network_channel"]
+	selector.nets[0].Profile = append([]byte(" "), profile...)
+	l.reconcile()
+	assert.True(t, listening())
+	assert.NotSame(t, first, l.networks["network_channel"])
+
+	// lost the lease
+	coordinator.owned["network_channel"] = false
+	l.reconcile()
+	assert.False(t, listening())
+
+	// paused by another replica
+	coordinator.owned["network_channel"] = true
+	l.reconcile()
+	selector.nets[0].Status = models.Paused
+	l.reconcile()
+	assert.False(t, listening())
+	assert.Equal(t, []string{"network_channel"}, coordinator.released)
+
+	// hand over to the replica which the network is assigned to
+	selector.nets[0].Status = models.Registered
+	l.reconcile()
+	assert.True(t, listening())
+	coordinator.replicas = []models.Replica{{ID: "replica-0"}, {ID: "replica-1"}}
+	owner, self := l.Owner("network_channel")
+	if self {
+		// the network stays when it is assigned to this replica
+		assert.Equal(t, "replica-0", owner.ID)
+		coordinator.replicas = []models.Replica{{ID: "replica-1"}}
+	}
+	l.reconcile()
+	assert.False(t, listening())
+	owner, self = l.Owner("network_channel")
+	assert.False(t, self)
+	assert.Equal(t, "replica-1", owner.ID)
+
+	// networks stay assigned as before when replicas fail to list
+	coordinator.replicasErr = errors.New("database is down")
+	l.reconcile()
+	assert.False(t, listening())
+	owner, self = l.Owner("network_channel")
+	assert.False(t, self)
+	assert.Equal(t, "replica-1", owner.ID)
+}
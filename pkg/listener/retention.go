@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/errorsq"
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	// retentionInterval is how often history out of retention is pruned
+	retentionInterval = 10 * time.Minute
+)
+
+// payloadModels are pruned entirely when only headers are retained, since they are made of payloads
+var payloadModels = []interface{}{
+	(*models.RawBlock)(nil),
+	(*models.PrivateData)(nil),
+	(*models.KeyWrite)(nil),
+}
+
+// runRetention prunes history out of retention of networks assigned to this replica, until the listener is closed
+func (l *listener) runRetention() {
+	defer l.retaining.Done()
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.retainAll()
+	}
+}
+
+// retainAll prunes history of registered and paused networks assigned to this replica, listened or not.
+// Networks are read each time, since retention may be changed on other replicas.
+func (l *listener) retainAll() {
+	nets, err := l.selector.Networks("id", "status", `"earliestBlockNumber"`, `"earliestPayloadBlockNumber"`, "retention")
+	if err != nil {
+		l.errq.Send(errorsq.Tag(errors.Wrap(errListNetworks, err.Error()), "", errorsq.StageRetention))
+		return
+	}
+	l.lock.Lock()
+	retained := make([]models.Network, 0, len(nets))
+	for _, net := range nets {
+		if net.Retention != nil && (net.Status == models.Registered || net.Status == models.Paused) && l.assigned(net.ID) {
+			retained = append(retained, net)
+		}
+	}
+	l.lock.Unlock()
+
+	for i := range retained {
+		if l.ctx.Err() != nil {
+			return
+		}
+		if err := l.retain(&retained[i]); err != nil && l.ctx.Err() == nil {
+			l.errq.Send(errorsq.Tag(err, retained[i].ID, errorsq.StageRetention))
+		}
+	}
+}
+
+// retainFrom returns the first block to keep by retention, 0 if nothing to prune.
+// The latest block is always kept, which listening continues from.
+func (l *listener) retainFrom(nid string, retention *models.Retention, now time.Time) (uint64, error) {
+	latest, err := l.startAt(nid)
+	if err != nil || latest == 0 {
+		return 0, err
+	}
+	from := uint64(1)
+	if retention.Blocks > 0 && latest > retention.Blocks {
+		from = latest - retention.Blocks + 1
+	}
+	if since := retention.Since(now); since > 0 {
+		first, err := l.selector.NetworkBlockSince(nid, since)
+		if err != nil {
+			return 0, err
+		}
+		if first == 0 {
+			first = latest
+		}
+		if first > from {
+			from = first
+		}
+	}
+	return from, nil
+}
+
+// retain prunes history of a network before the first block to keep, and records where its history is truncated.
+// History is recorded truncated before pruning, so that partially pruned history is never reported complete.
+func (l *listener) retain(net *models.Network) error {
+	from, err := l.retainFrom(net.ID, net.Retention, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "find blocks to keep")
+	}
+
+	if from <= 1 {
+		return nil
+	}
+	// batches left by the last interrupted pruning are pruned again, though history is recorded truncated already
+	if net.Retention.HeadersOnly() {
+		if from > net.EarliestPayloadBlockNumber {
+			klog.Infof("Pruning payloads of network %s before block %d", net.ID, from)
+			if err := l.injector.Truncate(net.ID, 0, from); err != nil {
+				return err
+			}
+		}
+		if err := l.prune(func() (int, error) { return l.injector.StripPayloads(net.ID, from, deletionBatchSize) }); err != nil {
+			return err
+		}
+		for _, model := range payloadModels {
+			model := model
+			if err := l.prune(func() (int, error) { return l.injector.PruneNetworkData(net.ID, model, from, deletionBatchSize) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if from > net.EarliestBlockNumber {
+		klog.Infof("Pruning history of network %s before block %d", net.ID, from)
+		if err := l.injector.Truncate(net.ID, from, from); err != nil {
+			return err
+		}
+	}
+	for _, model := range deletionModels {
+		model := model
+		if err := l.prune(func() (int, error) { return l.injector.PruneNetworkData(net.ID, model, from, deletionBatchSize) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune runs batch until nothing left, sleeping between batches like deletion jobs
+func (l *listener) prune(batch func() (int, error)) error {
+	for {
+		n, err := batch()
+		if err != nil || n == 0 {
+			return err
+		}
+		select {
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		case <-time.After(deletionBatchInterval):
+		}
+	}
+}
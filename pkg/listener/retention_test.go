@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// fakeBlockSelector finds blocks in fakeInjector
+type fakeBlockSelector struct {
+	Selector
+	injector *fakeInjector
+}
+
+func (s *fakeBlockSelector) NetworkStartAt(string) (uint64, error) {
+	blocks := s.injector.Blocks()
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+	return blocks[len(blocks)-1].BlockNumber, nil
+}
+
+func (s *fakeBlockSelector) NetworkBlockSince(_ string, createdAt int64) (uint64, error) {
+	for _, blk := range s.injector.Blocks() {
+		if blk.CreatedAt >= createdAt {
+			return blk.BlockNumber, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestRetain(t *testing.T) {
+	deletionBatchSize = 2
+	deletionBatchInterval = time.Millisecond
+
+	now := time.Now()
+	// blocks 1-10 are created one per day, block 10 today
+	newInjector := func() *fakeInjector {
+		injector := &fakeInjector{}
+		for i := uint64(1); i <= 10; i++ {
+			createdAt := now.AddDate(0, 0, int(i)-10).Unix()
+			require.NoError(t, injector.InjectBlocks(&models.Block{BlockNumber: i, CreatedAt: createdAt}))
+			require.NoError(t, injector.InjectTransactions(&models.Transaction{BlockNumber: i, CreatedAt: createdAt, Payload: []byte("payload")}))
+			require.NoError(t, injector.InjectPrivateData(&models.PrivateData{BlockNumber: i}))
+		}
+		return injector
+	}
+	newListener := func(injector *fakeInjector) *listener {
+		return &listener{
+			ctx:      context.Background(),
+			errq:     &fakeErrorsq{},
+			injector: injector,
+			selector: &fakeBlockSelector{injector: injector},
+		}
+	}
+
+	testCases := map[string]struct {
+		retention models.Retention
+		from      uint64
+	}{
+		"blocks":          {retention: models.Retention{Blocks: 4}, from: 7},
+		"days":            {retention: models.Retention{Days: 3}, from: 8},
+		"blocks and days": {retention: models.Retention{Blocks: 4, Days: 5}, from: 7},
+		"latest is kept":  {retention: models.Retention{Days: 1, Blocks: 0}, from: 10},
+		"all kept":        {retention: models.Retention{Blocks: 20}, from: 1},
+	}
+	for name, tc := range testCases {
+		injector := newInjector()
+		l := newListener(injector)
+		from, err := l.retainFrom("network_channel", &tc.retention, now.Add(time.Minute))
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.from, from, name)
+	}
+
+	// blocks before 7 are deleted with their transactions and private data
+	injector := newInjector()
+	l := newListener(injector)
+	require.NoError(t, l.retain(&models.Network{ID: "network_channel", Retention: &models.Retention{Blocks: 4}}))
+	assert.Len(t, injector.Blocks(), 4)
+	assert.Equal(t, uint64(7), injector.Blocks()[0].BlockNumber)
+	assert.Len(t, injector.txs, 4)
+	assert.Len(t, injector.PrivateData(), 4)
+	assert.Equal(t, uint64(7), injector.earliest)
+	assert.Equal(t, uint64(7), injector.earliestPayload)
+
+	// blocks and transactions before 7 are kept without payloads
+	injector = newInjector()
+	l = newListener(injector)
+	require.NoError(t, l.retain(&models.Network{ID: "network_channel", Retention: &models.Retention{Blocks: 4, Mode: models.RetentionHeadersOnly}}))
+	assert.Len(t, injector.Blocks(), 10)
+	for _, tx := range injector.txs {
+		assert.Equal(t, tx.BlockNumber >= 7, tx.Payload != nil, tx.BlockNumber)
+	}
+	assert.Len(t, injector.PrivateData(), 4)
+	assert.Equal(t, uint64(0), injector.earliest)
+	assert.Equal(t, uint64(7), injector.earliestPayload)
+
+	assert.ErrorIs(t, (&models.Retention{}).Validate(), models.ErrInvalidRetention)
+	assert.ErrorIs(t, (&models.Retention{Days: 1, Mode: "Unknown"}).Validate(), models.ErrInvalidRetention)
+}
+
+func TestRetainAll(t *testing.T) {
+	deletionBatchSize = 2
+	deletionBatchInterval = time.Millisecond
+
+	retention := &models.Retention{Blocks: 4}
+	testCases := map[string]struct {
+		net    models.Network
+		pruned bool
+	}{
+		"paused":                      {net: models.Network{ID: "network_channel", Status: models.Paused, Retention: retention}, pruned: true},
+		"registered but not listened": {net: models.Network{ID: "network_channel", Status: models.Registered, Retention: retention}, pruned: true},
+		"deregistered":                {net: models.Network{ID: "network_channel", Status: models.Deregistered, Retention: retention}},
+		"without retention":           {net: models.Network{ID: "network_channel", Status: models.Registered}},
+		"assigned to another":         {net: models.Network{ID: "other_channel", Status: models.Registered, Retention: retention}},
+	}
+	for name, tc := range testCases {
+		store := &fakeNetworkStore{fakeInjector: &fakeInjector{}, nets: map[string]models.Network{}}
+		for i := uint64(1); i <= 10; i++ {
+			require.NoError(t, store.InjectBlocks(&models.Block{BlockNumber: i}))
+		}
+		require.NoError(t, store.InjectNetworks(&tc.net))
+		// replica-0 is the only replica alive, except that other_channel belongs to replica-1
+		replicas := []models.Replica{{ID: "replica-0"}}
+		if tc.net.ID == "other_channel" {
+			replicas = []models.Replica{{ID: "replica-1"}}
+		}
+		l := &listener{
+			ctx:         context.Background(),
+			errq:        &fakeErrorsq{},
+			injector:    store,
+			selector:    store,
+			networks:    map[string]BlockEventListener{},
+			coordinator: &fakeCoordinator{},
+			replicas:    replicas,
+		}
+		l.retainAll()
+		if tc.pruned {
+			assert.Len(t, store.Blocks(), 4, name)
+		} else {
+			assert.Len(t, store.Blocks(), 10, name)
+		}
+	}
+}
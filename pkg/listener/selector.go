@@ -28,6 +28,14 @@ type Selector interface {
 	Networks(fields ...string) ([]models.Network, error)
 	Network(nid string) (*models.Network, error)
 	NetworkStartAt(nid string) (uint64, error)
+	// NetworkBlockSince returns the first block of a network created at or after createdAt, 0 if there isn't
+	NetworkBlockSince(nid string, createdAt int64) (uint64, error)
+	// NetworkDataCount counts rows of blocks, transactions and private data in a network
+	NetworkDataCount(nid string) (int, error)
+	// DeletionJob returns a deletion job by its id
+	DeletionJob(jid string) (*models.DeletionJob, error)
+	// NetworkDeletionJob returns the latest deletion job of a network
+	NetworkDeletionJob(nid string) (*models.DeletionJob, error)
 }
 
 // pqSelector used to select data into postgreSQL
@@ -78,3 +86,42 @@ func (pqstr *pqSelector) NetworkStartAt(nid string) (uint64, error) {
 	}
 	return lastBlock.BlockNumber, nil
 }
+
+func (pqstr *pqSelector) NetworkBlockSince(nid string, createdAt int64) (uint64, error) {
+	var number uint64
+	_, err := pqstr.db.QueryOne(pg.Scan(&number), `select coalesce(min("blockNumber"), 0) from blocks where "network" = ? and "createdAt" >= ?`, nid, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+func (pqstr *pqSelector) NetworkDataCount(nid string) (int, error) {
+	var total int
+	for _, model := range deletionModels {
+		count, err := pqstr.db.Model(model).Where(`"network" = ?`, nid).Count()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func (pqstr *pqSelector) DeletionJob(jid string) (*models.DeletionJob, error) {
+	var job = new(models.DeletionJob)
+	_, err := pqstr.db.QueryOne(job, `select * from deletion_jobs where "id" = ?;`, jid)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (pqstr *pqSelector) NetworkDeletionJob(nid string) (*models.DeletionJob, error) {
+	var job = new(models.DeletionJob)
+	_, err := pqstr.db.QueryOne(job, `select * from deletion_jobs where "network" = ? order by "startedAt" desc limit 1;`, nid)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
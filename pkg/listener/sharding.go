@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	errForwardFailed       = errors.New("failed to forward request to owner replica")
+	errForwardInsecure     = errors.New("request carrying secrets is only forwarded over https")
+	errForwardUnauthorized = errors.New("forwarded request is not signed by a replica")
+)
+
+const (
+	// ForwardedHeader marks a request forwarded by another replica, which won't be forwarded again
+	ForwardedHeader = "X-Bc-Explorer-Forwarded-By"
+	// ForwardSignatureHeader authenticates a forwarded request by `{unix timestamp}:{hex(hmac-sha256)}`,
+	// signed by the secret shared by replicas
+	ForwardSignatureHeader = "X-Bc-Explorer-Forward-Signature"
+)
+
+var (
+	forwardClient = &http.Client{Timeout: 60 * time.Second}
+	// maxForwardAge limits how long a signed request is accepted, so it can't be replayed later
+	maxForwardAge = time.Minute
+)
+
+// Forwarding configures how requests are forwarded between replicas
+type Forwarding struct {
+	// Secret is shared by replicas to sign forwarded requests, no request is forwarded if it's empty
+	Secret []byte
+	// Client sends forwarded requests, which trusts certificates of other replicas. Defaults to forwardClient.
+	Client *http.Client
+}
+
+// assign picks the replica a network belongs to by rendezvous hashing,
+// so only networks of the replica joining or leaving are moved.
+func assign(nid string, replicas []models.Replica) (models.Replica, bool) {
+	var owner models.Replica
+	var highest uint64
+	found := false
+	for _, replica := range replicas {
+		sum := sha256.Sum256([]byte(replica.ID + "\x00" + nid))
+		score := binary.BigEndian.Uint64(sum[:8])
+		if !found || score > highest || (score == highest && replica.ID < owner.ID) {
+			owner, highest, found = replica, score, true
+		}
+	}
+	return owner, found
+}
+
+// assigned checks whether a network belongs to this replica.
+// It's always true if there is no coordinator or no replica is known yet.
+func (l *listener) assigned(nid string) bool {
+	if l.coordinator == nil {
+		return true
+	}
+	owner, ok := assign(nid, l.replicas)
+	return !ok || owner.ID == l.coordinator.Identity()
+}
+
+func (l *listener) Identity() string {
+	if l.coordinator != nil {
+		return l.coordinator.Identity()
+	}
+	return l.identity
+}
+
+// Owner returns the replica a network belongs to, and whether it's this replica
+func (l *listener) Owner(nid string) (models.Replica, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.coordinator == nil {
+		return models.Replica{ID: l.identity}, true
+	}
+	owner, ok := assign(nid, l.replicas)
+	if !ok {
+		return models.Replica{ID: l.coordinator.Identity()}, true
+	}
+	return owner, owner.ID == l.coordinator.Identity()
+}
+
+// forward sends a request to another replica, and returns its status code, content type and body.
+// Requests with a body, such as network profiles, or with user credentials are only sent over https.
+func forward(f Forwarding, owner models.Replica, self string, method string, uri string, header map[string]string, body []byte) (int, string, []byte, error) {
+	if owner.Address == "" {
+		return 0, "", nil, errors.Wrapf(errForwardFailed, "replica %s has no address", owner.ID)
+	}
+	if (len(body) > 0 || header["Authorization"] != "") && !strings.HasPrefix(owner.Address, "https://") {
+		return 0, "", nil, errors.Wrapf(errForwardInsecure, "replica %s at %s", owner.ID, owner.Address)
+	}
+	klog.V(5).Infof("Forward %s %s to replica %s", method, uri, owner.ID)
+	req, err := http.NewRequest(method, owner.Address+uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", nil, errors.Wrap(errForwardFailed, err.Error())
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(ForwardedHeader, self)
+	req.Header.Set(ForwardSignatureHeader, signForward(f.Secret, time.Now().Unix(), self, method, uri, body))
+	client := f.Client
+	if client == nil {
+		client = forwardClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", nil, errors.Wrap(errForwardFailed, err.Error())
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", nil, errors.Wrap(errForwardFailed, err.Error())
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), respBody, nil
+}
+
+// signForward signs the replica forwarding a request, the request and when it's forwarded
+func signForward(secret []byte, timestamp int64, by string, method string, uri string, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n%x", timestamp, by, method, uri, digest)
+	return fmt.Sprintf("%d:%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// verifyForward checks a forwarded request is signed by a replica sharing the secret within maxForwardAge
+func verifyForward(secret []byte, signature string, by string, method string, uri string, body []byte) error {
+	if len(secret) == 0 {
+		return errors.Wrap(errForwardUnauthorized, "no forward secret configured")
+	}
+	ts, _, ok := strings.Cut(signature, ":")
+	if !ok {
+		return errors.Wrap(errForwardUnauthorized, "malformed signature")
+	}
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.Wrap(errForwardUnauthorized, "malformed signature")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > maxForwardAge || age < -maxForwardAge {
+		return errors.Wrapf(errForwardUnauthorized, "signature expired")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signForward(secret, timestamp, by, method, uri, body))) {
+		return errors.Wrap(errForwardUnauthorized, "invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestAssign(t *testing.T) {
+	replicas := []models.Replica{{ID: "replica-0"}, {ID: "replica-1"}, {ID: "replica-2"}}
+	before := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		nid := fmt.Sprintf("network_channel%d", i)
+		owner, ok := assign(nid, replicas)
+		require.True(t, ok)
+		before[nid] = owner.ID
+		counts[owner.ID]++
+	}
+	// networks are spread over all replicas
+	for _, replica := range replicas {
+		assert.Greater(t, counts[replica.ID], 50, replica.ID)
+	}
+
+	// only networks of the leaving replica move
+	for nid, previous := range before {
+		owner, _ := assign(nid, replicas[:2])
+		if previous != "replica-2" {
+			assert.Equal(t, previous, owner.ID, nid)
+		}
+	}
+
+	_, ok := assign("network_channel", nil)
+	assert.False(t, ok)
+}
+
+func TestForward(t *testing.T) {
+	f := Forwarding{Secret: []byte("secret")}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/network/register?dryRun=true", r.URL.RequestURI())
+		assert.Equal(t, "replica-0", r.Header.Get(ForwardedHeader))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, verifyForward(f.Secret, r.Header.Get(ForwardSignatureHeader), "replica-0", r.Method, r.URL.RequestURI(), body))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	f.Client = server.Client()
+
+	status, contentType, body, err := forward(f, models.Replica{ID: "replica-1", Address: server.URL}, "replica-0",
+		http.MethodPost, "/network/register?dryRun=true", map[string]string{"Authorization": "Bearer token"}, []byte(`{"id":"network"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, `{"id":"network"}`, string(body))
+
+	_, _, _, err = forward(f, models.Replica{ID: "replica-1"}, "replica-0", http.MethodPost, "/", nil, nil)
+	assert.ErrorIs(t, err, errForwardFailed)
+
+	// profiles and credentials are not sent in cleartext
+	_, _, _, err = forward(f, models.Replica{ID: "replica-1", Address: "http://replica-1"}, "replica-0",
+		http.MethodPost, "/network/register", nil, []byte(`{"id":"network"}`))
+	assert.ErrorIs(t, err, errForwardInsecure)
+	_, _, _, err = forward(f, models.Replica{ID: "replica-1", Address: "http://replica-1"}, "replica-0",
+		http.MethodPost, "/network/pause/network", map[string]string{"Authorization": "Bearer token"}, nil)
+	assert.ErrorIs(t, err, errForwardInsecure)
+}
+
+func TestVerifyForward(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now().Unix()
+	signature := signForward(secret, now, "replica-0", http.MethodPost, "/network/pause/network", nil)
+	assert.NoError(t, verifyForward(secret, signature, "replica-0", http.MethodPost, "/network/pause/network", nil))
+
+	for name, err := range map[string]error{
+		"no secret":       verifyForward(nil, signature, "replica-0", http.MethodPost, "/network/pause/network", nil),
+		"wrong secret":    verifyForward([]byte("other"), signature, "replica-0", http.MethodPost, "/network/pause/network", nil),
+		"other replica":   verifyForward(secret, signature, "replica-1", http.MethodPost, "/network/pause/network", nil),
+		"other request":   verifyForward(secret, signature, "replica-0", http.MethodPost, "/network/resume/network", nil),
+		"other body":      verifyForward(secret, signature, "replica-0", http.MethodPost, "/network/pause/network", []byte("{}")),
+		"no signature":    verifyForward(secret, "", "replica-0", http.MethodPost, "/network/pause/network", nil),
+		"forged":          verifyForward(secret, fmt.Sprintf("%d:00", now), "replica-0", http.MethodPost, "/network/pause/network", nil),
+		"expired":         verifyForward(secret, signForward(secret, now-120, "replica-0", http.MethodPost, "/network/pause/network", nil), "replica-0", http.MethodPost, "/network/pause/network", nil),
+		"malformed stamp": verifyForward(secret, "now:00", "replica-0", http.MethodPost, "/network/pause/network", nil),
+	} {
+		assert.ErrorIs(t, err, errForwardUnauthorized, name)
+	}
+}
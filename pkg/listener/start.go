@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+var (
+	errInvalidStartPosition = errors.New("invalid start position")
+)
+
+// StartPosition defines where a new network starts to be listened
+type StartPosition string
+
+const (
+	// StartFromOldest starts from the genesis block
+	StartFromOldest StartPosition = "oldest"
+	// StartFromNewest starts from the latest block on the ledger
+	StartFromNewest StartPosition = "newest"
+	// StartFromNumber starts from a specific block number
+	StartFromNumber StartPosition = "number"
+	// StartFromTimestamp starts from the first block created at or after a timestamp
+	StartFromTimestamp StartPosition = "timestamp"
+)
+
+// Start is where a new network starts to be listened.
+// It takes no effect on networks which already have stored blocks.
+type Start struct {
+	Position StartPosition
+	// Block is the fabric block number which starts from 0, used by StartFromNumber
+	Block uint64
+	// Timestamp is unix seconds, used by StartFromTimestamp
+	Timestamp int64
+}
+
+func (s Start) Validate() error {
+	switch s.Position {
+	case "", StartFromOldest, StartFromNewest, StartFromNumber:
+		return nil
+	case StartFromTimestamp:
+		if s.Timestamp <= 0 {
+			return errors.Wrap(errInvalidStartPosition, "timestamp must be positive")
+		}
+		return nil
+	default:
+		return errors.Wrapf(errInvalidStartPosition, "unknown position %s", s.Position)
+	}
+}
+
+// resolve returns the fabric block number to start from, by asking the first available peer if needed
+func (s Start) resolve(ctx context.Context, endpoints []network.NodeEndpoint, dial fabPeerDialer) (uint64, error) {
+	if err := s.Validate(); err != nil {
+		return 0, err
+	}
+	if s.Position == "" || s.Position == StartFromOldest {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	var err error
+	for _, endpoint := range endpoints {
+		var conn fabPeer
+		conn, err = dial(endpoint)
+		if err != nil {
+			continue
+		}
+		var number uint64
+		number, err = s.resolveOn(ctx, conn)
+		conn.Close()
+		if err == nil || errors.Is(err, errInvalidStartPosition) {
+			return number, err
+		}
+		klog.Warningf("Failed to resolve start position on peer %s: %s", endpoint.URL, err.Error())
+	}
+	if err == nil {
+		err = errAllPeersUnavailable
+	}
+	return 0, err
+}
+
+func (s Start) resolveOn(ctx context.Context, conn fabPeer) (uint64, error) {
+	height, err := conn.Height(ctx)
+	if err != nil {
+		return 0, err
+	}
+	switch s.Position {
+	case StartFromNewest:
+		if height == 0 {
+			return 0, nil
+		}
+		return height - 1, nil
+	case StartFromNumber:
+		if s.Block >= height {
+			return 0, errors.Wrapf(errInvalidStartPosition, "block %d is beyond ledger height %d", s.Block, height)
+		}
+		return s.Block, nil
+	default:
+		// binary search the first block created at or after timestamp, blocks are in time order
+		var searchErr error
+		number := sort.Search(int(height), func(i int) bool {
+			if searchErr != nil {
+				return true
+			}
+			var block *common.Block
+			block, searchErr = conn.BlockByNumber(ctx, uint64(i))
+			if searchErr != nil {
+				return true
+			}
+			var createdAt int64
+			createdAt, searchErr = blockTime(block)
+			return createdAt >= s.Timestamp
+		})
+		if searchErr != nil {
+			return 0, searchErr
+		}
+		return uint64(number), nil
+	}
+}
+
+// blockTime returns when the block's first transaction was created
+func blockTime(block *common.Block) (int64, error) {
+	if len(block.GetData().GetData()) == 0 {
+		return 0, errors.Wrapf(errInvalidFabTx, "block %d has no transaction", block.GetHeader().GetNumber())
+	}
+	env, err := protoutil.UnmarshalEnvelope(block.Data.Data[0])
+	if err != nil {
+		return 0, err
+	}
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return 0, err
+	}
+	chdr, err := protoutil.UnmarshalChannelHeader(payload.GetHeader().GetChannelHeader())
+	if err != nil {
+		return 0, err
+	}
+	return chdr.GetTimestamp().AsTime().Unix(), nil
+}
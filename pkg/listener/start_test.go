@@ -0,0 +1,77 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bestchains/bc-explorer/pkg/network"
+)
+
+func newTimedBlock(t *testing.T, number uint64, createdAt int64) *common.Block {
+	chdr := &common.ChannelHeader{Timestamp: timestamppb.New(time.Unix(createdAt, 0))}
+	payload := &common.Payload{Header: &common.Header{ChannelHeader: mustMarshal(t, chdr)}}
+	env := &common.Envelope{Payload: mustMarshal(t, payload)}
+	return &common.Block{
+		Header: &common.BlockHeader{Number: number},
+		Data:   &common.BlockData{Data: [][]byte{mustMarshal(t, env)}},
+	}
+}
+
+func TestResolveStart(t *testing.T) {
+	// blocks are created every 10 seconds from 1000
+	peer0 := newFakePeer(5)
+	for i := uint64(0); i < 5; i++ {
+		peer0.ledger = append(peer0.ledger, newTimedBlock(t, i, 1000+int64(i)*10))
+	}
+	endpoints := []network.NodeEndpoint{{URL: "peer0"}}
+	dial := fakeDialer(map[string]*fakePeer{"peer0": peer0})
+
+	cases := []struct {
+		start    Start
+		expected uint64
+	}{
+		{Start{}, 0},
+		{Start{Position: StartFromOldest}, 0},
+		{Start{Position: StartFromNewest}, 4},
+		{Start{Position: StartFromNumber, Block: 3}, 3},
+		{Start{Position: StartFromTimestamp, Timestamp: 1000}, 0},
+		{Start{Position: StartFromTimestamp, Timestamp: 1015}, 2},
+		{Start{Position: StartFromTimestamp, Timestamp: 1040}, 4},
+		// later than all blocks, start from the next block
+		{Start{Position: StartFromTimestamp, Timestamp: 2000}, 5},
+	}
+	for _, c := range cases {
+		number, err := c.start.resolve(context.Background(), endpoints, dial)
+		require.NoError(t, err, c.start)
+		assert.Equal(t, c.expected, number, c.start)
+	}
+
+	_, err := Start{Position: StartFromNumber, Block: 5}.resolve(context.Background(), endpoints, dial)
+	assert.ErrorIs(t, err, errInvalidStartPosition)
+	_, err = Start{Position: "latest"}.resolve(context.Background(), endpoints, dial)
+	assert.ErrorIs(t, err, errInvalidStartPosition)
+	_, err = Start{Position: StartFromNewest}.resolve(context.Background(), endpoints, fakeDialer(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exposes prometheus metrics shared by bc-explorer services
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes all metrics of bc-explorer
+const Namespace = "bc_explorer"
+
+// Path is where metrics are served
+const Path = "/metrics"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests by route and status code.",
+	}, []string{"service", "method", "route", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "route"})
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database queries by the http route issuing them.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route"})
+)
+
+// Handler serves metrics on fiber
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// Serve serves metrics on addr until ctx is done, for services without a http server
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// HTTP counts requests of a service and observes their latency by route
+func HTTP(service string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		// route is the matched route after handlers run, which keeps labels bounded
+		route := c.Route().Path
+		code := c.Response().StatusCode()
+		if fe, ok := err.(*fiber.Error); ok {
+			code = fe.Code
+		} else if err != nil {
+			code = fiber.StatusInternalServerError
+		}
+		httpRequests.WithLabelValues(service, c.Method(), route, strconv.Itoa(code)).Inc()
+		httpDuration.WithLabelValues(service, c.Method(), route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+type routeKey struct{}
+
+// WithRoute attaches the http route to ctx, queries with ctx are observed under this route
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// Route returns the http route attached to ctx, `none` if there isn't
+func Route(ctx context.Context) string {
+	if route, ok := ctx.Value(routeKey{}).(string); ok {
+		return route
+	}
+	return "none"
+}
+
+// QueryHook observes duration of database queries by route attached to query context
+type QueryHook struct{}
+
+var _ pg.QueryHook = QueryHook{}
+
+func (QueryHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (QueryHook) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	dbDuration.WithLabelValues(Route(ctx)).Observe(time.Since(event.StartTime).Seconds())
+	return nil
+}
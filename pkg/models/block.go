@@ -20,11 +20,16 @@ import (
 	"context"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"k8s.io/klog/v2"
 )
 
 const BlockTableName = "blocks"
 
+// FilteredBlockUnavailableFields are block fields which filtered block events do not deliver.
+// `createdAt` of a filtered block is the time when listener received it.
+var FilteredBlockUnavailableFields = []string{"blockHash", "preBlockHash", "dataHash", "createdAt", "blockSize"}
+
 type Block struct {
 	BlockHash         string `pg:"blockHash,pk" json:"blockHash"`
 	Network           string `pg:"network" json:"network"`
@@ -34,6 +39,19 @@ type Block struct {
 	CreatedAt         int64  `pg:"createdAt" json:"createdAt"`
 	BlockSize         int    `pg:"blockSize" json:"blockSize"`
 	TxCount           int    `pg:"txCount" json:"txCount"`
+
+	// Filtered is true if this block comes from filtered block events
+	Filtered          bool     `pg:"filtered" json:"filtered,omitempty"`
+	UnavailableFields []string `pg:"-" json:"unavailableFields,omitempty"`
+}
+
+var _ orm.AfterScanHook = (*Block)(nil)
+
+func (b *Block) AfterScan(ctx context.Context) error {
+	if b.Filtered {
+		b.UnavailableFields = FilteredBlockUnavailableFields
+	}
+	return nil
 }
 
 var _ pg.QueryHook = (*Block)(nil)
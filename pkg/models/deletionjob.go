@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "Running"
+	JobSucceeded JobStatus = "Succeeded"
+	JobFailed    JobStatus = "Failed"
+)
+
+// DeletionJob deletes all data of a network in batches.
+// Its progress is stored so any replica can report it, and an interrupted job is continued after restart.
+type DeletionJob struct {
+	ID      string    `pg:"id,pk" json:"id"`
+	Network string    `pg:"network" json:"network"`
+	Status  JobStatus `pg:"status" json:"status"`
+	// Total is the number of rows to delete when the job starts
+	Total   int `pg:"total,use_zero" json:"total"`
+	Deleted int `pg:"deleted,use_zero" json:"deleted"`
+
+	StartedAt  int64  `pg:"startedAt" json:"startedAt"`
+	FinishedAt int64  `pg:"finishedAt" json:"finishedAt,omitempty"`
+	Error      string `pg:"error" json:"error,omitempty"`
+}
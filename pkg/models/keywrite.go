@@ -0,0 +1,59 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// KeyWrite is a write to a key of a chaincode by a valid transaction, which makes up history of the key.
+// Writes of invalid transactions never change states, so they are not kept.
+type KeyWrite struct {
+	tableName struct{} `pg:"key_writes"` //nolint:unused
+
+	Network   string `pg:"network,pk" json:"network"`
+	Namespace string `pg:"namespace,pk" json:"namespace"`
+	Key       string `pg:"key,pk" json:"key"`
+	// BlockNumber and TxIndex are the position of the transaction, which orders writes to a key
+	BlockNumber uint64 `pg:"blockNumber,pk" json:"blockNumber"`
+	TxIndex     int    `pg:"txIndex,pk,use_zero" json:"txIndex"`
+	TxID        string `pg:"txId" json:"txId"`
+	CreatedAt   int64  `pg:"createdAt" json:"createdAt"`
+	// Value is bytes, since values of chaincodes might not be valid text
+	Value    []byte `pg:"value" json:"value,omitempty"`
+	IsDelete bool   `pg:"isDelete,use_zero" json:"isDelete,omitempty"`
+}
+
+// KeyWrites returns writes of a valid endorser transaction, which are empty for others
+func KeyWrites(tx *Transaction, rwsets []FabRWSet) []*KeyWrite {
+	if tx.Type != EndorserTransaction || tx.ValidationCode != 0 {
+		return nil
+	}
+	writes := make([]*KeyWrite, 0)
+	for _, rwset := range rwsets {
+		for _, write := range rwset.Writes {
+			writes = append(writes, &KeyWrite{
+				Network:     tx.Network,
+				Namespace:   rwset.Namespace,
+				Key:         write.Key,
+				BlockNumber: tx.BlockNumber,
+				TxIndex:     tx.TxIndex,
+				TxID:        tx.ID,
+				CreatedAt:   tx.CreatedAt,
+				Value:       []byte(write.Value),
+				IsDelete:    write.IsDelete,
+			})
+		}
+	}
+	return writes
+}
@@ -0,0 +1,27 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "time"
+
+// Lease records which listener replica owns a network
+type Lease struct {
+	// ID is the network id
+	ID        string    `pg:"id,pk" json:"network"`
+	Holder    string    `pg:"holder" json:"holder"`
+	ExpiresAt time.Time `pg:"expiresAt" json:"expiresAt"`
+}
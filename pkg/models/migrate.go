@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// Latest is the target version to migrate up to all migrations
+const Latest = -1
+
+// migrationLock serializes schema changes of replicas sharing a database with a postgreSQL advisory lock
+const migrationLock = 4273105918
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrUnknownVersion   = errors.New("unknown schema version")
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFile is `{version}_{name}.{up|down}.sql`
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration changes the schema from version-1 to version with Up, and back with Down
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String prints a migration as `{version}_{name}`
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// SchemaMigration is an applied migration, the max version applied is the schema version
+type SchemaMigration struct {
+	tableName struct{} `pg:"schema_migrations"` //nolint:unused
+
+	Version   int       `pg:"version,pk" json:"version"`
+	Name      string    `pg:"name" json:"name"`
+	AppliedAt time.Time `pg:"appliedAt" json:"appliedAt"`
+}
+
+// Migrations returns all migrations ordered by version
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := migrationFile.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, errors.Wrapf(ErrInvalidMigration, "unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(matches[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, errors.Wrapf(ErrInvalidMigration, "version %d is named both %s and %s", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, errors.Wrapf(ErrInvalidMigration, "version %d is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Wrapf(ErrInvalidMigration, "version %d lacks up or down", m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns applied migrations, the latest first
+func SchemaVersion(ctx context.Context, db *pg.DB) ([]SchemaMigration, error) {
+	var applied []SchemaMigration
+	err := db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := lockSchema(ctx, tx); err != nil {
+			return err
+		}
+		return tx.ModelContext(ctx, &applied).Order("version DESC").Select()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Migrate migrates the schema up or down to target version, Latest for all migrations.
+// Each migration runs in a transaction holding an advisory lock, so replicas starting together migrate only once.
+// It returns the schema version before and after migrating.
+func Migrate(ctx context.Context, db *pg.DB, target int) (int, int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if target == Latest {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return 0, 0, errors.Wrapf(ErrUnknownVersion, "target %d", target)
+	}
+
+	from, current := -1, 0
+	for {
+		var done bool
+		err := db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			if err := lockSchema(ctx, tx); err != nil {
+				return err
+			}
+			// read in the transaction since another replica may have migrated while waiting for the lock
+			var err error
+			current, err = currentVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if from < 0 {
+				from = current
+			}
+			switch {
+			case current > len(migrations):
+				return errors.Wrapf(ErrUnknownVersion, "database is at version %d, newer than this binary", current)
+			case current < target:
+				m := migrations[current]
+				klog.Infof("Migrating schema up to %s", m)
+				if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+					return errors.Wrapf(err, "migrate up to %s", m)
+				}
+				_, err = tx.ModelContext(ctx, &SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Insert()
+				if err != nil {
+					return err
+				}
+				current = m.Version
+				return nil
+			case current > target:
+				m := migrations[current-1]
+				klog.Infof("Migrating schema down from %s", m)
+				if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+					return errors.Wrapf(err, "migrate down from %s", m)
+				}
+				_, err = tx.ModelContext(ctx, &SchemaMigration{Version: m.Version}).WherePK().Delete()
+				if err != nil {
+					return err
+				}
+				current = m.Version - 1
+				return nil
+			default:
+				done = true
+				return nil
+			}
+		})
+		if from < 0 {
+			from = 0
+		}
+		if err != nil || done {
+			return from, current, err
+		}
+	}
+}
+
+// lockSchema holds the advisory lock until the transaction ends, and creates the version table if not exists
+func lockSchema(ctx context.Context, tx *pg.Tx) error {
+	if err := advisoryLock(ctx, tx); err != nil {
+		return err
+	}
+	return createSchemaMigrations(ctx, tx)
+}
+
+// advisoryLock holds the lock of schema changes until the transaction ends
+func advisoryLock(ctx context.Context, tx *pg.Tx) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(?)`, migrationLock)
+	return err
+}
+
+func createSchemaMigrations(ctx context.Context, tx *pg.Tx) error {
+	_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS "schema_migrations" ("version" integer, "name" text, "appliedAt" timestamptz, PRIMARY KEY ("version"))`)
+	return err
+}
+
+func currentVersion(ctx context.Context, tx *pg.Tx) (int, error) {
+	var version int
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&version), `SELECT coalesce(max("version"), 0) FROM "schema_migrations"`); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
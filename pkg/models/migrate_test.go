@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Up, m.String())
+		assert.NotEmpty(t, m.Down, m.String())
+	}
+	assert.Equal(t, "0001_init", migrations[0].String())
+
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+	testCases := map[string]fstest.MapFS{
+		"missing version": {
+			"m/0001_a.up.sql": file("a"), "m/0001_a.down.sql": file("a"),
+			"m/0003_c.up.sql": file("c"), "m/0003_c.down.sql": file("c"),
+		},
+		"missing down": {
+			"m/0001_a.up.sql": file("a"),
+		},
+		"conflicting names": {
+			"m/0001_a.up.sql": file("a"), "m/0001_b.down.sql": file("b"),
+		},
+		"unexpected file": {
+			"m/0001_a.up.sql": file("a"), "m/0001_a.down.sql": file("a"), "m/README.md": file(""),
+		},
+	}
+	for name, fsys := range testCases {
+		_, err := loadMigrations(fsys, "m")
+		assert.True(t, errors.Is(err, ErrInvalidMigration), name)
+	}
+
+	migrations, err = loadMigrations(fstest.MapFS{
+		"m/0002_b.down.sql": file("drop b"), "m/0002_b.up.sql": file("create b"),
+		"m/0001_a.down.sql": file("drop a"), "m/0001_a.up.sql": file("create a"),
+	}, "m")
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "a", Up: "create a", Down: "drop a"},
+		{Version: 2, Name: "b", Up: "create b", Down: "drop b"},
+	}, migrations)
+}
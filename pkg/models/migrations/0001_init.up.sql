@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS "networks" (
+    "id" text,
+    "type" text,
+    "platform" text,
+    "profile" bytea,
+    "status" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "blocks" (
+    "blockHash" text,
+    "network" text,
+    "blockNumber" bigint,
+    "preBlockHash" text,
+    "dataHash" text,
+    "createdAt" bigint,
+    "blockSize" bigint,
+    "txCount" bigint,
+    PRIMARY KEY ("blockHash")
+);
+
+CREATE TABLE IF NOT EXISTS "transactions" (
+    "id" text,
+    "network" text,
+    "blockNumber" bigint,
+    "createdAt" bigint,
+    "creator" text,
+    "type" text,
+    "payload" bytea,
+    "chaincodeId" text,
+    "method" text,
+    "args" jsonb,
+    "validationCode" integer,
+    PRIMARY KEY ("id")
+);
@@ -0,0 +1,3 @@
+ALTER TABLE "transactions" DROP COLUMN IF EXISTS "filtered";
+ALTER TABLE "transactions" DROP COLUMN IF EXISTS "events";
+ALTER TABLE "blocks" DROP COLUMN IF EXISTS "filtered";
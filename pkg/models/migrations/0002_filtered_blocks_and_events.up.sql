@@ -0,0 +1,3 @@
+ALTER TABLE "blocks" ADD COLUMN IF NOT EXISTS "filtered" boolean;
+ALTER TABLE "transactions" ADD COLUMN IF NOT EXISTS "events" jsonb;
+ALTER TABLE "transactions" ADD COLUMN IF NOT EXISTS "filtered" boolean;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "private_data" (
+    "id" text,
+    "network" text,
+    "blockNumber" bigint,
+    "txId" text,
+    "namespace" text,
+    "collection" text,
+    "pvtRwSetHash" text,
+    "writes" jsonb,
+    PRIMARY KEY ("id")
+);
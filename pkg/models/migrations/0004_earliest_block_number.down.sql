@@ -0,0 +1 @@
+ALTER TABLE "networks" DROP COLUMN IF EXISTS "earliestBlockNumber";
@@ -0,0 +1 @@
+ALTER TABLE "networks" ADD COLUMN IF NOT EXISTS "earliestBlockNumber" bigint;
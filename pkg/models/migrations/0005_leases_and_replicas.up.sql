@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS "leases" (
+    "id" text,
+    "holder" text,
+    "expiresAt" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "replicas" (
+    "id" text,
+    "address" text,
+    "heartbeatAt" timestamptz,
+    PRIMARY KEY ("id")
+);
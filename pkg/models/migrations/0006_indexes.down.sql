@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS "private_data_network_block_number_idx";
+DROP INDEX IF EXISTS "transactions_network_creator_idx";
+DROP INDEX IF EXISTS "transactions_network_created_at_idx";
+DROP INDEX IF EXISTS "transactions_network_block_number_idx";
+DROP INDEX IF EXISTS "blocks_network_created_at_idx";
+DROP INDEX IF EXISTS "blocks_network_block_number_key";
@@ -0,0 +1,12 @@
+-- blocks stored twice by listeners before the unique index are dropped, keeping one of them
+DELETE FROM "blocks" a USING "blocks" b
+WHERE a."network" = b."network" AND a."blockNumber" = b."blockNumber" AND a.ctid < b.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "blocks_network_block_number_key" ON "blocks" ("network", "blockNumber");
+CREATE INDEX IF NOT EXISTS "blocks_network_created_at_idx" ON "blocks" ("network", "createdAt");
+
+CREATE INDEX IF NOT EXISTS "transactions_network_block_number_idx" ON "transactions" ("network", "blockNumber");
+CREATE INDEX IF NOT EXISTS "transactions_network_created_at_idx" ON "transactions" ("network", "createdAt");
+CREATE INDEX IF NOT EXISTS "transactions_network_creator_idx" ON "transactions" ("network", "creator");
+
+CREATE INDEX IF NOT EXISTS "private_data_network_block_number_idx" ON "private_data" ("network", "blockNumber");
@@ -0,0 +1,2 @@
+ALTER TABLE "networks" DROP COLUMN IF EXISTS "earliestPayloadBlockNumber";
+ALTER TABLE "networks" DROP COLUMN IF EXISTS "retention";
@@ -0,0 +1,2 @@
+ALTER TABLE "networks" ADD COLUMN IF NOT EXISTS "retention" jsonb;
+ALTER TABLE "networks" ADD COLUMN IF NOT EXISTS "earliestPayloadBlockNumber" bigint;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS "raw_blocks" (
+    "network" text,
+    "blockNumber" bigint,
+    "hash" text,
+    "data" bytea,
+    PRIMARY KEY ("network", "blockNumber")
+);
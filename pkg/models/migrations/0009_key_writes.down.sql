@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "key_writes";
+
+ALTER TABLE "transactions" DROP COLUMN IF EXISTS "txIndex";
@@ -0,0 +1,16 @@
+ALTER TABLE "transactions" ADD COLUMN IF NOT EXISTS "txIndex" integer;
+
+CREATE TABLE IF NOT EXISTS "key_writes" (
+    "network" text,
+    "namespace" text,
+    "key" text,
+    "blockNumber" bigint,
+    "txIndex" integer,
+    "txId" text,
+    "createdAt" bigint,
+    "value" bytea,
+    "isDelete" boolean,
+    PRIMARY KEY ("network", "namespace", "key", "blockNumber", "txIndex")
+);
+CREATE INDEX IF NOT EXISTS "key_writes_network_block_number_idx" ON "key_writes" ("network", "blockNumber");
+CREATE INDEX IF NOT EXISTS "key_writes_network_tx_id_idx" ON "key_writes" ("network", "txId");
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "deletion_jobs";
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "deletion_jobs" (
+    "id" text PRIMARY KEY,
+    "network" text,
+    "status" text,
+    "total" bigint,
+    "deleted" bigint,
+    "startedAt" bigint,
+    "finishedAt" bigint,
+    "error" text
+);
+CREATE INDEX IF NOT EXISTS "deletion_jobs_network_started_at_idx" ON "deletion_jobs" ("network", "startedAt");
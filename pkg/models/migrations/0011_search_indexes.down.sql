@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "transactions_network_chaincode_id_idx";
+DROP INDEX IF EXISTS "key_writes_network_key_idx";
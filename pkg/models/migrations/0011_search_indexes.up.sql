@@ -0,0 +1,4 @@
+-- keys are searched without their namespaces, which the primary key of key_writes starts with
+CREATE INDEX IF NOT EXISTS "key_writes_network_key_idx" ON "key_writes" ("network", "key");
+-- chaincodes are searched by name, which prefixes chaincodeId {name}_{version}, so LIKE needs text_pattern_ops
+CREATE INDEX IF NOT EXISTS "transactions_network_chaincode_id_idx" ON "transactions" ("network", "chaincodeId" text_pattern_ops);
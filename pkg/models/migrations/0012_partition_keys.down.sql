@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "transaction_keys";
+DROP TABLE IF EXISTS "block_keys";
@@ -0,0 +1,12 @@
+-- keys of blocks and transactions, which keep them unique once tables are partitioned
+CREATE TABLE IF NOT EXISTS "block_keys" (
+    "network" text,
+    "blockNumber" bigint,
+    PRIMARY KEY ("network", "blockNumber")
+);
+
+CREATE TABLE IF NOT EXISTS "transaction_keys" (
+    "network" text,
+    "id" text,
+    PRIMARY KEY ("network", "id")
+);
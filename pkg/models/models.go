@@ -17,26 +17,13 @@ limitations under the License.
 package models
 
 import (
-	"github.com/go-pg/pg/v10"
-	"github.com/go-pg/pg/v10/orm"
-)
+	"context"
 
-var (
-	models = []interface{}{
-		(*Network)(nil),
-		(*Block)(nil),
-		(*Transaction)(nil),
-	}
+	"github.com/go-pg/pg/v10"
 )
 
+// Init migrates the schema up to the latest version
 func Init(pgdb *pg.DB) error {
-	for _, model := range models {
-		err := pgdb.Model(model).CreateTable(&orm.CreateTableOptions{
-			IfNotExists: true,
-		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	_, _, err := Migrate(context.Background(), pgdb, Latest)
+	return err
 }
@@ -21,12 +21,25 @@ type Status string
 const (
 	Registered   Status = "Registered"
 	Deregistered Status = "Deregistered"
+	// Paused network stops being listened until it is resumed
+	Paused Status = "Paused"
+	// Deleting network is being deleted along with all its data
+	Deleting Status = "Deleting"
 )
 
 type Network struct {
 	ID       string `pg:"id,pk" json:"id"`
 	Type     string `pg:"type" json:"type"`
 	Platform string `pg:"platform" json:"platform"`
-	Profile  []byte `pg:"profile" json:"profile,omitempty"`
-	Status   Status `pg:"status" json:"status,omitempty"`
+	// Profile might be encrypted and must never be returned by APIs
+	Profile []byte `pg:"profile" json:"-"`
+	Status  Status `pg:"status" json:"status,omitempty"`
+	// EarliestBlockNumber is the first block indexed, blocks before it are unavailable.
+	// It starts from 1, the same as Block.BlockNumber.
+	EarliestBlockNumber uint64 `pg:"earliestBlockNumber" json:"earliestBlockNumber,omitempty"`
+	// EarliestPayloadBlockNumber is the first block whose transactions keep payloads,
+	// payloads before it are dropped by retention with mode HeadersOnly.
+	EarliestPayloadBlockNumber uint64 `pg:"earliestPayloadBlockNumber" json:"earliestPayloadBlockNumber,omitempty"`
+	// Retention limits history kept of the network, nil keeps all
+	Retention *Retention `pg:"retention" json:"retention,omitempty"`
 }
@@ -0,0 +1,414 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var ErrInvalidPartitionInterval = errors.New("partition interval must be a positive multiple of an hour")
+
+// partitionedTable is partitioned by list of network, and each network by range of createdAt.
+// Both levels have a default partition, so rows are stored even if their partition is not created yet.
+type partitionedTable struct {
+	name string
+	// primaryKey includes partition keys, which postgreSQL requires
+	primaryKey string
+	// indexes are those of migrations, named the same so later migrations still apply.
+	// PostgreSQL requires unique indexes of partitioned tables to include partition keys, so createdAt is added to them.
+	indexes []string
+	// uniqueIndex is the name of the unique one of indexes
+	uniqueIndex string
+	// keys is the table of keys, which keeps rows unique regardless of createdAt, and key is its columns.
+	// Unique indexes including createdAt don't reject a filtered block delivered again, whose createdAt is when it's received.
+	keys string
+	key  string
+	// dedupe drops rows duplicated by key, keeping the earliest one
+	dedupe string
+}
+
+var partitionedTables = []partitionedTable{
+	{
+		name:       "blocks",
+		primaryKey: `"blockHash", "network", "createdAt"`,
+		indexes: []string{
+			`CREATE UNIQUE INDEX IF NOT EXISTS "blocks_network_block_number_key" ON "blocks" ("network", "blockNumber", "createdAt")`,
+			`CREATE INDEX IF NOT EXISTS "blocks_network_created_at_idx" ON "blocks" ("network", "createdAt")`,
+		},
+		uniqueIndex: "blocks_network_block_number_key",
+		keys:        "block_keys",
+		key:         `"network", "blockNumber"`,
+		dedupe:      `DELETE FROM ? a USING ? b WHERE a."network" = b."network" AND a."blockNumber" = b."blockNumber" AND (a."createdAt", a."blockHash") > (b."createdAt", b."blockHash")`,
+	},
+	{
+		name:       "transactions",
+		primaryKey: `"id", "network", "createdAt"`,
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS "transactions_network_block_number_idx" ON "transactions" ("network", "blockNumber")`,
+			`CREATE INDEX IF NOT EXISTS "transactions_network_created_at_idx" ON "transactions" ("network", "createdAt")`,
+			`CREATE INDEX IF NOT EXISTS "transactions_network_creator_idx" ON "transactions" ("network", "creator")`,
+			`CREATE INDEX IF NOT EXISTS "transactions_network_chaincode_id_idx" ON "transactions" ("network", "chaincodeId" text_pattern_ops)`,
+		},
+		keys:   "transaction_keys",
+		key:    `"network", "id"`,
+		dedupe: `DELETE FROM ? a USING ? b WHERE a."network" = b."network" AND a."id" = b."id" AND (a."createdAt", a."blockNumber") > (b."createdAt", b."blockNumber")`,
+	},
+}
+
+// BlockKey is the key of a block stored in a partitioned table
+type BlockKey struct {
+	tableName struct{} `pg:"block_keys"` //nolint:unused
+
+	Network     string `pg:"network,pk"`
+	BlockNumber uint64 `pg:"blockNumber,pk"`
+}
+
+// TransactionKey is the key of a transaction stored in a partitioned table
+type TransactionKey struct {
+	tableName struct{} `pg:"transaction_keys"` //nolint:unused
+
+	Network string `pg:"network,pk"`
+	ID      string `pg:"id,pk"`
+}
+
+// partitionedTableOf returns the partitioned table of model, nil if it's not one of partitionedTables
+func partitionedTableOf(model interface{}) *partitionedTable {
+	switch model.(type) {
+	case *Block:
+		return &partitionedTables[0]
+	case *Transaction:
+		return &partitionedTables[1]
+	}
+	return nil
+}
+
+// PartitionStart returns start of the partition range covering createdAt, ranges of interval are aligned to unix epoch
+func PartitionStart(createdAt int64, interval time.Duration) int64 {
+	length := int64(interval / time.Second)
+	return createdAt - createdAt%length
+}
+
+// Partitioned returns whether blocks and transactions are partitioned
+func Partitioned(ctx context.Context, db pg.DBI) (bool, error) {
+	var count int
+	_, err := db.QueryOneContext(ctx, pg.Scan(&count), `SELECT count(*) FROM pg_partitioned_table p JOIN pg_class c ON c.oid = p.partrelid WHERE c.relname IN (?)`,
+		pg.In([]string{partitionedTables[0].name, partitionedTables[1].name}))
+	if err != nil {
+		return false, err
+	}
+	return count == len(partitionedTables), nil
+}
+
+// EnablePartitioning converts blocks and transactions to partitioned tables if they aren't,
+// and copies existing rows into partitions of interval, which locks both tables until done.
+func EnablePartitioning(ctx context.Context, db *pg.DB, interval time.Duration) error {
+	if interval <= 0 || interval%time.Hour != 0 {
+		return ErrInvalidPartitionInterval
+	}
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := lockSchema(ctx, tx); err != nil {
+			return err
+		}
+		partitioned, err := Partitioned(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if partitioned {
+			for _, table := range partitionedTables {
+				// tables partitioned by earlier versions have a plain index instead of the unique one, and no keys
+				if err := ensureUniqueIndex(ctx, tx, table); err != nil {
+					return errors.Wrapf(err, "create unique index of %s", table.name)
+				}
+				if err := ensureKeys(ctx, tx, table); err != nil {
+					return errors.Wrapf(err, "fill keys of %s", table.name)
+				}
+			}
+			return nil
+		}
+		for _, table := range partitionedTables {
+			klog.Infof("Converting table %s to partitioned", table.name)
+			if err := partitionTable(ctx, tx, table, interval); err != nil {
+				return errors.Wrapf(err, "partition table %s", table.name)
+			}
+			if err := fillKeys(ctx, tx, table); err != nil {
+				return errors.Wrapf(err, "fill keys of %s", table.name)
+			}
+		}
+		return nil
+	})
+}
+
+func partitionTable(ctx context.Context, tx *pg.Tx, table partitionedTable, interval time.Duration) error {
+	old := table.name + "_unpartitioned"
+	if _, err := tx.ExecContext(ctx, `ALTER TABLE ? RENAME TO ?`, pg.Ident(table.name), pg.Ident(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE ? (LIKE ? INCLUDING DEFAULTS) PARTITION BY LIST ("network")`, pg.Ident(table.name), pg.Ident(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE ? PARTITION OF ? DEFAULT`, pg.Ident(table.name+"_default"), pg.Ident(table.name)); err != nil {
+		return err
+	}
+
+	// partitions are created before copying, since a partition can not be created once its rows are in the default partition
+	var ranges []struct {
+		Network string
+		Start   int64
+	}
+	length := int64(interval / time.Second)
+	_, err := tx.QueryContext(ctx, &ranges, `SELECT DISTINCT "network", "createdAt" - "createdAt" % ? AS "start" FROM ? WHERE "network" IS NOT NULL`, length, pg.Ident(old))
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if err := createNetworkPartitions(ctx, tx, table.name, r.Network, r.Start, interval); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, table.dedupe, pg.Ident(old), pg.Ident(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO ? SELECT * FROM ?`, pg.Ident(table.name), pg.Ident(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE ?`, pg.Ident(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `ALTER TABLE ? ADD PRIMARY KEY (?)`, pg.Ident(table.name), pg.Safe(table.primaryKey)); err != nil {
+		return err
+	}
+	for _, index := range table.indexes {
+		if _, err := tx.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePartitions creates partitions of blocks and transactions for a network covering createdAt, if they don't exist
+func CreatePartitions(ctx context.Context, db *pg.DB, network string, createdAt int64, interval time.Duration) error {
+	if interval <= 0 || interval%time.Hour != 0 {
+		return ErrInvalidPartitionInterval
+	}
+	start := PartitionStart(createdAt, interval)
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// serialize with other replicas and conversion, since concurrent creation of a partition conflicts in catalogs
+		if err := advisoryLock(ctx, tx); err != nil {
+			return err
+		}
+		for _, table := range partitionedTables {
+			if err := createNetworkPartitions(ctx, tx, table.name, network, start, interval); err != nil {
+				return errors.Wrapf(err, "create partition of %s", table.name)
+			}
+		}
+		return nil
+	})
+}
+
+// ensureUniqueIndex replaces the plain index named uniqueIndex by the unique one, dropping duplicated rows first
+func ensureUniqueIndex(ctx context.Context, tx *pg.Tx, table partitionedTable) error {
+	if table.uniqueIndex == "" {
+		return nil
+	}
+	var unique bool
+	_, err := tx.QueryOneContext(ctx, pg.Scan(&unique), `SELECT i.indisunique FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid WHERE c.relname = ?`, table.uniqueIndex)
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return err
+	}
+	if unique {
+		return nil
+	}
+	klog.Infof("Replacing index %s of table %s by a unique one", table.uniqueIndex, table.name)
+	if _, err = tx.ExecContext(ctx, table.dedupe, pg.Ident(table.name), pg.Ident(table.name)); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DROP INDEX IF EXISTS ?`, pg.Ident(table.uniqueIndex)); err != nil {
+		return err
+	}
+	for _, index := range table.indexes {
+		if _, err = tx.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureKeys fills keys of a partitioned table if they are empty, dropping duplicated rows first
+func ensureKeys(ctx context.Context, tx *pg.Tx, table partitionedTable) error {
+	var filled bool
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&filled), `SELECT EXISTS (SELECT 1 FROM ?)`, pg.Ident(table.keys)); err != nil || filled {
+		return err
+	}
+	klog.Infof("Filling keys of table %s", table.name)
+	if _, err := tx.ExecContext(ctx, table.dedupe, pg.Ident(table.name), pg.Ident(table.name)); err != nil {
+		return err
+	}
+	return fillKeys(ctx, tx, table)
+}
+
+// fillKeys replaces keys of a partitioned table by those of its rows, which should have been deduplicated
+func fillKeys(ctx context.Context, tx *pg.Tx, table partitionedTable) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ?`, pg.Ident(table.keys)); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO ? (?) SELECT ? FROM ? WHERE "network" IS NOT NULL ON CONFLICT DO NOTHING`,
+		pg.Ident(table.keys), pg.Safe(table.key), pg.Safe(table.key), pg.Ident(table.name))
+	return err
+}
+
+// InsertPartitioned inserts a row into a partitioned table unless its key is stored, in which case the row is skipped.
+// key is the BlockKey or TransactionKey of the row.
+func InsertPartitioned(ctx context.Context, db *pg.DB, row interface{}, key interface{}) error {
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		res, err := tx.ModelContext(ctx, key).OnConflict("DO NOTHING").Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		_, err = tx.ModelContext(ctx, row).OnConflict("DO NOTHING").Insert()
+		return err
+	})
+}
+
+// DeletePartitioned deletes rows of model's partitioned table selected by filter along with their keys,
+// and returns how many rows are deleted. filter is a condition of the rows followed by LIMIT.
+// Models other than Block and Transaction are not partitioned, and deleted is false for them.
+func DeletePartitioned(ctx context.Context, db pg.DBI, model interface{}, filter string, args ...interface{}) (n int, deleted bool, err error) {
+	table := partitionedTableOf(model)
+	if table == nil {
+		return 0, false, nil
+	}
+	var on []string
+	for _, column := range strings.Split(table.key, ", ") {
+		on = append(on, fmt.Sprintf("k.%s = d.%s", column, column))
+	}
+	// ctid is unique only in a partition, so it's paired with tableoid
+	query := `WITH d AS (DELETE FROM ? WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM ? WHERE ` + filter + `) RETURNING ` + table.key + `), ` +
+		`deleted_keys AS (DELETE FROM ? k USING d WHERE ` + strings.Join(on, " AND ") + `) SELECT count(*) FROM d`
+	queryArgs := append([]interface{}{pg.Ident(table.name), pg.Ident(table.name)}, args...)
+	queryArgs = append(queryArgs, pg.Ident(table.keys))
+	_, err = db.QueryOneContext(ctx, pg.Scan(&n), query, queryArgs...)
+	return n, true, err
+}
+
+// createNetworkPartitions creates the partition of a network with its default partition,
+// and the partition of range starting at start in it
+func createNetworkPartitions(ctx context.Context, tx *pg.Tx, table string, network string, start int64, interval time.Duration) error {
+	parent := networkPartition(table, network)
+	err := createPartition(ctx, tx, table, parent, `FOR VALUES IN (?) PARTITION BY RANGE ("createdAt")`, `"network" = ?`, func() error {
+		// rows moved into the new partition are kept in its default partition, until partitions of their ranges are created
+		_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS ? PARTITION OF ? DEFAULT`, pg.Ident(parent+"_default"), pg.Ident(parent))
+		return err
+	}, network)
+	if err != nil {
+		return err
+	}
+	// rows without a valid timestamp stay in the default partition
+	if start <= 0 {
+		return nil
+	}
+	end := start + int64(interval/time.Second)
+	return createPartition(ctx, tx, parent, rangePartition(parent, start, interval), `FOR VALUES FROM (?) TO (?)`, `"createdAt" >= ? AND "createdAt" < ?`, nil, start, end)
+}
+
+// createPartition creates partition of parent for values in bound if it doesn't exist, and calls setup once it's created.
+// PostgreSQL refuses to create a partition while the default partition of parent has rows in its bound,
+// so these rows, selected by where with the same args as bound, are moved out of the detached default partition into the new one.
+func createPartition(ctx context.Context, tx *pg.Tx, parent string, partition string, bound string, where string, setup func() error, args ...interface{}) error {
+	var exists bool
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&exists), `SELECT to_regclass(?) IS NOT NULL`, partition); err != nil || exists {
+		return err
+	}
+	create := func() error {
+		createArgs := append([]interface{}{pg.Ident(partition), pg.Ident(parent)}, args...)
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE ? PARTITION OF ? `+bound, createArgs...); err != nil {
+			return err
+		}
+		if setup != nil {
+			return setup()
+		}
+		return nil
+	}
+
+	defaultPartition := parent + "_default"
+	whereArgs := append([]interface{}{pg.Ident(defaultPartition)}, args...)
+	var pending bool
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&pending), `SELECT EXISTS (SELECT 1 FROM ? WHERE `+where+`)`, whereArgs...); err != nil {
+		return err
+	}
+	if !pending {
+		return create()
+	}
+
+	klog.Infof("Moving rows of partition %s out of %s", partition, defaultPartition)
+	if _, err := tx.ExecContext(ctx, `ALTER TABLE ? DETACH PARTITION ?`, pg.Ident(parent), pg.Ident(defaultPartition)); err != nil {
+		return err
+	}
+	if err := create(); err != nil {
+		return err
+	}
+	moveArgs := append(append([]interface{}{}, whereArgs...), pg.Ident(parent))
+	if _, err := tx.ExecContext(ctx, `WITH moved AS (DELETE FROM ? WHERE `+where+` RETURNING *) INSERT INTO ? SELECT * FROM moved`, moveArgs...); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `ALTER TABLE ? ATTACH PARTITION ? DEFAULT`, pg.Ident(parent), pg.Ident(defaultPartition))
+	return err
+}
+
+// DropPartitions drops all partitions of a network, along with rows in them
+func DropPartitions(ctx context.Context, db *pg.DB, network string) error {
+	return db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := advisoryLock(ctx, tx); err != nil {
+			return err
+		}
+		for _, table := range partitionedTables {
+			if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS ?`, pg.Ident(networkPartition(table.name, network))); err != nil {
+				return errors.Wrapf(err, "drop partitions of %s", table.name)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM ? WHERE "network" = ?`, pg.Ident(table.keys), network); err != nil {
+				return errors.Wrapf(err, "delete keys of %s", table.name)
+			}
+		}
+		return nil
+	})
+}
+
+// networkPartition names partition of a network by its hash, since network ids may be too long or contain any character
+func networkPartition(table string, network string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(network))
+	return fmt.Sprintf("%s_%016x", table, h.Sum64())
+}
+
+func rangePartition(parent string, start int64, interval time.Duration) string {
+	layout := "2006010215"
+	if interval%(24*time.Hour) == 0 {
+		layout = "20060102"
+	}
+	return parent + "_" + time.Unix(start, 0).UTC().Format(layout)
+}
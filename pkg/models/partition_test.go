@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSNEnv is the postgreSQL tests run against, tests using it are skipped if it's not set.
+// The database is partitioned by tests, so it should be dedicated to them.
+const testDSNEnv = "BC_EXPLORER_TEST_DSN"
+
+func testDB(t *testing.T) *pg.DB {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("env %s is not set", testDSNEnv)
+	}
+	opts, err := pg.ParseURL(dsn)
+	require.NoError(t, err)
+	db := pg.Connect(opts)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, Init(db))
+	return db
+}
+
+func TestPartitionNames(t *testing.T) {
+	day := 24 * time.Hour
+	createdAt := time.Date(2023, 4, 18, 8, 30, 0, 0, time.UTC).Unix()
+
+	start := PartitionStart(createdAt, day)
+	assert.Equal(t, time.Date(2023, 4, 18, 0, 0, 0, 0, time.UTC).Unix(), start)
+	assert.Equal(t, time.Date(2023, 4, 18, 6, 0, 0, 0, time.UTC).Unix(), PartitionStart(createdAt, 6*time.Hour))
+
+	parent := networkPartition("transactions", "blkexp_blkexp6")
+	assert.Len(t, parent, len("transactions_")+16)
+	assert.Equal(t, parent, networkPartition("transactions", "blkexp_blkexp6"))
+	assert.NotEqual(t, parent, networkPartition("transactions", "blkexp_blkexp7"))
+
+	assert.Equal(t, parent+"_20230418", rangePartition(parent, start, day))
+	assert.Equal(t, parent+"_2023041806", rangePartition(parent, PartitionStart(createdAt, 6*time.Hour), 6*time.Hour))
+}
+
+func TestCreatePartitionsWithExistingRows(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	day := 24 * time.Hour
+	require.NoError(t, EnablePartitioning(ctx, db, day))
+
+	network := fmt.Sprintf("partition_%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = DropPartitions(ctx, db, network) })
+	count := func(table string) int {
+		var n int
+		_, err := db.QueryOne(pg.Scan(&n), `SELECT count(*) FROM ? WHERE "network" = ?`, pg.Ident(table), network)
+		require.NoError(t, err)
+		return n
+	}
+
+	// rows of a network without partitions are kept in the default partition
+	first := time.Date(2023, 4, 18, 8, 0, 0, 0, time.UTC).Unix()
+	for i := 1; i <= 3; i++ {
+		_, err := db.Model(&Block{BlockHash: fmt.Sprintf("hash%d", i), Network: network, BlockNumber: uint64(i), CreatedAt: first + int64(i)}).Insert()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, count("blocks_default"))
+
+	require.NoError(t, CreatePartitions(ctx, db, network, first, day))
+	parent := networkPartition("blocks", network)
+	assert.Equal(t, 0, count("blocks_default"))
+	assert.Equal(t, 3, count(rangePartition(parent, PartitionStart(first, day), day)))
+
+	// rows of a range without partition are kept in the default partition of the network
+	next := first + int64(day/time.Second)
+	_, err := db.Model(&Block{BlockHash: "hash4", Network: network, BlockNumber: 4, CreatedAt: next}).Insert()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count(parent+"_default"))
+
+	require.NoError(t, CreatePartitions(ctx, db, network, next, day))
+	assert.Equal(t, 0, count(parent+"_default"))
+	assert.Equal(t, 1, count(rangePartition(parent, PartitionStart(next, day), day)))
+	assert.Equal(t, 4, count("blocks"))
+
+	// creating existing partitions again is a no-op
+	require.NoError(t, CreatePartitions(ctx, db, network, first, day))
+
+	// a block is stored only once
+	_, err = db.Model(&Block{BlockHash: "hash5", Network: network, BlockNumber: 4, CreatedAt: next}).Insert()
+	assert.Error(t, err)
+}
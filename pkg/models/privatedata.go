@@ -0,0 +1,43 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+const PrivateDataTableName = "private_data"
+
+type PrivateWrite struct {
+	Key string `json:"key,omitempty"`
+	// KeyHash is the hex encoded sha256 hash of key, which is the same as the key hash in hashed rwset
+	KeyHash  string `json:"keyHash,omitempty"`
+	Value    string `json:"value,omitempty"`
+	IsDelete bool   `json:"isDelete,omitempty"`
+}
+
+// PrivateData holds cleartext private writes of one collection in a transaction
+type PrivateData struct {
+	tableName struct{} `pg:"private_data"` //nolint:unused
+
+	// ID is {txID}_{namespace}_{collection}
+	ID          string `pg:"id,pk" json:"id"`
+	Network     string `pg:"network" json:"network"`
+	BlockNumber uint64 `pg:"blockNumber" json:"blockNumber"`
+	TxID        string `pg:"txId" json:"txId"`
+	Namespace   string `pg:"namespace" json:"namespace"`
+	Collection  string `pg:"collection" json:"collection"`
+	// PvtRwSetHash is the hex encoded hash of private rwset recorded in transaction's hashed rwset
+	PvtRwSetHash string         `pg:"pvtRwSetHash" json:"pvtRwSetHash"`
+	Writes       []PrivateWrite `pg:"writes" json:"writes"`
+}
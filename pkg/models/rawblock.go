@@ -0,0 +1,29 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// RawBlock is an original block received from peers in protobuf, which derived tables can be rebuilt from
+type RawBlock struct {
+	tableName struct{} `pg:"raw_blocks"` //nolint:unused
+
+	Network string `pg:"network,pk" json:"network"`
+	// BlockNumber starts from 1, the same as Block.BlockNumber
+	BlockNumber uint64 `pg:"blockNumber,pk" json:"blockNumber"`
+	// Hash is hex of sha256 of Data
+	Hash string `pg:"hash" json:"hash"`
+	Data []byte `pg:"data" json:"-"`
+}
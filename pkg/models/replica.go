@@ -0,0 +1,28 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "time"
+
+// Replica is a listener replica which sends heartbeats periodically
+type Replica struct {
+	// ID is the identity of the replica
+	ID string `pg:"id,pk" json:"id"`
+	// Address is where other replicas forward requests to, e.g. http://10.0.0.1:9999
+	Address     string    `pg:"address" json:"address"`
+	HeartbeatAt time.Time `pg:"heartbeatAt" json:"heartbeatAt"`
+}
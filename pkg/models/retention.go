@@ -0,0 +1,72 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidRetention = errors.New("invalid retention")
+
+type RetentionMode string
+
+const (
+	// RetentionDelete deletes blocks out of retention along with their transactions and private data
+	RetentionDelete RetentionMode = "Delete"
+	// RetentionHeadersOnly keeps blocks and transactions out of retention,
+	// but drops payloads, arguments and events of transactions, and private data
+	RetentionHeadersOnly RetentionMode = "HeadersOnly"
+)
+
+// Retention keeps blocks created in the last Days days or the last Blocks blocks, whichever keeps less.
+// Zero means no limit, and the latest block is always kept.
+type Retention struct {
+	Days   int    `json:"days,omitempty"`
+	Blocks uint64 `json:"blocks,omitempty"`
+	// Mode defaults to Delete
+	Mode RetentionMode `json:"mode,omitempty"`
+}
+
+func (r *Retention) Validate() error {
+	if r.Days < 0 {
+		return errors.Wrap(ErrInvalidRetention, "days must not be negative")
+	}
+	if r.Days == 0 && r.Blocks == 0 {
+		return errors.Wrap(ErrInvalidRetention, "either days or blocks is required")
+	}
+	switch r.Mode {
+	case "", RetentionDelete, RetentionHeadersOnly:
+	default:
+		return errors.Wrapf(ErrInvalidRetention, "unknown mode %s", r.Mode)
+	}
+	return nil
+}
+
+// HeadersOnly returns whether blocks and transactions out of retention are kept without payloads
+func (r *Retention) HeadersOnly() bool {
+	return r.Mode == RetentionHeadersOnly
+}
+
+// Since returns the earliest creation time of blocks to keep, zero if not limited by days
+func (r *Retention) Since(now time.Time) int64 {
+	if r.Days == 0 {
+		return 0
+	}
+	return now.AddDate(0, 0, -r.Days).Unix()
+}
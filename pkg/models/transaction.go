@@ -20,6 +20,7 @@ import (
 	"context"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"k8s.io/klog/v2"
 )
 
@@ -44,6 +45,15 @@ type Write struct {
 	IsDelete bool   `json:"isDelete,omitempty"`
 }
 
+// FilteredTxUnavailableFields are transaction fields which filtered block events do not deliver.
+// `createdAt` of a filtered transaction is the time when listener received its block.
+var FilteredTxUnavailableFields = []string{"createdAt", "creator", "payload", "method", "args"}
+
+type ChaincodeEvent struct {
+	ChaincodeID string `json:"chaincodeId,omitempty"`
+	EventName   string `json:"eventName,omitempty"`
+}
+
 type FabRWSet struct {
 	Namespace string  `json:"namespace,omitempty"`
 	Reads     []Read  `json:"reads,omitempty"`
@@ -54,8 +64,10 @@ type Transaction struct {
 	ID          string `pg:"id,pk" json:"id"`
 	Network     string `pg:"network" json:"network"`
 	BlockNumber uint64 `pg:"blockNumber" json:"blockNumber"`
-	CreatedAt   int64  `pg:"createdAt" json:"createdAt"`
-	Creator     string `pg:"creator" json:"creator"`
+	// TxIndex is the position of the transaction in its block
+	TxIndex   int    `pg:"txIndex,use_zero" json:"txIndex"`
+	CreatedAt int64  `pg:"createdAt" json:"createdAt"`
+	Creator   string `pg:"creator" json:"creator"`
 
 	Type    TxType `pg:"type" json:"type"`
 	Payload []byte `pg:"payload" json:"payload"`
@@ -66,6 +78,21 @@ type Transaction struct {
 	Args        []string `pg:"args" json:"args"`
 
 	ValidationCode int32 `pg:"validationCode" json:"validationCode"`
+
+	Events []ChaincodeEvent `pg:"events" json:"events,omitempty"`
+
+	// Filtered is true if this transaction comes from filtered block events
+	Filtered          bool     `pg:"filtered" json:"filtered,omitempty"`
+	UnavailableFields []string `pg:"-" json:"unavailableFields,omitempty"`
+}
+
+var _ orm.AfterScanHook = (*Transaction)(nil)
+
+func (tx *Transaction) AfterScan(ctx context.Context) error {
+	if tx.Filtered {
+		tx.UnavailableFields = FilteredTxUnavailableFields
+	}
+	return nil
 }
 
 var _ pg.QueryHook = (*Transaction)(nil)
@@ -17,7 +17,13 @@ limitations under the License.
 package network
 
 import (
+	"context"
+	"strconv"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 	"k8s.io/klog/v2"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
@@ -56,12 +62,23 @@ func (n *Network) Type() Type {
 }
 
 type FabricClient struct {
-	gw *client.Gateway
+	conn *grpc.ClientConn
+	gw   *client.Gateway
 
 	primaryChannel *client.Network
 }
 
+// NewFabricClient connects to the first peer endpoint of this network
 func NewFabricClient(n *Network) (*FabricClient, error) {
+	if n.FabProfile == nil {
+		klog.Error(errMissingFabNetProfile)
+		return nil, errMissingFabNetProfile
+	}
+	return NewFabricClientWithEndpoint(n, n.FabProfile.PeerEndpoints()[0])
+}
+
+// NewFabricClientWithEndpoint connects to the given peer endpoint of this network
+func NewFabricClientWithEndpoint(n *Network, endpoint NodeEndpoint) (*FabricClient, error) {
 	var err error
 
 	if n.FabProfile == nil {
@@ -75,8 +92,8 @@ func NewFabricClient(n *Network) (*FabricClient, error) {
 		return nil, errMissingFabChannel
 	}
 
-	klog.V(5).Infof("initialize a fabric client conn for network: %s", n.ID)
-	clientConn, err := newFabClientConn(profile)
+	klog.V(5).Infof("initialize a fabric client conn for network: %s with endpoint: %s", n.ID, endpoint.URL)
+	clientConn, err := newFabClientConn(profile, endpoint)
 	if err != nil {
 		klog.Error(err)
 		return nil, err
@@ -86,6 +103,7 @@ func NewFabricClient(n *Network) (*FabricClient, error) {
 	id, sign, err := profile.User.ToIdentity(profile.Organization)
 	if err != nil {
 		klog.Error(err)
+		clientConn.Close()
 		return nil, err
 	}
 
@@ -93,10 +111,12 @@ func NewFabricClient(n *Network) (*FabricClient, error) {
 	gateway, err := client.Connect(id, client.WithSign(sign), client.WithClientConnection(clientConn))
 	if err != nil {
 		klog.Error(err)
+		clientConn.Close()
 		return nil, err
 	}
 
 	return &FabricClient{
+		conn:           clientConn,
 		gw:             gateway,
 		primaryChannel: gateway.GetNetwork(profile.Channel),
 	}, nil
@@ -109,6 +129,33 @@ func (fabclient *FabricClient) Channel(channel string) *client.Network {
 	return fabclient.primaryChannel
 }
 
+// Height returns current ledger height of the primary channel on the connected peer
+func (fabclient *FabricClient) Height(ctx context.Context) (uint64, error) {
+	result, err := fabclient.primaryChannel.GetContract("qscc").EvaluateWithContext(ctx, "GetChainInfo", client.WithArguments(fabclient.primaryChannel.Name()))
+	if err != nil {
+		return 0, err
+	}
+	info := &common.BlockchainInfo{}
+	if err = proto.Unmarshal(result, info); err != nil {
+		return 0, err
+	}
+	return info.GetHeight(), nil
+}
+
+// BlockByNumber returns a block of the primary channel on the connected peer
+func (fabclient *FabricClient) BlockByNumber(ctx context.Context, number uint64) (*common.Block, error) {
+	result, err := fabclient.primaryChannel.GetContract("qscc").EvaluateWithContext(ctx, "GetBlockByNumber", client.WithArguments(fabclient.primaryChannel.Name(), strconv.FormatUint(number, 10)))
+	if err != nil {
+		return nil, err
+	}
+	block := &common.Block{}
+	if err = proto.Unmarshal(result, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
 func (fabclient *FabricClient) Close() {
 	fabclient.gw.Close()
+	fabclient.conn.Close()
 }
@@ -17,15 +17,19 @@ limitations under the License.
 package network
 
 import (
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"net/url"
+	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	"k8s.io/klog/v2"
 )
 
@@ -33,6 +37,24 @@ var (
 	errInvalidFabNetEndpoint = errors.New("fabric network's peer endpoint is invalid")
 	errInvalidCert           = errors.New("invalid certificate")
 	errInvalidPrivateKey     = errors.New("invalid private key")
+	errInvalidClientTLS      = errors.New("invalid client tls key pair")
+	errInvalidGRPCOptions    = errors.New("invalid grpc options")
+	errCertNotValidNow       = errors.New("certificate is expired or not yet valid")
+	errKeyMismatch           = errors.New("private key does not match certificate")
+)
+
+// EventMode defines which kind of block events the listener subscribes to
+type EventMode string
+
+const (
+	// BlockEventMode subscribes to full blocks, which requires block-read ACL on the channel
+	BlockEventMode EventMode = "block"
+	// FilteredBlockEventMode subscribes to filtered blocks, which only carry tx ids, types,
+	// validation codes and chaincode event names
+	FilteredBlockEventMode EventMode = "filtered"
+	// PrivateDataEventMode subscribes to full blocks along with private data of collections
+	// which the user's organization is a member of
+	PrivateDataEventMode EventMode = "privateData"
 )
 
 type FabProfile struct {
@@ -40,6 +62,60 @@ type FabProfile struct {
 	Organization string       `yaml:"organization" json:"organization" validate:"required"`
 	User         User         `yaml:"user" json:"user" validate:"required"`
 	Enpoint      NodeEndpoint `yaml:"endpoint" json:"endpoint" validate:"required"`
+	// Endpoints is an ordered list of peer endpoints. Listener fails over to the next one
+	// when current peer is unreachable or lagging. Defaults to `[endpoint]` if empty
+	Endpoints []NodeEndpoint `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
+	// MaxBlockLag is how many blocks current peer can fall behind other peers before listener fails over.
+	// Lag check is disabled if it is 0
+	MaxBlockLag uint64 `yaml:"maxBlockLag,omitempty" json:"maxBlockLag,omitempty"`
+	// EventMode defaults to `block` if empty
+	EventMode EventMode `yaml:"eventMode,omitempty" json:"eventMode,omitempty"`
+	// PrivateCollections is the allow-list of collections whose cleartext private writes
+	// can be stored in `privateData` event mode
+	PrivateCollections []PrivateCollection `yaml:"privateCollections,omitempty" json:"privateCollections,omitempty"`
+	// ClientTLS is the client key pair for mutual TLS, which is required by peers with `clientAuthRequired`
+	ClientTLS *ClientTLS `yaml:"clientTLS,omitempty" json:"clientTLS,omitempty"`
+	// GRPCOptions applies to connections with all peer endpoints
+	GRPCOptions GRPCOptions `yaml:"grpcOptions,omitempty" json:"grpcOptions,omitempty"`
+}
+
+type ClientTLS struct {
+	Key  Pem `yaml:"key,omitempty" json:"key,omitempty"`
+	Cert Pem `yaml:"cert,omitempty" json:"cert,omitempty"`
+}
+
+type GRPCOptions struct {
+	// KeepAliveTime is the duration(like `60s`) after which client pings peer if there is no activity
+	KeepAliveTime string `yaml:"keepAliveTime,omitempty" json:"keepAliveTime,omitempty"`
+	// KeepAliveTimeout is the duration(like `20s`) client waits for ping ack before closing the connection
+	KeepAliveTimeout string `yaml:"keepAliveTimeout,omitempty" json:"keepAliveTimeout,omitempty"`
+	// KeepAlivePermitWithoutStream allows pings even if there are no active streams
+	KeepAlivePermitWithoutStream bool `yaml:"keepAlivePermitWithoutStream,omitempty" json:"keepAlivePermitWithoutStream,omitempty"`
+	// MaxRecvMsgSize is the max message size in bytes client can receive, default by grpc is 4MB
+	MaxRecvMsgSize int `yaml:"maxRecvMsgSize,omitempty" json:"maxRecvMsgSize,omitempty"`
+}
+
+type PrivateCollection struct {
+	Namespace  string `yaml:"namespace" json:"namespace"`
+	Collection string `yaml:"collection" json:"collection"`
+}
+
+// PeerEndpoints returns all peer endpoints in order
+func (p *FabProfile) PeerEndpoints() []NodeEndpoint {
+	if len(p.Endpoints) > 0 {
+		return p.Endpoints
+	}
+	return []NodeEndpoint{p.Enpoint}
+}
+
+// CollectionAllowed checks whether private writes of this collection can be stored
+func (p *FabProfile) CollectionAllowed(namespace, collection string) bool {
+	for _, c := range p.PrivateCollections {
+		if c.Namespace == namespace && c.Collection == collection {
+			return true
+		}
+	}
+	return false
 }
 
 type User struct {
@@ -55,14 +131,16 @@ type Pem struct {
 type NodeEndpoint struct {
 	URL        string `yaml:"url,omitempty" json:"url,omitempty"`
 	TLSCACerts `yaml:"tlsCACerts,omitempty" json:"tlsCACerts,omitempty"`
+	// ServerNameOverride overrides the server name used to verify peer's certificate and as SNI
+	ServerNameOverride string `yaml:"serverNameOverride,omitempty" json:"serverNameOverride,omitempty"`
 }
 
 type TLSCACerts struct {
 	Pem string `yaml:"pem,omitempty" json:"pem,omitempty"`
 }
 
-func newFabClientConn(p *FabProfile) (*grpc.ClientConn, error) {
-	u, err := url.Parse(p.Enpoint.URL)
+func newFabClientConn(p *FabProfile, ep NodeEndpoint) (*grpc.ClientConn, error) {
+	u, err := url.Parse(ep.URL)
 	if err != nil {
 		return nil, errors.Wrap(errInvalidFabNetEndpoint, err.Error())
 	}
@@ -71,17 +149,104 @@ func newFabClientConn(p *FabProfile) (*grpc.ClientConn, error) {
 	transportCreds := insecure.NewCredentials()
 	if u.Scheme == "grpcs" {
 		klog.V(5).Infof("ssl enabled in endpoint: %s", u.Host)
-		cpb, _ := pem.Decode([]byte(p.Enpoint.TLSCACerts.Pem))
-		cert, err := x509.ParseCertificate(cpb.Bytes)
+		tlsConfig, err := newTLSConfig(p.ClientTLS, ep)
+		if err != nil {
+			return nil, err
+		}
+		transportCreds = credentials.NewTLS(tlsConfig)
+	}
+
+	dialOpts, err := p.GRPCOptions.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	dialOpts = append(dialOpts, grpc.WithTransportCredentials(transportCreds))
+
+	return grpc.Dial(u.Host, dialOpts...)
+}
+
+func newTLSConfig(clientTLS *ClientTLS, ep NodeEndpoint) (*tls.Config, error) {
+	cpb, _ := pem.Decode([]byte(ep.TLSCACerts.Pem))
+	if cpb == nil {
+		return nil, errInvalidX509Cert
+	}
+	cert, err := x509.ParseCertificate(cpb.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidX509Cert, err.Error())
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: ep.ServerNameOverride,
+		MinVersion: tls.VersionTLS12,
+	}
+	if clientTLS != nil {
+		klog.V(5).Infof("mutual tls enabled in endpoint: %s", ep.URL)
+		keyPair, err := tls.X509KeyPair([]byte(clientTLS.Cert.Pem), []byte(clientTLS.Key.Pem))
 		if err != nil {
-			return nil, errors.Wrap(errInvalidX509Cert, err.Error())
+			return nil, errors.Wrap(errInvalidClientTLS, err.Error())
 		}
-		pool := x509.NewCertPool()
-		pool.AddCert(cert)
-		transportCreds = credentials.NewClientTLSFromCert(pool, "")
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+	}
+	return tlsConfig, nil
+}
+
+func (opts GRPCOptions) dialOptions() ([]grpc.DialOption, error) {
+	dialOpts := make([]grpc.DialOption, 0)
+
+	if opts.KeepAliveTime != "" {
+		params := keepalive.ClientParameters{
+			PermitWithoutStream: opts.KeepAlivePermitWithoutStream,
+		}
+		var err error
+		params.Time, err = time.ParseDuration(opts.KeepAliveTime)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidGRPCOptions, err.Error())
+		}
+		if opts.KeepAliveTimeout != "" {
+			params.Timeout, err = time.ParseDuration(opts.KeepAliveTimeout)
+			if err != nil {
+				return nil, errors.Wrap(errInvalidGRPCOptions, err.Error())
+			}
+		}
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(params))
+	}
+
+	if opts.MaxRecvMsgSize < 0 {
+		return nil, errors.Wrap(errInvalidGRPCOptions, "maxRecvMsgSize must not be negative")
+	}
+	if opts.MaxRecvMsgSize > 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(opts.MaxRecvMsgSize)))
 	}
 
-	return grpc.Dial(u.Host, grpc.WithTransportCredentials(transportCreds))
+	return dialOpts, nil
+}
+
+// Validate checks the user's certificate is valid now and matches its private key
+func (u User) Validate() error {
+	crt, err := identity.CertificateFromPEM([]byte(u.Cert.Pem))
+	if err != nil {
+		return errors.Wrap(errInvalidCert, err.Error())
+	}
+	now := time.Now()
+	if now.Before(crt.NotBefore) || now.After(crt.NotAfter) {
+		return errors.Wrapf(errCertNotValidNow, "valid from %s to %s", crt.NotBefore.Format(time.RFC3339), crt.NotAfter.Format(time.RFC3339))
+	}
+	priv, err := identity.PrivateKeyFromPEM([]byte(u.Key.Pem))
+	if err != nil {
+		return errors.Wrap(errInvalidPrivateKey, err.Error())
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return errors.Wrap(errInvalidPrivateKey, "unsupported key type")
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(crt.PublicKey) {
+		return errKeyMismatch
+	}
+	return nil
 }
 
 func (u User) ToIdentity(org string) (identity.Identity, identity.Sign, error) {
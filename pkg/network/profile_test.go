@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCertPem generates a self-signed certificate along with its private key in pem
+func newCertPem(t *testing.T, cn string) (string, string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	caPem, _ := newCertPem(t, "tlsca")
+	clientCert, clientKey := newCertPem(t, "client")
+	ep := NodeEndpoint{
+		URL:                "grpcs://peer0:7051",
+		TLSCACerts:         TLSCACerts{Pem: caPem},
+		ServerNameOverride: "peer0.org1.example.com",
+	}
+
+	tlsConfig, err := newTLSConfig(nil, ep)
+	require.NoError(t, err)
+	assert.Equal(t, "peer0.org1.example.com", tlsConfig.ServerName)
+	assert.Empty(t, tlsConfig.Certificates)
+
+	tlsConfig, err = newTLSConfig(&ClientTLS{Key: Pem{Pem: clientKey}, Cert: Pem{Pem: clientCert}}, ep)
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	_, err = newTLSConfig(&ClientTLS{Key: Pem{Pem: clientKey}}, ep)
+	assert.ErrorIs(t, err, errInvalidClientTLS)
+
+	_, err = newTLSConfig(nil, NodeEndpoint{URL: "grpcs://peer0:7051"})
+	assert.ErrorIs(t, err, errInvalidX509Cert)
+}
+
+func TestGRPCDialOptions(t *testing.T) {
+	opts, err := GRPCOptions{}.dialOptions()
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+
+	opts, err = GRPCOptions{KeepAliveTime: "60s", KeepAliveTimeout: "20s", MaxRecvMsgSize: 100 * 1024 * 1024}.dialOptions()
+	require.NoError(t, err)
+	assert.Len(t, opts, 2)
+
+	_, err = GRPCOptions{KeepAliveTime: "60"}.dialOptions()
+	assert.ErrorIs(t, err, errInvalidGRPCOptions)
+
+	_, err = GRPCOptions{MaxRecvMsgSize: -1}.dialOptions()
+	assert.ErrorIs(t, err, errInvalidGRPCOptions)
+}
+
+func TestUserValidate(t *testing.T) {
+	cert, key := newCertPem(t, "admin")
+	_, otherKey := newCertPem(t, "other")
+
+	assert.NoError(t, User{Key: Pem{Pem: key}, Cert: Pem{Pem: cert}}.Validate())
+	assert.ErrorIs(t, User{Key: Pem{Pem: otherKey}, Cert: Pem{Pem: cert}}.Validate(), errKeyMismatch)
+	assert.ErrorIs(t, User{Key: Pem{Pem: key}}.Validate(), errInvalidCert)
+	assert.ErrorIs(t, User{Cert: Pem{Pem: cert}}.Validate(), errInvalidPrivateKey)
+}
@@ -124,6 +124,19 @@ const (
 	Delete     MsgType = 1 << iota
 )
 
+func (t MsgType) String() string {
+	switch t {
+	case Register:
+		return "register"
+	case Deregister:
+		return "deregister"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
 func IsConfigMapHasProfile(name string) bool {
 	return strings.HasPrefix(name, "chan-") && strings.HasSuffix(name, "-connection-profile")
 }
@@ -152,7 +152,7 @@ func (w *Watcher) parseDataFromConfigmap(configmap *corev1.ConfigMap, channel *v
 	}
 	fabProfile = &network.FabProfile{}
 	fabProfile.Channel = channel.GetChannelID()
-	// Always use the connection profile of the peer as the first in alphabetical
+	// Always use the user of organization which owns the first peer in alphabetical
 	peers := make([]string, 0)
 	for peerName := range profile.Peers {
 		peers = append(peers, peerName)
@@ -184,12 +184,19 @@ func (w *Watcher) parseDataFromConfigmap(configmap *corev1.ConfigMap, channel *v
 			fabProfile.User.Cert.Pem = v.Cert.Pem
 		}
 	}
-	for peerName, value := range profile.Peers {
-		if wantPeer != peerName {
-			continue
+	// All peers are kept in alphabetical order, so listener can fail over to the next one
+	for _, peerName := range peers {
+		value := profile.Peers[peerName]
+		endpoint := network.NodeEndpoint{
+			URL: value.URL,
+			TLSCACerts: network.TLSCACerts{
+				Pem: value.TLSCACerts.Pem,
+			},
+		}
+		if peerName == wantPeer {
+			fabProfile.Enpoint = endpoint
 		}
-		fabProfile.Enpoint.URL = value.URL
-		fabProfile.Enpoint.TLSCACerts.Pem = value.TLSCACerts.Pem
+		fabProfile.Endpoints = append(fabProfile.Endpoints, endpoint)
 	}
 	return fabProfile, nil
 }
@@ -303,6 +310,7 @@ func (w *Watcher) SendProfile(fabProfile *network.FabProfile, networkName, chann
 }
 
 func (w *Watcher) sendMsg(msg Msg) {
+	eventsReceived.WithLabelValues(msg.Type.String()).Inc()
 	key := key(msg.NetworkName, msg.ChannelID)
 	if value, exist := w.Send.Load(key); exist {
 		oldMsg, ok := (value).(Msg)
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package observer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/bestchains/bc-explorer/pkg/metrics"
+)
+
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "observer",
+		Name:      "events_total",
+		Help:      "Number of channel events sent to pusher by type.",
+	}, []string{"type"})
+	pushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "observer",
+		Name:      "pushes_total",
+		Help:      "Number of requests pushed to listener by type and result.",
+	}, []string{"type", "result"})
+	pushRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "observer",
+		Name:      "push_retries_total",
+		Help:      "Number of retried pushes by type.",
+	}, []string{"type"})
+	pushFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "observer",
+		Name:      "push_failures_total",
+		Help:      "Number of events failed to push after all retries by type.",
+	}, []string{"type"})
+)
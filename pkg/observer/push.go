@@ -49,38 +49,44 @@ func (p *Pusher) Run(ctx context.Context) {
 	for {
 		data := <-p.Msg
 		key := key(data.NetworkName, data.ChannelID)
+		msgType := data.Type.String()
+		pushed := false
 		for i := 0; i < 2; i++ {
 			// If the HTTP request fails, try again after 1 second.
+			if i > 0 {
+				pushRetries.WithLabelValues(msgType).Inc()
+			}
 			time.Sleep(time.Duration(i) * time.Second)
+			var err error
 			switch data.Type {
 			case Register:
-				if err := p.Register(key, data.Data); err != nil {
-					klog.ErrorS(err, "register error", "key", key)
-					continue
-				}
-				klog.InfoS("register done.", "key", key)
+				err = p.Register(key, data.Data)
 			case Delete:
-				if err := p.Delete(key); err != nil {
-					klog.ErrorS(err, "delete error", "key", key)
-					continue
-				}
-				klog.InfoS("delete done.", "key", key)
+				err = p.Delete(key)
 			case Deregister:
-				if err := p.DeRegister(key); err != nil {
-					klog.ErrorS(err, "deregister error", "key", key)
-					continue
-				}
-				klog.InfoS("deregister done.", "key", key)
+				err = p.DeRegister(key)
+			}
+			if err != nil {
+				pushes.WithLabelValues(msgType, "failure").Inc()
+				klog.ErrorS(err, msgType+" error", "key", key)
+				continue
 			}
+			pushes.WithLabelValues(msgType, "success").Inc()
+			klog.InfoS(msgType+" done.", "key", key)
+			pushed = true
 			break
 		}
+		if !pushed {
+			pushFailures.WithLabelValues(msgType).Inc()
+		}
 	}
 }
 
 func (p *Pusher) Register(key string, data *network.Network) (err error) {
 	url := p.Host + "/network/register"
 	jsonStr, _ := json.Marshal(data)
-	klog.V(5).InfoS(fmt.Sprintf("register url:%s post body:%s", url, string(jsonStr)), "key", key)
+	// post body carries user's private key, never log it
+	klog.V(5).InfoS(fmt.Sprintf("register url:%s", url), "key", key)
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonStr))
 	if err != nil {
 		return err
@@ -127,7 +133,8 @@ func (p *Pusher) DeRegister(name string) (err error) {
 
 func (p *Pusher) getResp(key string, resp *http.Response) error {
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
+	// deletion is accepted and runs in background
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusAccepted {
 		return nil
 	}
 	bodyBytes, _ := io.ReadAll(resp.Body)
@@ -139,6 +146,6 @@ func (p *Pusher) getResp(key string, resp *http.Response) error {
 func (p *Pusher) AddAuth(req *http.Request) {
 	if p.Auth != "" {
 		req.Header.Set("Authorization", p.Auth)
-		klog.V(5).Infof("with auth, header:%s", req.Header)
+		klog.V(5).Infof("with auth, url:%s", req.URL)
 	}
 }
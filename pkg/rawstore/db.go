@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawstore
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// rangePageSize is how many blocks are selected at a time by Range
+var rangePageSize = 100
+
+var _ Store = (*dbStore)(nil)
+
+// dbStore keeps raw blocks in table raw_blocks
+type dbStore struct {
+	db *pg.DB
+}
+
+func NewDBStore(db *pg.DB) Store {
+	return &dbStore{db: db}
+}
+
+func (s *dbStore) Put(ctx context.Context, block *models.RawBlock) error {
+	_, err := s.db.ModelContext(ctx, block).OnConflict(`("network", "blockNumber") DO NOTHING`).Insert()
+	return err
+}
+
+func (s *dbStore) Get(ctx context.Context, network string, number uint64) (*models.RawBlock, error) {
+	block := &models.RawBlock{Network: network, BlockNumber: number}
+	if err := s.db.ModelContext(ctx, block).WherePK().Select(); err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *dbStore) Range(ctx context.Context, network string, from uint64, fn func(*models.RawBlock) error) error {
+	for {
+		var blocks []*models.RawBlock
+		err := s.db.ModelContext(ctx, &blocks).
+			Where(`"network" = ? AND "blockNumber" >= ?`, network, from).
+			Order("blockNumber ASC").Limit(rangePageSize).Select()
+		if err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+		if len(blocks) < rangePageSize {
+			return nil
+		}
+		from = blocks[len(blocks)-1].BlockNumber + 1
+	}
+}
+
+func (s *dbStore) Prune(ctx context.Context, network string, before uint64, limit int) (int, error) {
+	res, err := s.db.ModelContext(ctx, (*models.RawBlock)(nil)).
+		Where(`("network", "blockNumber") IN (SELECT "network", "blockNumber" FROM ?TableName WHERE "network" = ? AND "blockNumber" < ? LIMIT ?)`, network, before, limit).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
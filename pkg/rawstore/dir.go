@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var _ Store = (*dirStore)(nil)
+
+// dirStore keeps raw blocks in a directory, each network in its own sub directory:
+//
+//	{network}/objects/{hash[:2]}/{hash}  content of a block, named by its sha256
+//	{network}/index/{number}             hash of the block of number, zero padded to sort by name
+//
+// A block is written before its index entry and removed after, so every entry points to a complete block.
+type dirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.New("raw block directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func (s *dirStore) networkDir(network string) string {
+	return filepath.Join(s.dir, url.PathEscape(network))
+}
+
+func (s *dirStore) objectPath(network string, hash string) string {
+	return filepath.Join(s.networkDir(network), "objects", hash[:2], hash)
+}
+
+func (s *dirStore) indexPath(network string, number uint64) string {
+	return filepath.Join(s.networkDir(network), "index", fmt.Sprintf("%020d", number))
+}
+
+func (s *dirStore) Put(_ context.Context, block *models.RawBlock) error {
+	index := s.indexPath(block.Network, block.BlockNumber)
+	if _, err := os.Stat(index); err == nil {
+		return nil
+	}
+	if block.Hash == "" {
+		block.Hash = hash(block.Data)
+	}
+	object := s.objectPath(block.Network, block.Hash)
+	if _, err := os.Stat(object); err != nil {
+		if err := writeFile(object, block.Data); err != nil {
+			return err
+		}
+	}
+	return writeFile(index, []byte(block.Hash))
+}
+
+func (s *dirStore) Get(_ context.Context, network string, number uint64) (*models.RawBlock, error) {
+	return s.read(network, number)
+}
+
+func (s *dirStore) read(network string, number uint64) (*models.RawBlock, error) {
+	h, err := os.ReadFile(s.indexPath(network, number))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	block := &models.RawBlock{Network: network, BlockNumber: number, Hash: strings.TrimSpace(string(h))}
+	if len(block.Hash) < 2 {
+		return nil, errors.Wrapf(ErrCorrupted, "block %d", number)
+	}
+	block.Data, err = os.ReadFile(s.objectPath(network, block.Hash))
+	if err != nil {
+		return nil, err
+	}
+	if hash(block.Data) != block.Hash {
+		return nil, errors.Wrapf(ErrCorrupted, "block %d", number)
+	}
+	return block, nil
+}
+
+func (s *dirStore) Range(ctx context.Context, network string, from uint64, fn func(*models.RawBlock) error) error {
+	numbers, err := s.numbers(network)
+	if err != nil {
+		return err
+	}
+	for _, number := range numbers {
+		if number < from {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		block, err := s.read(network, number)
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dirStore) Prune(_ context.Context, network string, before uint64, limit int) (int, error) {
+	numbers, err := s.numbers(network)
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, number := range numbers {
+		if number >= before || pruned >= limit {
+			break
+		}
+		index := s.indexPath(network, number)
+		h, err := os.ReadFile(index)
+		if err != nil {
+			return pruned, err
+		}
+		if err := os.Remove(index); err != nil {
+			return pruned, err
+		}
+		if hash := strings.TrimSpace(string(h)); len(hash) >= 2 {
+			if err := os.Remove(s.objectPath(network, hash)); err != nil && !os.IsNotExist(err) {
+				return pruned, err
+			}
+		}
+		pruned++
+	}
+	if pruned > 0 && pruned == len(numbers) {
+		// nothing left of the network
+		if err := os.RemoveAll(s.networkDir(network)); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// numbers returns numbers of all blocks of a network in ascending order
+func (s *dirStore) numbers(network string) ([]uint64, error) {
+	entries, err := os.ReadDir(filepath.Join(s.networkDir(network), "index"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	numbers := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		number, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			// temporary files of interrupted writes
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
+
+// writeFile writes data to a temporary file and renames it, so that path either doesn't exist or is complete
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawstore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestDirStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDirStore(t.TempDir())
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 5; i++ {
+		raw, err := NewRawBlock("network/channel", &common.Block{Header: &common.BlockHeader{Number: i}})
+		require.NoError(t, err)
+		require.NoError(t, store.Put(ctx, raw))
+		// stored blocks are kept as is
+		require.NoError(t, store.Put(ctx, &models.RawBlock{Network: raw.Network, BlockNumber: raw.BlockNumber, Data: []byte("other")}))
+	}
+
+	raw, err := store.Get(ctx, "network/channel", 3)
+	require.NoError(t, err)
+	block, err := Block(raw)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&common.Block{Header: &common.BlockHeader{Number: 2}}, block))
+	_, err = store.Get(ctx, "network/channel", 6)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get(ctx, "other", 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	var numbers []uint64
+	require.NoError(t, store.Range(ctx, "network/channel", 2, func(raw *models.RawBlock) error {
+		numbers = append(numbers, raw.BlockNumber)
+		return nil
+	}))
+	assert.Equal(t, []uint64{2, 3, 4, 5}, numbers)
+
+	n, err := store.Prune(ctx, "network/channel", 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = store.Prune(ctx, "network/channel", 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = store.Get(ctx, "network/channel", 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// a block modified on disk is detected
+	raw, err = store.Get(ctx, "network/channel", 4)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.(*dirStore).objectPath(raw.Network, raw.Hash), []byte("modified"), 0o644))
+	_, err = store.Get(ctx, "network/channel", 4)
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	n, err = store.Prune(ctx, "network/channel", AllBlocks, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = os.Stat(store.(*dirStore).networkDir("network/channel"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	ErrNotFound    = errors.New("raw block not found")
+	ErrCorrupted   = errors.New("raw block does not match its hash")
+	ErrUnknownKind = errors.New("unknown raw block store")
+)
+
+// Kind is where raw blocks are stored
+type Kind string
+
+const (
+	// None keeps no raw blocks
+	None Kind = "none"
+	// Database keeps raw blocks in table raw_blocks
+	Database Kind = "db"
+	// Directory keeps raw blocks as files named by their hashes
+	Directory Kind = "dir"
+)
+
+// AllBlocks is the block number before which all blocks are pruned
+const AllBlocks uint64 = math.MaxInt64
+
+// Store keeps original blocks of networks, which all derived tables can be rebuilt from.
+// Block numbers start from 1, the same as models.Block.
+type Store interface {
+	// Put stores a block, and does nothing if the block of the same number is stored already
+	Put(ctx context.Context, block *models.RawBlock) error
+	// Get returns the block of a network by number, or ErrNotFound
+	Get(ctx context.Context, network string, number uint64) (*models.RawBlock, error)
+	// Range calls fn on blocks of a network from block number on in ascending order, until fn returns an error
+	Range(ctx context.Context, network string, from uint64, fn func(*models.RawBlock) error) error
+	// Prune deletes at most limit blocks of a network before block number, and returns how many are deleted
+	Prune(ctx context.Context, network string, before uint64, limit int) (int, error)
+}
+
+// New creates a store of kind, which is nil for None. db is used by Database, and dir by Directory.
+func New(kind Kind, db *pg.DB, dir string) (Store, error) {
+	switch kind {
+	case None, "":
+		return nil, nil
+	case Database:
+		return NewDBStore(db), nil
+	case Directory:
+		return NewDirStore(dir)
+	default:
+		return nil, errors.Wrap(ErrUnknownKind, string(kind))
+	}
+}
+
+// NewRawBlock encodes a fabric block of a network
+func NewRawBlock(network string, block *common.Block) (*models.RawBlock, error) {
+	data, err := proto.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RawBlock{
+		Network:     network,
+		BlockNumber: block.GetHeader().GetNumber() + 1, // postgresql treat 0 as null,so we start from 1
+		Hash:        hash(data),
+		Data:        data,
+	}, nil
+}
+
+// Block decodes a raw block
+func Block(raw *models.RawBlock) (*common.Block, error) {
+	block := &common.Block{}
+	if err := proto.Unmarshal(raw.Data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var (
+	errInvalidKey        = errors.New("invalid encryption key")
+	errUnknownKey        = errors.New("data is encrypted by an unknown key")
+	errInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// prefix marks data encrypted by Keyring, followed by `{keyID}:{base64(nonce|ciphertext)}`
+const prefix = "bcenc:v1:"
+
+// Cipher encrypts secrets before they are stored
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt returns data as it is if it is not encrypted
+	Decrypt(data []byte) ([]byte, error)
+	// NeedsRotation checks whether data should be encrypted again by current primary key
+	NeedsRotation(data []byte) bool
+}
+
+var _ Cipher = new(plaintext)
+
+type plaintext struct{}
+
+// NewPlaintext returns a Cipher which does not encrypt at all
+func NewPlaintext() Cipher {
+	return &plaintext{}
+}
+
+func (p *plaintext) Encrypt(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (p *plaintext) Decrypt(data []byte) ([]byte, error) {
+	if IsEncrypted(data) {
+		return nil, errors.Wrap(errUnknownKey, "no encryption key configured")
+	}
+	return data, nil
+}
+
+func (p *plaintext) NeedsRotation(data []byte) bool {
+	return false
+}
+
+var _ Cipher = new(Keyring)
+
+// Keyring encrypts with its primary key by AES-GCM, and decrypts with any of its keys
+// so that keys can be rotated by putting a new primary key in front of the old ones
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring parses keys in format `{keyID}:{base64 encoded 32 bytes key}`, separated by commas or new lines.
+// The first key is the primary key.
+func NewKeyring(keys string) (*Keyring, error) {
+	kr := &Keyring{
+		aeads: make(map[string]cipher.AEAD),
+	}
+	for _, key := range strings.FieldsFunc(keys, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		id, encoded, found := strings.Cut(key, ":")
+		if !found || id == "" {
+			return nil, errors.Wrap(errInvalidKey, "key must be in format {keyID}:{base64 key}")
+		}
+		if _, ok := kr.aeads[id]; ok {
+			return nil, errors.Wrapf(errInvalidKey, "duplicate key id %s", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(errInvalidKey, "key %s: %s", id, err.Error())
+		}
+		if len(raw) != 32 {
+			return nil, errors.Wrapf(errInvalidKey, "key %s must be 32 bytes", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, errors.Wrapf(errInvalidKey, "key %s: %s", id, err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(errInvalidKey, "key %s: %s", id, err.Error())
+		}
+		if kr.primary == "" {
+			kr.primary = id
+		}
+		kr.aeads[id] = aead
+	}
+	if kr.primary == "" {
+		return nil, errors.Wrap(errInvalidKey, "no key found")
+	}
+	return kr, nil
+}
+
+// Load loads keys from file if it is not empty, otherwise from environment variable env.
+// A plaintext Cipher is returned if no key is found.
+func Load(file string, env string) (Cipher, error) {
+	var keys string
+	if file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		keys = string(raw)
+	} else {
+		keys = os.Getenv(env)
+	}
+	if strings.TrimSpace(keys) == "" {
+		klog.Warningf("No encryption key found in file %q or env %s, secrets will be stored in plaintext", file, env)
+		return NewPlaintext(), nil
+	}
+	return NewKeyring(keys)
+}
+
+// IsEncrypted checks whether data is encrypted by a Keyring
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(prefix))
+}
+
+func (kr *Keyring) Encrypt(data []byte) ([]byte, error) {
+	aead := kr.aeads[kr.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, data, nil)
+	return []byte(fmt.Sprintf("%s%s:%s", prefix, kr.primary, base64.StdEncoding.EncodeToString(sealed))), nil
+}
+
+func (kr *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	id, encoded, found := strings.Cut(string(data[len(prefix):]), ":")
+	if !found {
+		return nil, errInvalidCiphertext
+	}
+	aead, ok := kr.aeads[id]
+	if !ok {
+		return nil, errors.Wrapf(errUnknownKey, "key id %s", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidCiphertext, err.Error())
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errInvalidCiphertext
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidCiphertext, err.Error())
+	}
+	return plain, nil
+}
+
+func (kr *Keyring) NeedsRotation(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	return !bytes.HasPrefix(data, []byte(prefix+kr.primary+":"))
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	plain := []byte(`{"user":{"key":{"pem":"secret"}}}`)
+
+	oldKeyring, err := NewKeyring(newKey("k1", 1))
+	require.NoError(t, err)
+	encrypted, err := oldKeyring.Encrypt(plain)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, string(encrypted), "secret")
+	assert.False(t, oldKeyring.NeedsRotation(encrypted))
+
+	// k2 becomes primary while k1 is still able to decrypt
+	newKeyring, err := NewKeyring(newKey("k2", 2) + "\n" + newKey("k1", 1))
+	require.NoError(t, err)
+	assert.True(t, newKeyring.NeedsRotation(encrypted))
+	decrypted, err := newKeyring.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	rotated, err := newKeyring.Encrypt(decrypted)
+	require.NoError(t, err)
+	assert.False(t, newKeyring.NeedsRotation(rotated))
+	_, err = oldKeyring.Decrypt(rotated)
+	assert.ErrorIs(t, err, errUnknownKey)
+
+	// plaintext stored before encryption is enabled is readable and needs rotation
+	decrypted, err = newKeyring.Decrypt(plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, decrypted)
+	assert.True(t, newKeyring.NeedsRotation(plain))
+}
+
+func TestNewKeyringInvalid(t *testing.T) {
+	for _, keys := range []string{"", "k1", "k1:!!", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), newKey("k1", 1) + "," + newKey("k1", 2)} {
+		_, err := NewKeyring(keys)
+		assert.ErrorIs(t, err, errInvalidKey, keys)
+	}
+}
+
+func TestKeyringTampered(t *testing.T) {
+	kr, err := NewKeyring(newKey("k1", 1))
+	require.NoError(t, err)
+	encrypted, err := kr.Encrypt([]byte("secret"))
+	require.NoError(t, err)
+	encrypted[len(encrypted)-2] ^= 1
+	_, err = kr.Decrypt(encrypted)
+	assert.Error(t, err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bestchains/bc-explorer/pkg/models"
@@ -61,8 +62,8 @@ func (ba *BlockArg) ToCond() ([]string, []interface{}) {
 }
 
 type Block interface {
-	List(BlockArg) ([]models.Block, int64, error)
-	Get(BlockArg) (models.Block, error)
+	List(context.Context, BlockArg) ([]models.Block, int64, error)
+	Get(context.Context, BlockArg) (models.Block, error)
 }
 type blockHandler struct {
 	db *pg.DB
@@ -72,7 +73,7 @@ func NewBlockHandler(db *pg.DB) Block {
 	return &blockHandler{db: db}
 }
 
-func (bh *blockHandler) List(arg BlockArg) ([]models.Block, int64, error) {
+func (bh *blockHandler) List(ctx context.Context, arg BlockArg) ([]models.Block, int64, error) {
 	if arg.Network == "" {
 		return nil, 0, fmt.Errorf("network name can't be empty")
 	}
@@ -81,7 +82,7 @@ func (bh *blockHandler) List(arg BlockArg) ([]models.Block, int64, error) {
 	query, params := arg.ToCond()
 	klog.V(5).Infof(" list query %s\n", query)
 
-	q := bh.db.Model(&result)
+	q := bh.db.ModelContext(ctx, &result)
 	for i := 0; i < len(query); i++ {
 		q = q.Where(query[i], params[i])
 	}
@@ -100,13 +101,13 @@ func (bh *blockHandler) List(arg BlockArg) ([]models.Block, int64, error) {
 	return result, int64(c), nil
 }
 
-func (bh *blockHandler) Get(arg BlockArg) (models.Block, error) {
+func (bh *blockHandler) Get(ctx context.Context, arg BlockArg) (models.Block, error) {
 	if arg.BlockHash == "" {
 		return models.Block{}, fmt.Errorf("blockHash can't be empty")
 	}
 	query, params := arg.ToCond()
 	var result models.Block
-	q := bh.db.Model(&result)
+	q := bh.db.ModelContext(ctx, &result)
 	for i := 0; i < len(query); i++ {
 		q = q.Where(query[i], params[i])
 	}
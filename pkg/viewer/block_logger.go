@@ -17,6 +17,8 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
+
 	"github.com/bestchains/bc-explorer/pkg/models"
 	"k8s.io/klog/v2"
 )
@@ -39,7 +41,7 @@ func NewBlockLoggerHandler() Block {
 	klog.Infoln("use block logger handler")
 	return &blockLoggerHandler{}
 }
-func (blh *blockLoggerHandler) List(arg BlockArg) ([]models.Block, int64, error) {
+func (blh *blockLoggerHandler) List(_ context.Context, arg BlockArg) ([]models.Block, int64, error) {
 	klog.Infoln("blockLoggerHandler List")
 	query, params := arg.ToCond()
 	for i := 0; i < len(query); i++ {
@@ -48,7 +50,7 @@ func (blh *blockLoggerHandler) List(arg BlockArg) ([]models.Block, int64, error)
 	return []models.Block{loggerReturnObj}, 1, nil
 }
 
-func (blh *blockLoggerHandler) Get(arg BlockArg) (models.Block, error) {
+func (blh *blockLoggerHandler) Get(_ context.Context, arg BlockArg) (models.Block, error) {
 	klog.Infof("blockLoggerHandler Get,network: %s, blockHash: %s\n", arg.Network, arg.BlockHash)
 	return loggerReturnObj, nil
 }
@@ -0,0 +1,376 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+var (
+	// maxConflictingWriters is the max number of writers listed for each conflicting key
+	maxConflictingWriters = 20
+	// maxHotKeyTxs is the max number of invalid transactions analyzed for a hot keys report, the latest ones are analyzed
+	maxHotKeyTxs = 1000
+)
+
+var errTxValid = errors.New("transaction is valid")
+
+// TxConflicts tells which keys read by an invalid transaction were changed before it was committed, and by whom
+type TxConflicts struct {
+	ID             string           `json:"id"`
+	Network        string           `json:"network"`
+	BlockNumber    uint64           `json:"blockNumber"`
+	TxIndex        int              `json:"txIndex"`
+	ValidationCode int32            `json:"validationCode"`
+	ValidationName string           `json:"validationName"`
+	Keys           []ConflictingKey `json:"keys"`
+	// Notes tell what is unknown and why
+	Notes []string `json:"notes,omitempty"`
+}
+
+type ConflictingKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	// ReadVersion is the position of the write the transaction read, absent if the key did not exist when read
+	ReadVersion *Position `json:"readVersion,omitempty"`
+	// Writers are valid transactions which wrote the key after the version read and before the transaction, latest first
+	Writers []ConflictingWriter `json:"writers"`
+	// Truncated is true if there are more writers than listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type ConflictingWriter struct {
+	TxID        string `json:"txId"`
+	BlockNumber uint64 `json:"blockNumber"`
+	TxIndex     int    `json:"txIndex"`
+	CreatedAt   int64  `json:"createdAt"`
+	IsDelete    bool   `json:"isDelete,omitempty"`
+}
+
+// HotKeysReport counts keys of a chaincode by conflicts they caused over a time range
+type HotKeysReport struct {
+	Network   string `json:"network"`
+	Chaincode string `json:"chaincode"`
+	StartTime int64  `json:"startTime"`
+	EndTime   int64  `json:"endTime"`
+	// Analyzed is the number of invalid transactions analyzed, Truncated is true if there are more in the time range
+	Analyzed  int      `json:"analyzed"`
+	Truncated bool     `json:"truncated"`
+	Keys      []HotKey `json:"keys"`
+	Notes     []string `json:"notes,omitempty"`
+}
+
+type HotKey struct {
+	Key string `json:"key"`
+	// Conflicts is the number of transactions invalidated by changes of the key
+	Conflicts int `json:"conflicts"`
+	// LastTxID and LastConflictAt are of the latest transaction invalidated by the key
+	LastTxID       string `json:"lastTxId"`
+	LastConflictAt int64  `json:"lastConflictAt"`
+}
+
+// conflictingRead is a read of a key whose version differs from the latest write before the transaction
+type conflictingRead struct {
+	namespace string
+	key       string
+	version   *Position
+}
+
+// GetTransactionConflicts finds which keys read by an invalid transaction were changed, and the transactions changed them
+func (h *handler) GetTransactionConflicts(ctx *fiber.Ctx) error {
+	klog.Info("viewer GetTransactionConflicts")
+	txHash := ctx.Params("txHash")
+	network := ctx.Params("network")
+	if h.keys == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": "key history is not available"})
+	}
+
+	tx, err := h.transaction.Get(queryContext(ctx), TransArg{NetworkName: network, Hash: txHash})
+	if err != nil {
+		klog.Error(fmt.Sprintf("get transaction error: %s", err))
+		msg := err.Error()
+		ctx.Status(http.StatusInternalServerError)
+		if pg.ErrNoRows == err {
+			ctx.Status(http.StatusNotFound)
+			msg = fmt.Sprintf("transaction hash not found: %s", txHash)
+		}
+		return ctx.JSON(map[string]string{"msg": msg})
+	}
+
+	result, err := h.conflicts(queryContext(ctx), tx)
+	if err != nil {
+		klog.Error(fmt.Sprintf("analyze conflicts error: %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		if errors.Is(err, errTxValid) {
+			ctx.Status(http.StatusBadRequest)
+		}
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	return ctx.JSON(result)
+}
+
+// conflicts analyzes an invalid transaction
+func (h *handler) conflicts(ctx context.Context, tx *models.Transaction) (*TxConflicts, error) {
+	if _, err := h.locateTx(ctx, tx); err != nil {
+		return nil, err
+	}
+	code := peer.TxValidationCode(tx.ValidationCode)
+	if code == peer.TxValidationCode_VALID {
+		return nil, errors.Wrapf(errTxValid, "transaction %s", tx.ID)
+	}
+	result := &TxConflicts{
+		ID:             tx.ID,
+		Network:        tx.Network,
+		BlockNumber:    tx.BlockNumber,
+		TxIndex:        tx.TxIndex,
+		ValidationCode: tx.ValidationCode,
+		ValidationName: code.String(),
+		Keys:           make([]ConflictingKey, 0),
+	}
+	if code != peer.TxValidationCode_MVCC_READ_CONFLICT {
+		result.Notes = append(result.Notes, fmt.Sprintf("The transaction is invalid as %s, not by a read conflict.", code))
+	}
+
+	rwsets, note, err := txRWSets(tx)
+	if err != nil {
+		return nil, err
+	}
+	if note != "" {
+		result.Notes = append(result.Notes, note)
+		return result, nil
+	}
+	reads, unknown, err := h.conflictingReads(ctx, tx, rwsets)
+	if err != nil {
+		return nil, err
+	}
+	if unknown > 0 {
+		result.Notes = append(result.Notes, fmt.Sprintf("Kept history does not cover %s read, which may also conflict.", count(unknown, "key")))
+	}
+
+	position := Position{BlockNumber: tx.BlockNumber, TxIndex: tx.TxIndex}
+	for _, r := range reads {
+		key := ConflictingKey{Namespace: r.namespace, Key: r.key, ReadVersion: r.version, Writers: make([]ConflictingWriter, 0)}
+		after := Position{}
+		if r.version != nil {
+			after = *r.version
+		}
+		writes, err := h.keys.Between(ctx, tx.Network, r.namespace, r.key, after, position, maxConflictingWriters)
+		if err != nil {
+			return nil, errors.Wrap(err, "find conflicting writers")
+		}
+		key.Truncated = len(writes) == maxConflictingWriters
+		for _, w := range writes {
+			// a key read absent was created by writes after its last deletion
+			if r.version == nil && w.IsDelete {
+				key.Truncated = false
+				break
+			}
+			key.Writers = append(key.Writers, ConflictingWriter{
+				TxID:        w.TxID,
+				BlockNumber: w.BlockNumber,
+				TxIndex:     w.TxIndex,
+				CreatedAt:   w.CreatedAt,
+				IsDelete:    w.IsDelete,
+			})
+		}
+		result.Keys = append(result.Keys, key)
+	}
+	if code == peer.TxValidationCode_MVCC_READ_CONFLICT && len(result.Keys) == 0 && unknown == 0 {
+		result.Notes = append(result.Notes, "No key read was changed by valid transactions in kept history.")
+	}
+	return result, nil
+}
+
+// conflictingReads compares versions of keys a transaction read with the latest writes before it.
+// It returns conflicting reads, and the number of reads whose history is not kept.
+func (h *handler) conflictingReads(ctx context.Context, tx *models.Transaction, rwsets []models.FabRWSet) ([]conflictingRead, int, error) {
+	position := Position{BlockNumber: tx.BlockNumber, TxIndex: tx.TxIndex}
+	var reads []conflictingRead
+	var unknown int
+	for _, rwset := range rwsets {
+		if len(rwset.Reads) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(rwset.Reads))
+		for _, r := range rwset.Reads {
+			keys = append(keys, r.Key)
+		}
+		latest, err := h.keys.Latest(ctx, tx.Network, rwset.Namespace, keys, position)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "find latest writes")
+		}
+		for _, r := range rwset.Reads {
+			version, err := readPosition(r.Version)
+			if err != nil {
+				unknown++
+				continue
+			}
+			conflict, known := readConflicts(version, latest[r.Key])
+			if !known {
+				unknown++
+			}
+			if conflict {
+				reads = append(reads, conflictingRead{namespace: rwset.Namespace, key: r.Key, version: version})
+			}
+		}
+	}
+	return reads, unknown, nil
+}
+
+// readConflicts tells whether a read of version conflicts with the latest write to the key before the transaction,
+// and whether it is known, which is not if the write of the version is not kept
+func readConflicts(version *Position, latest *models.KeyWrite) (conflict bool, known bool) {
+	switch {
+	case version == nil:
+		// a key read absent conflicts if it exists now
+		return latest != nil && !latest.IsDelete, true
+	case latest == nil:
+		return false, false
+	default:
+		at := Position{BlockNumber: latest.BlockNumber, TxIndex: latest.TxIndex}
+		return at != *version, true
+	}
+}
+
+// readPosition returns the position of the write a read version refers to, nil if the key did not exist
+func readPosition(version string) (*Position, error) {
+	v, err := protoutil.ParseReadVersion(version)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	// block numbers in versions start from 0, while stored ones start from 1
+	return &Position{BlockNumber: v.BlockNum + 1, TxIndex: int(v.TxNum)}, nil
+}
+
+// GetHotKeys reports keys of a chaincode which caused the most read conflicts over a time range
+func (h *handler) GetHotKeys(ctx *fiber.Ctx) error {
+	klog.Info("viewer GetHotKeys")
+	if h.keys == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": "key history is not available"})
+	}
+	arg := TransArg{
+		NetworkName: ctx.Params("network"),
+		StartTime:   int64(ctx.QueryInt("startTime", 0)),
+		EndTime:     int64(ctx.QueryInt("endTime", 0)),
+	}
+	chaincode := ctx.Params("chaincode")
+	size := ctx.QueryInt("size", 10)
+	klog.V(5).Infof(" with ctx %+v, arg: %+v\n", *ctx, arg)
+
+	result, err := h.hotKeys(queryContext(ctx), arg, chaincode, size)
+	if err != nil {
+		klog.Error(fmt.Sprintf("report hot keys error: %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	return ctx.JSON(result)
+}
+
+// hotKeys analyzes the latest transactions of a chaincode invalidated by read conflicts,
+// and counts keys of the chaincode by transactions they invalidated
+func (h *handler) hotKeys(ctx context.Context, arg TransArg, chaincode string, size int) (*HotKeysReport, error) {
+	txs, err := h.transaction.ListConflicts(ctx, arg, chaincode, maxHotKeyTxs+1)
+	if err != nil {
+		return nil, err
+	}
+	report := &HotKeysReport{
+		Network:   arg.NetworkName,
+		Chaincode: chaincode,
+		StartTime: arg.StartTime,
+		EndTime:   arg.EndTime,
+		Truncated: len(txs) > maxHotKeyTxs,
+		Keys:      make([]HotKey, 0),
+	}
+	if report.Truncated {
+		txs = txs[:maxHotKeyTxs]
+	}
+	report.Analyzed = len(txs)
+
+	hot := make(map[string]*HotKey)
+	var skipped, unknown int
+	for i := range txs {
+		tx := &txs[i]
+		rwsets, note, err := txRWSets(tx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transaction %s", tx.ID)
+		}
+		if note != "" {
+			skipped++
+			continue
+		}
+		reads, n, err := h.conflictingReads(ctx, tx, rwsets)
+		if err != nil {
+			return nil, err
+		}
+		unknown += n
+		// a key read more than once by a transaction is counted once
+		counted := make(map[string]bool)
+		for _, r := range reads {
+			if r.namespace != chaincode || counted[r.key] {
+				continue
+			}
+			counted[r.key] = true
+			k, ok := hot[r.key]
+			if !ok {
+				k = &HotKey{Key: r.key}
+				hot[r.key] = k
+			}
+			k.Conflicts++
+			// transactions are the latest first
+			if k.LastTxID == "" {
+				k.LastTxID, k.LastConflictAt = tx.ID, tx.CreatedAt
+			}
+		}
+	}
+	for _, k := range hot {
+		report.Keys = append(report.Keys, *k)
+	}
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Conflicts != report.Keys[j].Conflicts {
+			return report.Keys[i].Conflicts > report.Keys[j].Conflicts
+		}
+		return report.Keys[i].Key < report.Keys[j].Key
+	})
+	if size > 0 && len(report.Keys) > size {
+		report.Keys = report.Keys[:size]
+	}
+
+	if skipped > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("Keys of %s are unknown, since they are from filtered blocks or their payloads were pruned.", count(skipped, "transaction")))
+	}
+	if unknown > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("Kept history does not cover %s read, which may also conflict.", count(unknown, "key")))
+	}
+	if report.Truncated {
+		report.Notes = append(report.Notes, fmt.Sprintf("Only the latest %d invalid transactions are analyzed, narrow the time range to analyze all.", maxHotKeyTxs))
+	}
+	return report, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// fakeKeyHistory finds writes in a slice
+type fakeKeyHistory struct {
+	writes []*models.KeyWrite
+}
+
+func (f *fakeKeyHistory) Latest(_ context.Context, network, namespace string, keys []string, before Position) (map[string]*models.KeyWrite, error) {
+	result := make(map[string]*models.KeyWrite)
+	for _, key := range keys {
+		writes, _ := f.Between(context.Background(), network, namespace, key, Position{}, before, 1)
+		if len(writes) > 0 {
+			result[key] = writes[0]
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeKeyHistory) Between(_ context.Context, network, namespace, key string, after, before Position, limit int) ([]*models.KeyWrite, error) {
+	writes := make([]*models.KeyWrite, 0)
+	for _, w := range f.writes {
+		at := Position{BlockNumber: w.BlockNumber, TxIndex: w.TxIndex}
+		if w.Network == network && w.Namespace == namespace && w.Key == key && after.Less(at) && at.Less(before) {
+			writes = append(writes, w)
+		}
+	}
+	sort.Slice(writes, func(i, j int) bool {
+		return Position{BlockNumber: writes[j].BlockNumber, TxIndex: writes[j].TxIndex}.Less(Position{BlockNumber: writes[i].BlockNumber, TxIndex: writes[i].TxIndex})
+	})
+	if len(writes) > limit {
+		writes = writes[:limit]
+	}
+	return writes, nil
+}
+
+// fakeConflictTxs lists invalid transactions in a slice
+type fakeConflictTxs struct {
+	Transaction
+	txs []models.Transaction
+}
+
+func (f *fakeConflictTxs) ListConflicts(_ context.Context, _ TransArg, _ string, limit int) ([]models.Transaction, error) {
+	if len(f.txs) > limit {
+		return f.txs[:limit], nil
+	}
+	return f.txs, nil
+}
+
+func TestConflicts(t *testing.T) {
+	write := func(key string, block uint64, index int, txID string, isDelete bool) *models.KeyWrite {
+		return &models.KeyWrite{Network: "network_channel", Namespace: "basic", Key: key, BlockNumber: block, TxIndex: index, TxID: txID, IsDelete: isDelete}
+	}
+	keys := &fakeKeyHistory{writes: []*models.KeyWrite{
+		write("asset1", 3, 0, "w1", false),
+		write("asset1", 5, 1, "w2", false),
+		write("asset1", 6, 0, "w3", false),
+		write("asset2", 4, 0, "w4", false),
+		write("asset3", 2, 0, "w5", false),
+		write("asset3", 5, 0, "w6", true),
+		write("asset3", 6, 1, "w7", false),
+	}}
+	newTx := func(id string, index int, reads ...models.Read) models.Transaction {
+		payload, err := json.Marshal([]models.FabRWSet{{Namespace: "basic", Reads: reads}})
+		require.NoError(t, err)
+		return models.Transaction{
+			ID:             id,
+			Network:        "network_channel",
+			BlockNumber:    6,
+			TxIndex:        index,
+			Type:           models.EndorserTransaction,
+			Payload:        payload,
+			ValidationCode: int32(peer.TxValidationCode_MVCC_READ_CONFLICT),
+		}
+	}
+	tx := newTx("tx1", 2,
+		models.Read{Key: "asset1", Version: "block_num:2"},
+		models.Read{Key: "asset2", Version: "block_num:3"},
+		models.Read{Key: "asset3", Version: "<nil>"},
+		models.Read{Key: "asset4", Version: "block_num:0"},
+	)
+	h := &handler{keys: keys}
+
+	result, err := h.conflicts(context.Background(), &tx)
+	require.NoError(t, err)
+	require.Len(t, result.Keys, 2)
+	assert.Equal(t, "asset1", result.Keys[0].Key)
+	assert.Equal(t, &Position{BlockNumber: 3}, result.Keys[0].ReadVersion)
+	assert.Equal(t, []ConflictingWriter{{TxID: "w3", BlockNumber: 6}, {TxID: "w2", BlockNumber: 5, TxIndex: 1}}, result.Keys[0].Writers)
+	// a key read absent was changed by writes since its deletion
+	assert.Equal(t, "asset3", result.Keys[1].Key)
+	assert.Nil(t, result.Keys[1].ReadVersion)
+	assert.Equal(t, []ConflictingWriter{{TxID: "w7", BlockNumber: 6, TxIndex: 1}}, result.Keys[1].Writers)
+	assert.Equal(t, []string{"Kept history does not cover 1 key read, which may also conflict."}, result.Notes)
+
+	valid := newTx("tx0", 0)
+	valid.ValidationCode = 0
+	_, err = h.conflicts(context.Background(), &valid)
+	assert.ErrorIs(t, err, errTxValid)
+
+	// asset1 invalidated both, while asset3 was not changed yet before tx2
+	h.transaction = &fakeConflictTxs{txs: []models.Transaction{
+		tx,
+		newTx("tx2", 1, models.Read{Key: "asset1", Version: "block_num:4 tx_num:1"}, models.Read{Key: "asset3", Version: "<nil>"}),
+	}}
+	report, err := h.hotKeys(context.Background(), TransArg{NetworkName: "network_channel"}, "basic", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Analyzed)
+	assert.False(t, report.Truncated)
+	assert.Equal(t, []HotKey{
+		{Key: "asset1", Conflicts: 2, LastTxID: "tx1"},
+		{Key: "asset3", Conflicts: 1, LastTxID: "tx1"},
+	}, report.Keys)
+
+	maxHotKeyTxs = 1
+	defer func() { maxHotKeyTxs = 1000 }()
+	report, err = h.hotKeys(context.Background(), TransArg{NetworkName: "network_channel"}, "basic", 1)
+	require.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, []HotKey{{Key: "asset1", Conflicts: 1, LastTxID: "tx1"}}, report.Keys)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
+)
+
+var errTxNotInBlock = errors.New("transaction not found in its raw block")
+
+// TxEnvelope is a transaction decoded from the raw block it's in
+type TxEnvelope struct {
+	ID          string `json:"id"`
+	Network     string `json:"network"`
+	BlockNumber uint64 `json:"blockNumber"`
+	// TxIndex is the position of the transaction in its block
+	TxIndex int `json:"txIndex"`
+	// ValidationCode is recorded in the block's metadata by committing peers, which is not in the envelope
+	ValidationCode string                     `json:"validationCode"`
+	Envelope       *protoutil.DecodedEnvelope `json:"envelope"`
+}
+
+// GetTransactionEnvelope returns the complete decoded envelope of a transaction from its raw block
+func (h *handler) GetTransactionEnvelope(ctx *fiber.Ctx) error {
+	klog.Info("viewer GetTransactionEnvelope")
+	txHash := ctx.Params("txHash")
+	network := ctx.Params("network")
+	if h.raw == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": errRawNotKept.Error()})
+	}
+
+	tx, err := h.transaction.Get(queryContext(ctx), TransArg{NetworkName: network, Hash: txHash})
+	if err != nil {
+		klog.Error(fmt.Sprintf("get transaction error: %s", err))
+		msg := err.Error()
+		ctx.Status(http.StatusInternalServerError)
+		if pg.ErrNoRows == err {
+			ctx.Status(http.StatusNotFound)
+			msg = fmt.Sprintf("transaction hash not found: %s", txHash)
+		}
+		return ctx.JSON(map[string]string{"msg": msg})
+	}
+
+	result, err := loadTxEnvelope(queryContext(ctx), h.raw, tx)
+	if err != nil {
+		klog.Error(fmt.Sprintf("get transaction envelope error: %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		if errors.Is(err, rawstore.ErrNotFound) || errors.Is(err, errTxNotInBlock) {
+			ctx.Status(http.StatusNotFound)
+		}
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	return ctx.JSON(result)
+}
+
+// loadTxEnvelope finds a transaction in its raw block and decodes it
+func loadTxEnvelope(ctx context.Context, raw rawstore.Store, tx *models.Transaction) (*TxEnvelope, error) {
+	rb, err := raw.Get(ctx, tx.Network, tx.BlockNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "block %d", tx.BlockNumber)
+	}
+	block, err := rawstore.Block(rb)
+	if err != nil {
+		return nil, err
+	}
+	for index, txData := range block.GetData().GetData() {
+		txID, err := protoutil.GetTxIDFromEnvelope(txData)
+		if err != nil || txID != tx.ID {
+			continue
+		}
+		envelope, err := protoutil.DecodeEnvelope(txData)
+		if err != nil {
+			return nil, err
+		}
+		return &TxEnvelope{
+			ID:             tx.ID,
+			Network:        tx.Network,
+			BlockNumber:    tx.BlockNumber,
+			TxIndex:        index,
+			ValidationCode: protoutil.GetTxValidationCode(block, index).String(),
+			Envelope:       envelope,
+		}, nil
+	}
+	return nil, errors.Wrapf(errTxNotInBlock, "block %d", tx.BlockNumber)
+}
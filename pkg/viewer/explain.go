@@ -0,0 +1,503 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/internal/hyperledger/fabric/protoutil"
+	"github.com/bestchains/bc-explorer/pkg/models"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
+)
+
+const (
+	KeyRead   = "read"
+	KeyWrite  = "write"
+	KeyDelete = "delete"
+)
+
+// maxDescribedValue is the max length of values quoted in descriptions, full values are in before and after
+const maxDescribedValue = 64
+
+// validationReasons explain validation codes in plain language
+var validationReasons = map[peer.TxValidationCode]string{
+	peer.TxValidationCode_VALID:                        "Committing peers accepted it, so its writes took effect.",
+	peer.TxValidationCode_NIL_ENVELOPE:                 "The transaction was empty.",
+	peer.TxValidationCode_BAD_PAYLOAD:                  "The transaction could not be decoded.",
+	peer.TxValidationCode_BAD_COMMON_HEADER:            "The transaction header was malformed.",
+	peer.TxValidationCode_BAD_CREATOR_SIGNATURE:        "The submitter's signature did not match the transaction.",
+	peer.TxValidationCode_INVALID_ENDORSER_TRANSACTION: "The endorsed proposal was malformed.",
+	peer.TxValidationCode_INVALID_CONFIG_TRANSACTION:   "The configuration update was not valid for the channel.",
+	peer.TxValidationCode_UNSUPPORTED_TX_PAYLOAD:       "The channel does not support this kind of transaction.",
+	peer.TxValidationCode_BAD_PROPOSAL_TXID:            "The transaction id did not match the proposal it was built from.",
+	peer.TxValidationCode_DUPLICATE_TXID:               "Another transaction with the same id had already been committed.",
+	peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:   "It was not endorsed by enough organizations to satisfy the contract's endorsement policy.",
+	peer.TxValidationCode_MVCC_READ_CONFLICT:           "A key it read was changed by another transaction after it was endorsed, so what it read was out of date.",
+	peer.TxValidationCode_PHANTOM_READ_CONFLICT:        "The results of a range query it ran changed after it was endorsed.",
+	peer.TxValidationCode_UNKNOWN_TX_TYPE:              "The transaction type was unknown.",
+	peer.TxValidationCode_TARGET_CHAIN_NOT_FOUND:       "The channel it was sent to does not exist.",
+	peer.TxValidationCode_MARSHAL_TX_ERROR:             "The transaction could not be encoded.",
+	peer.TxValidationCode_NIL_TXACTION:                 "The transaction carried no action.",
+	peer.TxValidationCode_EXPIRED_CHAINCODE:            "The contract version it called had been replaced.",
+	peer.TxValidationCode_CHAINCODE_VERSION_CONFLICT:   "It was endorsed by a contract version other than the committed one.",
+	peer.TxValidationCode_BAD_HEADER_EXTENSION:         "The contract header was malformed.",
+	peer.TxValidationCode_BAD_CHANNEL_HEADER:           "The channel header was malformed.",
+	peer.TxValidationCode_BAD_RESPONSE_PAYLOAD:         "The endorsement response was malformed.",
+	peer.TxValidationCode_BAD_RWSET:                    "Its read-write set was malformed.",
+	peer.TxValidationCode_ILLEGAL_WRITESET:             "It wrote keys it is not allowed to write.",
+	peer.TxValidationCode_INVALID_WRITESET:             "Its writes were not valid, e.g. to a namespace of another contract.",
+	peer.TxValidationCode_INVALID_CHAINCODE:            "The contract it called is not defined on the channel.",
+	peer.TxValidationCode_NOT_VALIDATED:                "Committing peers have not validated it.",
+	peer.TxValidationCode_INVALID_OTHER_REASON:         "Committing peers rejected it for a reason not recorded in the block.",
+}
+
+// TxExplanation tells what a transaction did in plain language, for readers who don't know read-write sets
+type TxExplanation struct {
+	ID          string        `json:"id"`
+	Network     string        `json:"network"`
+	BlockNumber uint64        `json:"blockNumber"`
+	TxIndex     int           `json:"txIndex"`
+	CreatedAt   int64         `json:"createdAt"`
+	Type        models.TxType `json:"type"`
+	// Summary tells what happened in a few sentences
+	Summary    string                  `json:"summary"`
+	Submitter  ExplainedSubmitter      `json:"submitter"`
+	Contract   *ExplainedContract      `json:"contract,omitempty"`
+	Keys       []ExplainedKey          `json:"keys"`
+	Validation ExplainedValidation     `json:"validation"`
+	Events     []models.ChaincodeEvent `json:"events"`
+	// Notes tell what is unknown and why
+	Notes []string `json:"notes,omitempty"`
+}
+
+type ExplainedSubmitter struct {
+	// Org is the MSP id of the submitter's organization
+	Org string `json:"org"`
+	// CommonName is from the submitter's certificate, empty if unknown
+	CommonName string `json:"commonName,omitempty"`
+}
+
+type ExplainedContract struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version,omitempty"`
+	Method  string   `json:"method"`
+	Args    []string `json:"args"`
+}
+
+type ExplainedKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	// Action is read, write or delete
+	Action string `json:"action"`
+	// Before is the value read for reads, or the value before the transaction for writes and deletes, absent if unknown
+	Before *string `json:"before,omitempty"`
+	// After is the value written
+	After *string `json:"after,omitempty"`
+	// Description tells what happened to the key in a sentence
+	Description string `json:"description"`
+}
+
+type ExplainedValidation struct {
+	Valid  bool   `json:"valid"`
+	Code   int32  `json:"code"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// keyHistory holds writes to keys by namespace and key
+type keyHistory map[string]map[string]*models.KeyWrite
+
+func (kh keyHistory) get(namespace, key string) *models.KeyWrite {
+	return kh[namespace][key]
+}
+
+func (kh keyHistory) set(namespace, key string, w *models.KeyWrite) {
+	if kh[namespace] == nil {
+		kh[namespace] = make(map[string]*models.KeyWrite)
+	}
+	kh[namespace][key] = w
+}
+
+// ExplainTransaction explains what a transaction did, who submitted it and whether it took effect
+func (h *handler) ExplainTransaction(ctx *fiber.Ctx) error {
+	klog.Info("viewer ExplainTransaction")
+	txHash := ctx.Params("txHash")
+	network := ctx.Params("network")
+
+	tx, err := h.transaction.Get(queryContext(ctx), TransArg{NetworkName: network, Hash: txHash})
+	if err != nil {
+		klog.Error(fmt.Sprintf("get transaction error: %s", err))
+		msg := err.Error()
+		ctx.Status(http.StatusInternalServerError)
+		if pg.ErrNoRows == err {
+			ctx.Status(http.StatusNotFound)
+			msg = fmt.Sprintf("transaction hash not found: %s", txHash)
+		}
+		return ctx.JSON(map[string]string{"msg": msg})
+	}
+
+	result, err := h.explain(queryContext(ctx), tx)
+	if err != nil {
+		klog.Error(fmt.Sprintf("explain transaction error: %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	return ctx.JSON(result)
+}
+
+// explain collects what is known about a transaction, and explains it
+func (h *handler) explain(ctx context.Context, tx *models.Transaction) (*TxExplanation, error) {
+	var notes []string
+	envelope, err := h.locateTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.raw == nil:
+		notes = append(notes, "Raw blocks are not kept, so the submitter's common name is unknown.")
+	case envelope == nil:
+		notes = append(notes, "The raw block of the transaction is not kept, so the submitter's common name is unknown.")
+	}
+
+	var rwsets []models.FabRWSet
+	if tx.Type == models.EndorserTransaction {
+		var note string
+		if rwsets, note, err = txRWSets(tx); err != nil {
+			return nil, err
+		}
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+
+	written, read := make(keyHistory), make(keyHistory)
+	if len(rwsets) > 0 {
+		if h.keys == nil {
+			notes = append(notes, "Key history is not available, so values before the transaction are unknown.")
+		} else if err := h.lookupKeys(ctx, tx, rwsets, written, read); err != nil {
+			return nil, err
+		} else if n := uncoveredKeys(rwsets, written, read); n > 0 {
+			notes = append(notes, fmt.Sprintf("No earlier write of %s is kept, which may be new or written before key history was recorded.", count(n, "key")))
+		}
+	}
+
+	exp := explainTx(tx, envelope, rwsets, written, read)
+	exp.Notes = append(notes, exp.Notes...)
+	return exp, nil
+}
+
+// locateTx loads the envelope of a transaction from its raw block, and takes the position and validation code from it,
+// which are authoritative even for rows decoded by earlier versions. It returns nil if the raw block is not kept.
+func (h *handler) locateTx(ctx context.Context, tx *models.Transaction) (*TxEnvelope, error) {
+	if h.raw == nil {
+		return nil, nil
+	}
+	envelope, err := loadTxEnvelope(ctx, h.raw, tx)
+	if err != nil {
+		if errors.Is(err, rawstore.ErrNotFound) || errors.Is(err, errTxNotInBlock) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tx.TxIndex = envelope.TxIndex
+	tx.ValidationCode = peer.TxValidationCode_value[envelope.ValidationCode]
+	return envelope, nil
+}
+
+// txRWSets returns read-write sets of a transaction, or a note telling why they are unknown
+func txRWSets(tx *models.Transaction) ([]models.FabRWSet, string, error) {
+	switch {
+	case tx.Type != models.EndorserTransaction:
+		return nil, "The transaction does not call a contract, so it has no keys.", nil
+	case tx.Filtered:
+		return nil, "Filtered blocks don't carry read-write sets, so keys are unknown.", nil
+	case tx.Payload == nil:
+		return nil, "The payload was pruned by retention, so keys are unknown.", nil
+	}
+	var rwsets []models.FabRWSet
+	if err := json.Unmarshal(tx.Payload, &rwsets); err != nil {
+		return nil, "", errors.Wrap(err, "decode read-write sets")
+	}
+	return rwsets, "", nil
+}
+
+// lookupKeys finds the last write before the transaction of each key it writes, and the write of each key it reads
+func (h *handler) lookupKeys(ctx context.Context, tx *models.Transaction, rwsets []models.FabRWSet, written, read keyHistory) error {
+	position := Position{BlockNumber: tx.BlockNumber, TxIndex: tx.TxIndex}
+	for _, rwset := range rwsets {
+		keys := make([]string, 0, len(rwset.Writes))
+		for _, w := range rwset.Writes {
+			keys = append(keys, w.Key)
+		}
+		latest, err := h.keys.Latest(ctx, tx.Network, rwset.Namespace, keys, position)
+		if err != nil {
+			return errors.Wrap(err, "find values before the transaction")
+		}
+		for key, w := range latest {
+			written.set(rwset.Namespace, key, w)
+		}
+
+		// reads of the same version are found at once
+		byVersion := make(map[Position][]string)
+		for _, r := range rwset.Reads {
+			version, err := protoutil.ParseReadVersion(r.Version)
+			if err != nil || version == nil {
+				continue
+			}
+			at := Position{BlockNumber: version.BlockNum + 1, TxIndex: int(version.TxNum)}
+			byVersion[at] = append(byVersion[at], r.Key)
+		}
+		for at, keys := range byVersion {
+			latest, err := h.keys.Latest(ctx, tx.Network, rwset.Namespace, keys, Position{BlockNumber: at.BlockNumber, TxIndex: at.TxIndex + 1})
+			if err != nil {
+				return errors.Wrap(err, "find values read")
+			}
+			for key, w := range latest {
+				// an earlier write means the write of the version is not kept
+				if w.BlockNumber == at.BlockNumber && w.TxIndex == at.TxIndex {
+					read.set(rwset.Namespace, key, w)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// explainTx explains a transaction with its envelope if known, the last writes before it to keys it writes,
+// and the writes of keys it reads
+func explainTx(tx *models.Transaction, envelope *TxEnvelope, rwsets []models.FabRWSet, written, read keyHistory) *TxExplanation {
+	code := peer.TxValidationCode(tx.ValidationCode)
+	exp := &TxExplanation{
+		ID:          tx.ID,
+		Network:     tx.Network,
+		BlockNumber: tx.BlockNumber,
+		TxIndex:     tx.TxIndex,
+		CreatedAt:   tx.CreatedAt,
+		Type:        tx.Type,
+		Submitter:   ExplainedSubmitter{Org: tx.Creator},
+		Keys:        make([]ExplainedKey, 0),
+		Validation: ExplainedValidation{
+			Valid:  code == peer.TxValidationCode_VALID,
+			Code:   tx.ValidationCode,
+			Name:   code.String(),
+			Reason: validationReasons[code],
+		},
+		Events: tx.Events,
+	}
+	if exp.Validation.Reason == "" {
+		exp.Validation.Reason = fmt.Sprintf("Committing peers rejected it with code %d.", tx.ValidationCode)
+	}
+	if exp.Events == nil {
+		exp.Events = make([]models.ChaincodeEvent, 0)
+	}
+	if envelope != nil && envelope.Envelope.SignatureHeader != nil && envelope.Envelope.SignatureHeader.Creator != nil {
+		exp.Submitter.CommonName = commonName(envelope.Envelope.SignatureHeader.Creator.IdBytes)
+	}
+	if tx.Type == models.EndorserTransaction {
+		name, version := tx.ChaincodeID, ""
+		if i := strings.LastIndex(tx.ChaincodeID, "_"); i > 0 && !tx.Filtered {
+			name, version = tx.ChaincodeID[:i], tx.ChaincodeID[i+1:]
+		}
+		exp.Contract = &ExplainedContract{Name: name, Version: version, Method: tx.Method, Args: tx.Args}
+		if exp.Contract.Args == nil {
+			exp.Contract.Args = make([]string, 0)
+		}
+	}
+
+	var reads, writes, deletes int
+	for _, rwset := range rwsets {
+		// a key read with no version did not exist before the transaction
+		absent := make(map[string]bool)
+		for _, r := range rwset.Reads {
+			key := ExplainedKey{Namespace: rwset.Namespace, Key: r.Key, Action: KeyRead}
+			version, err := protoutil.ParseReadVersion(r.Version)
+			switch {
+			case err != nil:
+				key.Description = fmt.Sprintf("Read key %q.", r.Key)
+			case version == nil:
+				absent[r.Key] = true
+				key.Description = fmt.Sprintf("Read key %q, which did not exist yet.", r.Key)
+			default:
+				if w := read.get(rwset.Namespace, r.Key); w != nil {
+					key.Before = value(w)
+					key.Description = fmt.Sprintf("Read key %q with value %s, written by transaction %s in block %d.", r.Key, describe(key.Before), w.TxID, w.BlockNumber)
+				} else {
+					key.Description = fmt.Sprintf("Read key %q written in block %d.", r.Key, version.BlockNum+1)
+				}
+			}
+			exp.Keys = append(exp.Keys, key)
+			reads++
+		}
+		for _, w := range rwset.Writes {
+			key := ExplainedKey{Namespace: rwset.Namespace, Key: w.Key, Action: KeyWrite}
+			last := written.get(rwset.Namespace, w.Key)
+			if last != nil {
+				key.Before = value(last)
+			}
+			if w.IsDelete {
+				key.Action = KeyDelete
+				deletes++
+				if key.Before != nil {
+					key.Description = fmt.Sprintf("Deleted key %q, whose value was %s.", w.Key, describe(key.Before))
+				} else {
+					key.Description = fmt.Sprintf("Deleted key %q.", w.Key)
+				}
+			} else {
+				after := w.Value
+				key.After = &after
+				writes++
+				switch {
+				case key.Before != nil:
+					key.Description = fmt.Sprintf("Changed key %q from %s to %s.", w.Key, describe(key.Before), describe(key.After))
+				case absent[w.Key] || (last != nil && last.IsDelete):
+					key.Description = fmt.Sprintf("Created key %q with value %s.", w.Key, describe(key.After))
+				default:
+					key.Description = fmt.Sprintf("Set key %q to %s.", w.Key, describe(key.After))
+				}
+			}
+			if !exp.Validation.Valid {
+				key.Description = "Not applied: " + key.Description
+			}
+			exp.Keys = append(exp.Keys, key)
+		}
+	}
+
+	exp.Summary = summarize(exp, reads, writes, deletes)
+	return exp
+}
+
+// uncoveredKeys counts keys read or written by a transaction whose earlier writes are not found in history.
+// They are either created by the transaction, or written before key writes were recorded or pruned.
+func uncoveredKeys(rwsets []models.FabRWSet, written, read keyHistory) int {
+	uncovered := make(map[string]bool)
+	for _, rwset := range rwsets {
+		absent := make(map[string]bool)
+		for _, r := range rwset.Reads {
+			version, err := protoutil.ParseReadVersion(r.Version)
+			switch {
+			case err != nil:
+			case version == nil:
+				absent[r.Key] = true
+			case read.get(rwset.Namespace, r.Key) == nil:
+				uncovered[rwset.Namespace+"\x00"+r.Key] = true
+			}
+		}
+		for _, w := range rwset.Writes {
+			if !absent[w.Key] && written.get(rwset.Namespace, w.Key) == nil {
+				uncovered[rwset.Namespace+"\x00"+w.Key] = true
+			}
+		}
+	}
+	return len(uncovered)
+}
+
+func summarize(exp *TxExplanation, reads, writes, deletes int) string {
+	var sb strings.Builder
+	who := exp.Submitter.Org
+	if exp.Submitter.CommonName != "" {
+		who = fmt.Sprintf("%s of %s", exp.Submitter.CommonName, exp.Submitter.Org)
+	}
+	if who == "" {
+		who = "An unknown submitter"
+	}
+	switch {
+	case exp.Contract != nil && exp.Contract.Method != "":
+		fmt.Fprintf(&sb, "%s called %s of contract %s", who, exp.Contract.Method, exp.Contract.Name)
+	case exp.Contract != nil:
+		fmt.Fprintf(&sb, "%s called contract %s", who, exp.Contract.Name)
+	case exp.Type == models.Config || exp.Type == models.ConfigUpdate:
+		fmt.Fprintf(&sb, "%s updated the channel configuration", who)
+	default:
+		fmt.Fprintf(&sb, "%s submitted a transaction", who)
+	}
+	fmt.Fprintf(&sb, " in block %d.", exp.BlockNumber)
+	if reads+writes+deletes > 0 {
+		fmt.Fprintf(&sb, " It read %s, wrote %s and deleted %s.", count(reads, "key"), count(writes, "key"), count(deletes, "key"))
+	}
+	if exp.Validation.Valid {
+		sb.WriteString(" It was valid.")
+	} else {
+		fmt.Fprintf(&sb, " It was rejected as %s: %s", exp.Validation.Name, exp.Validation.Reason)
+		if writes+deletes > 0 {
+			sb.WriteString(" None of its writes took effect.")
+		}
+	}
+	if len(exp.Events) > 0 {
+		names := make([]string, 0, len(exp.Events))
+		for _, e := range exp.Events {
+			names = append(names, fmt.Sprintf("%q", e.EventName))
+		}
+		fmt.Fprintf(&sb, " It emitted %s %s.", plural(len(names), "event"), strings.Join(names, ", "))
+	}
+	return sb.String()
+}
+
+// value returns the value of a write, nil for deletes
+func value(w *models.KeyWrite) *string {
+	if w.IsDelete {
+		return nil
+	}
+	v := string(w.Value)
+	return &v
+}
+
+// describe quotes a value in descriptions, long values are cut
+func describe(v *string) string {
+	if v == nil {
+		return "nothing"
+	}
+	if len(*v) > maxDescribedValue {
+		return fmt.Sprintf("%q…", strings.ToValidUTF8((*v)[:maxDescribedValue], ""))
+	}
+	return fmt.Sprintf("%q", *v)
+}
+
+func count(n int, noun string) string {
+	return fmt.Sprintf("%d %s", n, plural(n, noun))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// commonName returns CN of a certificate in PEM, empty if it's not one
+func commonName(idBytes string) string {
+	block, _ := pem.Decode([]byte(idBytes))
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+func TestExplainTx(t *testing.T) {
+	rwsets := []models.FabRWSet{{
+		Namespace: "basic",
+		Reads: []models.Read{
+			{Key: "asset1", Version: "block_num:4 tx_num:1"},
+			{Key: "asset2", Version: "<nil>"},
+		},
+		Writes: []models.Write{
+			{Key: "asset1", Value: "blue"},
+			{Key: "asset2", Value: "red"},
+			{Key: "asset3", IsDelete: true},
+		},
+	}}
+	payload, err := json.Marshal(rwsets)
+	require.NoError(t, err)
+	tx := &models.Transaction{
+		ID:          "tx1",
+		Network:     "network_channel",
+		BlockNumber: 10,
+		Creator:     "Org1MSP",
+		Type:        models.EndorserTransaction,
+		Payload:     payload,
+		ChaincodeID: "basic_1.0",
+		Method:      "Transfer",
+		Args:        []string{"asset1"},
+		Events:      []models.ChaincodeEvent{{ChaincodeID: "basic", EventName: "Transferred"}},
+	}
+	written, read := make(keyHistory), make(keyHistory)
+	written.set("basic", "asset1", &models.KeyWrite{Key: "asset1", Value: []byte("green"), BlockNumber: 5, TxIndex: 1, TxID: "tx0"})
+	written.set("basic", "asset3", &models.KeyWrite{Key: "asset3", Value: []byte("old"), BlockNumber: 2, TxID: "tx-1"})
+	read.set("basic", "asset1", &models.KeyWrite{Key: "asset1", Value: []byte("green"), BlockNumber: 5, TxIndex: 1, TxID: "tx0"})
+
+	exp := explainTx(tx, nil, rwsets, written, read)
+	assert.Equal(t, &ExplainedContract{Name: "basic", Version: "1.0", Method: "Transfer", Args: []string{"asset1"}}, exp.Contract)
+	assert.True(t, exp.Validation.Valid)
+	assert.Equal(t, "VALID", exp.Validation.Name)
+	require.Len(t, exp.Keys, 5)
+	assert.Equal(t, `Read key "asset1" with value "green", written by transaction tx0 in block 5.`, exp.Keys[0].Description)
+	assert.Equal(t, `Read key "asset2", which did not exist yet.`, exp.Keys[1].Description)
+	assert.Equal(t, `Changed key "asset1" from "green" to "blue".`, exp.Keys[2].Description)
+	assert.Equal(t, "green", *exp.Keys[2].Before)
+	assert.Equal(t, "blue", *exp.Keys[2].After)
+	assert.Equal(t, `Created key "asset2" with value "red".`, exp.Keys[3].Description)
+	assert.Equal(t, KeyDelete, exp.Keys[4].Action)
+	assert.Equal(t, `Deleted key "asset3", whose value was "old".`, exp.Keys[4].Description)
+	assert.Equal(t, `Org1MSP called Transfer of contract basic in block 10. It read 2 keys, wrote 2 keys and deleted 1 key. It was valid. It emitted event "Transferred".`, exp.Summary)
+
+	tx.ValidationCode = int32(peer.TxValidationCode_MVCC_READ_CONFLICT)
+	exp = explainTx(tx, nil, rwsets, written, read)
+	assert.False(t, exp.Validation.Valid)
+	assert.Equal(t, `Not applied: Changed key "asset1" from "green" to "blue".`, exp.Keys[2].Description)
+	assert.Contains(t, exp.Summary, "It was rejected as MVCC_READ_CONFLICT: A key it read was changed")
+	assert.Contains(t, exp.Summary, "None of its writes took effect.")
+
+	// asset2 did not exist, others are in history
+	assert.Equal(t, 0, uncoveredKeys(rwsets, written, read))
+	// history before key writes were recorded is missing
+	assert.Equal(t, 2, uncoveredKeys(rwsets, make(keyHistory), make(keyHistory)))
+}
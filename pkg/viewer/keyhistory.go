@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+// Position is where a transaction is in the chain, which orders writes to keys
+type Position struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	TxIndex     int    `json:"txIndex"`
+}
+
+// Less reports whether p is before other
+func (p Position) Less(other Position) bool {
+	return p.BlockNumber < other.BlockNumber || (p.BlockNumber == other.BlockNumber && p.TxIndex < other.TxIndex)
+}
+
+type KeyHistory interface {
+	// Latest returns the last write to each key of namespace before position, keys never written are absent
+	Latest(ctx context.Context, network, namespace string, keys []string, before Position) (map[string]*models.KeyWrite, error)
+
+	// Between returns at most limit writes to a key of namespace after position after and before position before, latest first
+	Between(ctx context.Context, network, namespace, key string, after, before Position, limit int) ([]*models.KeyWrite, error)
+}
+
+type KeyHistoryHandler struct {
+	db *pg.DB
+}
+
+func NewKeyHistory(db *pg.DB) KeyHistory {
+	return &KeyHistoryHandler{db: db}
+}
+
+func (k *KeyHistoryHandler) Latest(ctx context.Context, network, namespace string, keys []string, before Position) (map[string]*models.KeyWrite, error) {
+	result := make(map[string]*models.KeyWrite, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	var writes []*models.KeyWrite
+	_, err := k.db.QueryContext(ctx, &writes, `SELECT DISTINCT ON ("key") * FROM "key_writes"
+		WHERE "network" = ? AND "namespace" = ? AND "key" IN (?) AND ("blockNumber", "txIndex") < (?, ?)
+		ORDER BY "key", "blockNumber" DESC, "txIndex" DESC`,
+		network, namespace, pg.In(keys), before.BlockNumber, before.TxIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range writes {
+		result[w.Key] = w
+	}
+	return result, nil
+}
+
+func (k *KeyHistoryHandler) Between(ctx context.Context, network, namespace, key string, after, before Position, limit int) ([]*models.KeyWrite, error) {
+	writes := make([]*models.KeyWrite, 0)
+	_, err := k.db.QueryContext(ctx, &writes, `SELECT * FROM "key_writes"
+		WHERE "network" = ? AND "namespace" = ? AND "key" = ? AND ("blockNumber", "txIndex") > (?, ?) AND ("blockNumber", "txIndex") < (?, ?)
+		ORDER BY "blockNumber" DESC, "txIndex" DESC LIMIT ?`,
+		network, namespace, key, after.BlockNumber, after.TxIndex, before.BlockNumber, before.TxIndex, limit)
+	if err != nil {
+		return nil, err
+	}
+	return writes, nil
+}
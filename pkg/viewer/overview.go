@@ -17,6 +17,7 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/bestchains/bc-explorer/pkg/models"
@@ -31,6 +32,12 @@ const (
 type SummaryResp struct {
 	BlockNumber uint64 `pg:"blockNumber" json:"blockNumber"`
 	TxCount     uint64 `pg:"txCount" json:"txCount"`
+	// EarliestBlockNumber is the first block indexed, history before it is unavailable
+	EarliestBlockNumber uint64 `pg:"earliestBlockNumber" json:"earliestBlockNumber"`
+	// EarliestPayloadBlockNumber is the first block whose transactions keep payloads, arguments and events
+	EarliestPayloadBlockNumber uint64 `pg:"earliestPayloadBlockNumber" json:"earliestPayloadBlockNumber"`
+	// Truncated is true if history is not kept from the first block, by start position or retention of the network
+	Truncated bool `pg:"-" json:"truncated"`
 }
 
 type BySegResp struct {
@@ -41,11 +48,11 @@ type BySegResp struct {
 
 type Overview interface {
 	// Summary returns block height, number of transactions, number of nodes, total number of contracts.
-	Summary(string) (SummaryResp, error)
+	Summary(context.Context, string) (SummaryResp, error)
 
 	// QueryBySeg query the total number of transactions or blocks for a number of time periods
 	// from, interval,number of time periods
-	QueryBySeg(int64, int64, int64, string, string) ([]BySegResp, error)
+	QueryBySeg(context.Context, int64, int64, int64, string, string) ([]BySegResp, error)
 }
 
 type overview struct {
@@ -56,24 +63,31 @@ func NewOverview(db *pg.DB) Overview {
 	return &overview{db: db}
 }
 
-func (o *overview) Summary(network string) (SummaryResp, error) {
+func (o *overview) Summary(ctx context.Context, network string) (SummaryResp, error) {
 	var resp SummaryResp
-	if err := o.db.Model((*models.Transaction)(nil)).Where(`"network"=?`, network).
+	if err := o.db.ModelContext(ctx, (*models.Transaction)(nil)).Where(`"network"=?`, network).
 		ColumnExpr(`count(*) as "txCount"`).Select(&resp.TxCount); err != nil {
 		return resp, err
 	}
-	if err := o.db.Model((*models.Block)(nil)).Where(`"network"=?`, network).
+	if err := o.db.ModelContext(ctx, (*models.Block)(nil)).Where(`"network"=?`, network).
 		ColumnExpr(`max("blockNumber") as "blockNumber"`).Select(&resp.BlockNumber); err != nil {
 		return resp, err
 	}
+	if err := o.db.ModelContext(ctx, (*models.Network)(nil)).Where(`"id"=?`, network).
+		ColumnExpr(`coalesce("earliestBlockNumber", 1)`).
+		ColumnExpr(`greatest(coalesce("earliestPayloadBlockNumber", 1), coalesce("earliestBlockNumber", 1))`).
+		Select(&resp.EarliestBlockNumber, &resp.EarliestPayloadBlockNumber); err != nil && err != pg.ErrNoRows {
+		return resp, err
+	}
+	resp.Truncated = resp.EarliestBlockNumber > 1 || resp.EarliestPayloadBlockNumber > 1
 	return resp, nil
 }
 
-func (o *overview) QueryBySeg(from, interval, number int64, which, network string) ([]BySegResp, error) {
+func (o *overview) QueryBySeg(ctx context.Context, from, interval, number int64, which, network string) ([]BySegResp, error) {
 	// If there are more types, cast them into interface implementations
 	f, ok := bySegFuncs[which]
 	if !ok {
 		return nil, fmt.Errorf("not support type %s", which)
 	}
-	return f(o.db, network, from, interval, number)
+	return f(ctx, o.db, network, from, interval, number)
 }
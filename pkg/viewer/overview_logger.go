@@ -17,6 +17,8 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
+
 	"k8s.io/klog/v2"
 )
 
@@ -28,12 +30,12 @@ func NewOverviewLogger() Overview {
 	return &overviewLogger{}
 }
 
-func (o *overviewLogger) Summary(network string) (SummaryResp, error) {
+func (o *overviewLogger) Summary(_ context.Context, network string) (SummaryResp, error) {
 	klog.Infof("overviewLogger Summary with network %s\n", network)
-	return SummaryResp{BlockNumber: 1, TxCount: 1}, nil
+	return SummaryResp{BlockNumber: 1, TxCount: 1, EarliestBlockNumber: 1, EarliestPayloadBlockNumber: 1}, nil
 }
 
-func (o *overviewLogger) QueryBySeg(from, interval, number int64, which, network string) ([]BySegResp, error) {
+func (o *overviewLogger) QueryBySeg(_ context.Context, from, interval, number int64, which, network string) ([]BySegResp, error) {
 	klog.Infof("overviewLogger QueryBySeg")
 	klog.Infof("from=%s, interval=%d, number=%d, which=%s, network=%s\n", from, interval, number, which, network)
 	return []BySegResp{{Start: 0, End: 5, Count: 5}}, nil
@@ -17,6 +17,7 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
 	"sync"
 
 	"github.com/bestchains/bc-explorer/pkg/models"
@@ -24,7 +25,7 @@ import (
 	"k8s.io/klog/v2"
 )
 
-type BySegFunc func(*pg.DB, string, int64, int64, int64) ([]BySegResp, error)
+type BySegFunc func(context.Context, *pg.DB, string, int64, int64, int64) ([]BySegResp, error)
 
 var bySegFuncs = map[string]BySegFunc{
 	BlockAggregation:       QueryBlocks,
@@ -34,7 +35,7 @@ var bySegFuncs = map[string]BySegFunc{
 // QueryByBlocks
 // from=0,interval=5,number=2
 // [-5,0),[0-5), [5-10)
-func QueryBlocks(db *pg.DB, network string, from, interval, number int64) ([]BySegResp, error) {
+func QueryBlocks(ctx context.Context, db *pg.DB, network string, from, interval, number int64) ([]BySegResp, error) {
 	start := from - interval
 	result := make([]BySegResp, number+1)
 	ch := make(chan error, number+1)
@@ -45,7 +46,7 @@ func QueryBlocks(db *pg.DB, network string, from, interval, number int64) ([]ByS
 		wg.Add(1)
 		go func(i int, s, e int64) {
 			defer wg.Done()
-			if err := db.Model((*models.Block)(nil)).Where(`"network"=?`, network).Where(`"createdAt">=?`, s).Where(`"createdAt"<=?`, e).
+			if err := db.ModelContext(ctx, (*models.Block)(nil)).Where(`"network"=?`, network).Where(`"createdAt">=?`, s).Where(`"createdAt"<=?`, e).
 				ColumnExpr(`count(*) as count`).Select(&result[i].Count); err != nil {
 				ch <- err
 				klog.Error(err)
@@ -62,7 +63,7 @@ func QueryBlocks(db *pg.DB, network string, from, interval, number int64) ([]ByS
 	return result, nil
 }
 
-func QueryTrnasactions(db *pg.DB, network string, from, interval, number int64) ([]BySegResp, error) {
+func QueryTrnasactions(ctx context.Context, db *pg.DB, network string, from, interval, number int64) ([]BySegResp, error) {
 	start := from - interval
 	result := make([]BySegResp, number+1)
 	ch := make(chan error, number+1)
@@ -73,7 +74,7 @@ func QueryTrnasactions(db *pg.DB, network string, from, interval, number int64)
 		wg.Add(1)
 		go func(i int, s, e int64) {
 			defer wg.Done()
-			if err := db.Model((*models.Transaction)(nil)).Where(`"network"=?`, network).Where(`"createdAt">=?`, s).Where(`"createdAt"<=?`, e).
+			if err := db.ModelContext(ctx, (*models.Transaction)(nil)).Where(`"network"=?`, network).Where(`"createdAt">=?`, s).Where(`"createdAt"<=?`, e).
 				ColumnExpr(`count(*) as count`).Select(&result[i].Count); err != nil {
 				ch <- err
 				klog.Error(err)
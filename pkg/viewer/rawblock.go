@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
+)
+
+const (
+	RawFormatProtobuf = "protobuf"
+	RawFormatJSON     = "json"
+)
+
+// GetRawBlock downloads an original block by number, in protobuf by default or protojson
+func (h *handler) GetRawBlock(ctx *fiber.Ctx) error {
+	klog.Info("viewer GetRawBlock")
+	if h.raw == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": errRawNotKept.Error()})
+	}
+	network := ctx.Params("network")
+	number, err := strconv.ParseUint(ctx.Params("blockNumber"), 10, 64)
+	if err != nil || number == 0 {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{"msg": "blockNumber must be a positive integer"})
+	}
+	format := ctx.Query("format", RawFormatProtobuf)
+	if format != RawFormatProtobuf && format != RawFormatJSON {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{"msg": fmt.Sprintf("unknown format %s, protobuf or json", format)})
+	}
+
+	raw, err := h.raw.Get(queryContext(ctx), network, number)
+	if err != nil {
+		klog.Error(fmt.Sprintf("get raw block error %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		if errors.Is(err, rawstore.ErrNotFound) {
+			ctx.Status(http.StatusNotFound)
+		}
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+
+	ctx.Set("X-Block-Hash", raw.Hash)
+	if format == RawFormatProtobuf {
+		ctx.Set(fiber.HeaderContentType, "application/octet-stream")
+		ctx.Attachment(fmt.Sprintf("%s-%d.block", network, number))
+		return ctx.Send(raw.Data)
+	}
+	block, err := rawstore.Block(raw)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	data, err := protojson.Marshal(block)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return ctx.Send(data)
+}
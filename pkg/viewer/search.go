@@ -0,0 +1,243 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/auth"
+	"github.com/bestchains/bc-explorer/pkg/models"
+)
+
+const (
+	MatchBlock       = "block"
+	MatchTransaction = "transaction"
+	MatchIdentity    = "identity"
+	MatchChaincode   = "chaincode"
+	MatchKey         = "key"
+)
+
+var (
+	// maxSearchSize limits matches of each type returned by a search
+	maxSearchSize = 100
+	// hashPattern matches block hashes and transaction ids, which are hex of sha256
+	hashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	// namePattern matches MSP ids and chaincode names
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// SearchMatch is something found by a search, fields not applicable to its type are empty
+type SearchMatch struct {
+	// Type is block, transaction, identity, chaincode or key
+	Type    string `pg:"-" json:"type"`
+	Network string `pg:"network" json:"network"`
+	// ID is the block hash, transaction id, MSP id, chaincode id or key matched
+	ID string `pg:"id" json:"id"`
+	// BlockNumber is the block of a block or transaction, or the latest block writing a key
+	BlockNumber uint64 `pg:"blockNumber" json:"blockNumber,omitempty"`
+	// Namespace is the chaincode of a key
+	Namespace string `pg:"namespace" json:"namespace,omitempty"`
+	CreatedAt int64  `pg:"createdAt" json:"createdAt,omitempty"`
+	// Count is the number of transactions of an identity or chaincode, or writes to a key
+	Count int64 `pg:"count" json:"count,omitempty"`
+}
+
+type Search interface {
+	// Networks returns ids of all networks
+	Networks(ctx context.Context) ([]string, error)
+
+	// Find returns at most limit matches of q of a type in networks
+	Find(ctx context.Context, networks []string, matchType, q string, limit int) ([]SearchMatch, error)
+}
+
+type SearchHandler struct {
+	db *pg.DB
+}
+
+func NewSearch(db *pg.DB) Search {
+	return &SearchHandler{db: db}
+}
+
+func (s *SearchHandler) Networks(ctx context.Context) ([]string, error) {
+	var networks []string
+	err := s.db.ModelContext(ctx, (*models.Network)(nil)).Column("id").Order("id").Select(&networks)
+	return networks, err
+}
+
+func (s *SearchHandler) Find(ctx context.Context, networks []string, matchType, q string, limit int) ([]SearchMatch, error) {
+	matches := make([]SearchMatch, 0)
+	if len(networks) == 0 {
+		return matches, nil
+	}
+	var query string
+	params := []interface{}{pg.In(networks)}
+	switch matchType {
+	case MatchBlock:
+		query = `SELECT "network", "blockHash" AS "id", "blockNumber", "createdAt" FROM "blocks" WHERE "network" IN (?) AND `
+		if number, err := strconv.ParseUint(q, 10, 64); err == nil {
+			query += `"blockNumber" = ?`
+			params = append(params, number)
+		} else {
+			query += `"blockHash" = ?`
+			params = append(params, strings.ToLower(q))
+		}
+		query += ` ORDER BY "createdAt" DESC LIMIT ?`
+	case MatchTransaction:
+		query = `SELECT "network", "id", "blockNumber", "createdAt" FROM "transactions" WHERE "network" IN (?) AND "id" = ? LIMIT ?`
+		params = append(params, strings.ToLower(q))
+	case MatchIdentity:
+		query = `SELECT "network", "creator" AS "id", count(*) AS "count" FROM "transactions" WHERE "network" IN (?) AND "creator" = ?
+			GROUP BY "network", "creator" ORDER BY "count" DESC LIMIT ?`
+		params = append(params, q)
+	case MatchChaincode:
+		// chaincodeId is {name}_{version} in blocks, and only the name in filtered blocks
+		query = `SELECT "network", "chaincodeId" AS "id", count(*) AS "count" FROM "transactions" WHERE "network" IN (?) AND ("chaincodeId" = ? OR "chaincodeId" LIKE ?)
+			GROUP BY "network", "chaincodeId" ORDER BY "count" DESC LIMIT ?`
+		params = append(params, q, likePrefix(q+"_"))
+	case MatchKey:
+		query = `SELECT "network", "namespace", "key" AS "id", max("blockNumber") AS "blockNumber", count(*) AS "count" FROM "key_writes" WHERE "network" IN (?) AND "key" = ?
+			GROUP BY "network", "namespace", "key" ORDER BY "blockNumber" DESC LIMIT ?`
+		params = append(params, q)
+	default:
+		return nil, fmt.Errorf("unknown match type %s", matchType)
+	}
+	params = append(params, limit)
+	if _, err := s.db.QueryContext(ctx, &matches, query, params...); err != nil {
+		return nil, err
+	}
+	for i := range matches {
+		matches[i].Type = matchType
+	}
+	return matches, nil
+}
+
+// matchTypes detects what q might be, and returns types of matches to search for
+func matchTypes(q string) []string {
+	switch {
+	case hashPattern.MatchString(q):
+		return []string{MatchBlock, MatchTransaction, MatchKey}
+	case isNumber(q):
+		return []string{MatchBlock, MatchKey}
+	case namePattern.MatchString(q):
+		return []string{MatchIdentity, MatchChaincode, MatchKey}
+	default:
+		return []string{MatchKey}
+	}
+}
+
+func isNumber(q string) bool {
+	_, err := strconv.ParseUint(q, 10, 64)
+	return err == nil
+}
+
+// SearchNetwork finds blocks, transactions, identities, chaincodes and keys matching q in a network
+func (h *handler) SearchNetwork(ctx *fiber.Ctx) error {
+	klog.Info("viewer SearchNetwork")
+	return h.searchIn(ctx, []string{ctx.Params("network")})
+}
+
+// SearchNetworks finds blocks, transactions, identities, chaincodes and keys matching q in networks the user can get
+func (h *handler) SearchNetworks(ctx *fiber.Ctx) error {
+	klog.Info("viewer SearchNetworks")
+	if h.search == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": "search is not available"})
+	}
+	networks, err := h.search.Networks(queryContext(ctx))
+	if err == nil {
+		networks, err = authorizedNetworks(queryContext(ctx), networks, auth.NetworkFilterFrom(ctx))
+	}
+	if err != nil {
+		klog.Error(fmt.Sprintf("list networks error: %s", err))
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{"msg": err.Error()})
+	}
+	return h.searchIn(ctx, networks)
+}
+
+func (h *handler) searchIn(ctx *fiber.Ctx, networks []string) error {
+	if h.search == nil {
+		ctx.Status(http.StatusNotImplemented)
+		return ctx.JSON(map[string]string{"msg": "search is not available"})
+	}
+	q := strings.TrimSpace(ctx.Query("q"))
+	if q == "" {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{"msg": "q can't be empty"})
+	}
+	size := searchSize(ctx.QueryInt("size", 10))
+	klog.V(5).Infof(" with ctx %+v, q: %s, networks: %v\n", *ctx, q, networks)
+
+	types := matchTypes(q)
+	result := make([]SearchMatch, 0)
+	for _, matchType := range types {
+		matches, err := h.search.Find(queryContext(ctx), networks, matchType, q, size)
+		if err != nil {
+			klog.Error(fmt.Sprintf("search %s error: %s", matchType, err))
+			ctx.Status(http.StatusInternalServerError)
+			return ctx.JSON(map[string]string{"msg": err.Error()})
+		}
+		result = append(result, matches...)
+	}
+
+	data := map[string]interface{}{
+		"types": types,
+		"data":  result,
+		"count": len(result),
+	}
+	return ctx.JSON(data)
+}
+
+// searchSize clamps size of each type of matches to [1, maxSearchSize], 10 if it's not positive
+func searchSize(size int) int {
+	switch {
+	case size <= 0:
+		return 10
+	case size > maxSearchSize:
+		return maxSearchSize
+	default:
+		return size
+	}
+}
+
+// authorizedNetworks returns networks allowed by filter, all if filter is nil
+func authorizedNetworks(ctx context.Context, networks []string, filter auth.NetworkFilter) ([]string, error) {
+	if filter == nil {
+		return networks, nil
+	}
+	allowed := make([]string, 0, len(networks))
+	for _, network := range networks {
+		ok, err := filter(ctx, network)
+		if err != nil {
+			return nil, errors.Wrapf(err, "authorize network %s", network)
+		}
+		if ok {
+			allowed = append(allowed, network)
+		}
+	}
+	return allowed, nil
+}
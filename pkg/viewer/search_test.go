@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package viewer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTypes(t *testing.T) {
+	testCases := map[string][]string{
+		strings.Repeat("a1", 32): {MatchBlock, MatchTransaction, MatchKey},
+		strings.Repeat("A1", 32): {MatchBlock, MatchTransaction, MatchKey},
+		"12":                     {MatchBlock, MatchKey},
+		"Org1MSP":                {MatchIdentity, MatchChaincode, MatchKey},
+		"basic_1.0":              {MatchIdentity, MatchChaincode, MatchKey},
+		"asset 1":                {MatchKey},
+		"\x00asset":              {MatchKey},
+	}
+	for q, expected := range testCases {
+		assert.Equal(t, expected, matchTypes(q), q)
+	}
+}
+
+func TestSearchSize(t *testing.T) {
+	testCases := map[int]int{-1: 10, 0: 10, 1: 1, 20: 20, maxSearchSize: maxSearchSize, 1 << 30: maxSearchSize}
+	for size, expected := range testCases {
+		assert.Equal(t, expected, searchSize(size), size)
+	}
+}
+
+func TestAuthorizedNetworks(t *testing.T) {
+	networks := []string{"a_ch1", "a_ch2", "b_ch1"}
+	all, err := authorizedNetworks(context.Background(), networks, nil)
+	require.NoError(t, err)
+	assert.Equal(t, networks, all)
+
+	allowed, err := authorizedNetworks(context.Background(), networks, func(_ context.Context, network string) (bool, error) {
+		return strings.HasPrefix(network, "a_"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a_ch1", "a_ch2"}, allowed)
+
+	_, err = authorizedNetworks(context.Background(), networks, func(context.Context, string) (bool, error) {
+		return false, errors.New("unavailable")
+	})
+	assert.Error(t, err)
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
 	"k8s.io/klog/v2"
 
 	"github.com/bestchains/bc-explorer/pkg/models"
@@ -68,13 +71,16 @@ func (ta *TransArg) ToCond() ([]string, []interface{}) {
 
 type Transaction interface {
 	// List : query transactions
-	List(ta TransArg) ([]models.Transaction, int64, error)
+	List(ctx context.Context, ta TransArg) ([]models.Transaction, int64, error)
 
 	// Get : query transaction by transaction hash
-	Get(ta TransArg) (*models.Transaction, error)
+	Get(ctx context.Context, ta TransArg) (*models.Transaction, error)
 
 	// CountByOrg : count how many transactions are created by each organization
-	CountByOrg(ta TransArg) ([]Count, error)
+	CountByOrg(ctx context.Context, ta TransArg) ([]Count, error)
+
+	// ListConflicts : query the latest transactions calling a chaincode which are invalidated by MVCC read conflicts
+	ListConflicts(ctx context.Context, ta TransArg, chaincode string, limit int) ([]models.Transaction, error)
 }
 
 type TxHandler struct {
@@ -85,7 +91,7 @@ func NewTxHandler(db *pg.DB) Transaction {
 	return &TxHandler{db: db}
 }
 
-func (t *TxHandler) List(ta TransArg) ([]models.Transaction, int64, error) {
+func (t *TxHandler) List(ctx context.Context, ta TransArg) ([]models.Transaction, int64, error) {
 
 	if ta.NetworkName == "" {
 		return nil, 0, fmt.Errorf("network name can't be empty")
@@ -95,7 +101,7 @@ func (t *TxHandler) List(ta TransArg) ([]models.Transaction, int64, error) {
 	query, params := ta.ToCond()
 	klog.V(5).Infof(" list query %s\n", query)
 
-	q := t.db.Model(&txs)
+	q := t.db.ModelContext(ctx, &txs)
 	for i := 0; i < len(query); i++ {
 		q = q.Where(query[i], params[i])
 	}
@@ -115,25 +121,51 @@ func (t *TxHandler) List(ta TransArg) ([]models.Transaction, int64, error) {
 	return txs, int64(c), nil
 }
 
-func (t *TxHandler) Get(ta TransArg) (*models.Transaction, error) {
+func (t *TxHandler) Get(ctx context.Context, ta TransArg) (*models.Transaction, error) {
 	var tx = new(models.Transaction)
-	_, err := t.db.QueryOne(tx, `select * from transactions where "id" = ?`, ta.Hash)
+	// network narrows the lookup to partitions of the network if transactions are partitioned
+	_, err := t.db.QueryOneContext(ctx, tx, `select * from transactions where "network" = ? and "id" = ?`, ta.NetworkName, ta.Hash)
 	if err != nil {
 		return nil, err
 	}
 	return tx, err
 }
 
-func (t *TxHandler) CountByOrg(ta TransArg) ([]Count, error) {
+func (t *TxHandler) CountByOrg(ctx context.Context, ta TransArg) ([]Count, error) {
 	if ta.NetworkName == "" {
 		return nil, fmt.Errorf("network name can't be empty")
 	}
 
 	var res []Count
 
-	if err := t.db.Model((*models.Transaction)(nil)).Where(`"network" = ?`, ta.NetworkName).Column(`creator`).ColumnExpr(`count(*) as "count"`).Group(`creator`).Select(&res); err != nil {
+	if err := t.db.ModelContext(ctx, (*models.Transaction)(nil)).Where(`"network" = ?`, ta.NetworkName).Column(`creator`).ColumnExpr(`count(*) as "count"`).Group(`creator`).Select(&res); err != nil {
 		return nil, err
 	}
 
 	return res, nil
 }
+
+func (t *TxHandler) ListConflicts(ctx context.Context, ta TransArg, chaincode string, limit int) ([]models.Transaction, error) {
+	if ta.NetworkName == "" {
+		return nil, fmt.Errorf("network name can't be empty")
+	}
+
+	txs := make([]models.Transaction, 0)
+	query, params := ta.ToCond()
+	q := t.db.ModelContext(ctx, &txs)
+	for i := 0; i < len(query); i++ {
+		q = q.Where(query[i], params[i])
+	}
+	// chaincodeId is {name}_{version} in blocks, and only the name in filtered blocks
+	q = q.Where(`"validationCode" = ?`, int32(peer.TxValidationCode_MVCC_READ_CONFLICT)).
+		Where(`("chaincodeId" = ? OR "chaincodeId" LIKE ?)`, chaincode, likePrefix(chaincode+"_"))
+	if err := q.Order(`createdAt desc`).Limit(limit).Select(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// likePrefix returns a LIKE pattern matching strings starting with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
@@ -17,23 +17,41 @@ limitations under the License.
 package viewer
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-explorer/pkg/metrics"
+	"github.com/bestchains/bc-explorer/pkg/rawstore"
 )
 
+// errRawNotKept is returned by APIs serving raw blocks, which are not kept unless listener and viewer are started with -raw-store.
+// Stored transactions don't keep signatures and endorsements, so these APIs can not fall back to them.
+var errRawNotKept = errors.New("raw blocks are not kept, start listener and viewer with the same -raw-store other than none")
+
 type handler struct {
 	block       Block
 	transaction Transaction
 	overview    Overview
+	keys        KeyHistory
+	search      Search
+	// raw is nil if raw blocks are not kept
+	raw rawstore.Store
+}
+
+func NewViewHandler(t Transaction, b Block, o Overview, k KeyHistory, s Search, raw rawstore.Store) handler {
+	return handler{transaction: t, block: b, overview: o, keys: k, search: s, raw: raw}
 }
 
-func NewViewHandler(t Transaction, b Block, o Overview) handler {
-	return handler{transaction: t, block: b, overview: o}
+// queryContext carries the route of a request to database queries, so that their duration is observed by route
+func queryContext(ctx *fiber.Ctx) context.Context {
+	return metrics.WithRoute(ctx.UserContext(), ctx.Route().Path)
 }
 
 func (h *handler) ListBlocks(ctx *fiber.Ctx) error {
@@ -49,7 +67,7 @@ func (h *handler) ListBlocks(ctx *fiber.Ctx) error {
 		BlockHash:   ctx.Query("blockHash"),
 	}
 	klog.V(5).Infof(" with ctx  %+v arg: %+v\n", *ctx, arg)
-	result, count, err := h.block.List(arg)
+	result, count, err := h.block.List(queryContext(ctx), arg)
 
 	if err != nil {
 		klog.Error(fmt.Sprintf("List Blocks error %s", err))
@@ -75,7 +93,7 @@ func (h *handler) GetBlock(ctx *fiber.Ctx) error {
 	arg := BlockArg{BlockHash: blockHash, Network: network}
 	klog.V(5).Infof(" with ctx %+v, arg: %+v\n", *ctx, arg)
 
-	result, err := h.block.Get(arg)
+	result, err := h.block.Get(queryContext(ctx), arg)
 
 	if err != nil {
 		klog.Error(fmt.Sprintf("get block error %s", err))
@@ -104,7 +122,7 @@ func (h *handler) ListTransactions(ctx *fiber.Ctx) error {
 		BlockNum:    uint64(ctx.QueryInt("blockNumber", 0)),
 	}
 	klog.V(5).Infof(" with ctx %+v arg: %=v\n", *ctx, arg)
-	result, count, err := h.transaction.List(arg)
+	result, count, err := h.transaction.List(queryContext(ctx), arg)
 
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
@@ -134,7 +152,7 @@ func (h *handler) GetTransactionByTxHash(ctx *fiber.Ctx) error {
 	}
 	klog.V(5).Infof(" with ctx %+v, arg: %+v\n", *ctx, arg)
 
-	result, err := h.transaction.Get(arg)
+	result, err := h.transaction.Get(queryContext(ctx), arg)
 
 	if err != nil {
 		klog.Error(fmt.Sprintf("get transaction error: %s", err))
@@ -161,7 +179,7 @@ func (h *handler) CountTransactionsCreatedByOrg(ctx *fiber.Ctx) error {
 	}
 	klog.V(5).Infof(" with ctx %+v, arg: %+v\n", *ctx, arg)
 
-	result, err := h.transaction.CountByOrg(arg)
+	result, err := h.transaction.CountByOrg(queryContext(ctx), arg)
 	if err != nil {
 		klog.Error(fmt.Sprintf("count transaction error: %s", err))
 		msg := err.Error()
@@ -185,7 +203,7 @@ func (h *handler) Summary(ctx *fiber.Ctx) error {
 	klog.Info("viewer Summary")
 	klog.V(5).Infof(" with ctx %+v\n", *ctx)
 	network := ctx.Params("network")
-	result, err := h.overview.Summary(network)
+	result, err := h.overview.Summary(queryContext(ctx), network)
 	if err != nil {
 		klog.Error(err)
 		ctx.Status(http.StatusInternalServerError)
@@ -207,7 +225,7 @@ func (h *handler) QueryBySeg(ctx *fiber.Ctx) error {
 	_type := ctx.Query("type", BlockAggregation)
 	network := ctx.Params("network")
 
-	result, err := h.overview.QueryBySeg(from, interval, number, _type, network)
+	result, err := h.overview.QueryBySeg(queryContext(ctx), from, interval, number, _type, network)
 	if err != nil {
 		klog.Error(err)
 		ctx.Status(http.StatusInternalServerError)